@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"syscall"
 
 	"github.com/etf1/kafka-mongo-watcher/config"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
 	"github.com/etf1/kafka-mongo-watcher/internal/service"
 	"github.com/gol4ng/logger"
 	signal_subscriber "github.com/gol4ng/signal"
@@ -15,37 +17,107 @@ var (
 	configPrefix = "kafka_mongo_watcher"
 )
 
+const (
+	// The stream has been halted by a failure, messages after the failed one have not been produced
+	exitCodeHalted = 1
+	// Messages were still waiting to be delivered when the Kafka client has been closed
+	exitCodeUndelivered = 3
+)
+
 func main() {
+	os.Exit(run())
+}
 
+func run() int {
 	if prefixFromEnv := os.Getenv("KAFKA_MONGO_WATCHER_PREFIX"); prefixFromEnv != "" {
 		configPrefix = prefixFromEnv
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	cfg := config.NewBase(ctx, configPrefix)
 
 	container := service.NewContainer(ctx, cfg)
 	go container.GetHttpServer().Start(ctx)
+	if grpcServer := container.GetGrpcServer(); grpcServer != nil {
+		// Refuses to start when the subscriptions cannot be served
+		listener, err := grpcServer.Listen()
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				container.GetLogger().Error("gRPC server stopped", logger.Error("error", err))
+			}
+		}()
+	}
 
-	defer handleExitSignal(ctx, cancel, container)()
+	defer handleExitSignal(cancel, container)()
 
-	changeEventChan, err := container.GetChangeEventProducer()(ctx)
+	// Refuses to start when the topics do not meet the pipeline needs
+	if err := container.ProvisionTopics(); err != nil {
+		panic(err)
+	}
+
+	// The stream context is canceled when the application stops or a dead letter policy halts the stream
+	streamCtx := container.Context()
+
+	changeEventChan, err := container.GetChangeEventProducer()(streamCtx)
 	if err != nil {
 		panic(err)
 	}
 	kafkaMessageChan := container.GetChangeEventKafkaMessageTransformer().Transform(changeEventChan)
-	container.GetKafkaClient().Produce(kafkaMessageChan)
+
+	// Returns once the change stream stopped and all the in-flight messages have been produced and flushed
+	closeErr := kafka.ProduceAll(streamCtx, container.GetSink(), kafkaMessageChan, container.GetLogger())
+
+	// The producer is closed, wait for the last delivery reports
+	<-container.GetDispatcher().Done()
+	container.GetLogger().Info("Stream stopped", logger.ByteString("last_delivered_checkpoint", container.GetCheckpointTracker().Checkpoint()))
+
+	if err := container.PersistCheckpoint(); err != nil {
+		container.GetLogger().Error("Unable to persist checkpoint", logger.Error("error", err))
+	}
+
+	shutdown(container)
+
+	if cause := context.Cause(streamCtx); cause != nil && !errors.Is(cause, context.Canceled) {
+		container.GetLogger().Error("Stream halted", logger.Error("error", cause))
+		return exitCodeHalted
+	}
+	if errors.Is(closeErr, kafka.ErrUndelivered) {
+		container.GetLogger().Error("Messages left undelivered", logger.Error("error", closeErr))
+		return exitCodeUndelivered
+	}
+	return 0
+}
+
+// Closes the connections and servers once the stream is over
+func shutdown(container *service.Container) {
+	ctx, cancel := context.WithTimeout(context.Background(), container.Cfg.ShutdownTimeout)
+	defer cancel()
+
+	log := container.GetLogger()
+	if err := container.GetMongoConnection().Client().Disconnect(ctx); err != nil {
+		log.Error("Unable to disconnect from MongoDB", logger.Error("error", err))
+	}
+	if grpcServer := container.GetGrpcServer(); grpcServer != nil {
+		if err := grpcServer.Close(ctx); err != nil {
+			log.Error("Unable to close gRPC server", logger.Error("error", err))
+		}
+	}
+	if err := container.GetHttpServer().Close(ctx); err != nil {
+		log.Error("Unable to close HTTP server", logger.Error("error", err))
+	}
 }
 
-// Handle for an exit signal in order to quit application on a proper way (shutting down connections and servers)
-func handleExitSignal(ctx context.Context, cancel context.CancelFunc, container *service.Container) func() {
+// Handle for an exit signal in order to stop the change stream, the application then quits once the
+// in-flight messages have been delivered. A second signal kills the application.
+func handleExitSignal(cancel context.CancelFunc, container *service.Container) func() {
 	return signal_subscriber.SubscribeWithKiller(func(signal os.Signal) {
 		log := container.GetLogger()
 		log.Info("Signal received: gracefully stopping application", logger.String("signal", signal.String()))
 
 		cancel()
-		container.GetKafkaClient().Close()
-		container.GetMongoConnection().Client().Disconnect(ctx)
-		container.GetHttpServer().Close(ctx)
 	}, os.Interrupt, syscall.SIGTERM)
 }
@@ -61,7 +61,7 @@ func TestMainModeReplay(t *testing.T) {
 		panic(err)
 	}
 	kafkaMessageChan := container.GetChangeEventKafkaMessageTransformer().Transform(changeEventChan)
-	container.GetKafkaClient().Produce(kafkaMessageChan)
+	kafka.ProduceAll(ctx, container.GetSink(), kafkaMessageChan, container.GetLogger())
 
 	// Then
 	assert := assert.New(t)
@@ -88,7 +88,7 @@ func TestMainModeWatch(t *testing.T) {
 		panic(err)
 	}
 	kafkaMessageChan := container.GetChangeEventKafkaMessageTransformer().Transform(changeEventChan)
-	go container.GetKafkaClient().Produce(kafkaMessageChan)
+	go kafka.ProduceAll(ctx, container.GetSink(), kafkaMessageChan, container.GetLogger())
 
 	// And I insert fixtures in mongodb collection
 	fixtures := prepareFixturesDocumentsInMongoDB(ctx, t, cfg.CollectionName, container.GetMongoConnection())
@@ -1,6 +1,8 @@
 package debug
 
 import (
+	"sync/atomic"
+
 	"github.com/etf1/kafka-mongo-watcher/config"
 	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
 	"github.com/etf1/kafka-mongo-watcher/internal/mongo"
@@ -10,6 +12,8 @@ import (
 type Debugger struct {
 	cfg    *config.Base
 	events chan *Event
+	// Events dropped because the debug handler was not ready to take them
+	dropped atomic.Uint64
 }
 
 func NewDebugger(cfg *config.Base) *Debugger {
@@ -19,7 +23,7 @@ func NewDebugger(cfg *config.Base) *Debugger {
 	}
 }
 
-func (d *Debugger) Add(message *kafka.Message) {
+func (d *Debugger) Add(message *kafka.Message, deliveryErr error) {
 	if message == nil {
 		return
 	}
@@ -41,12 +45,27 @@ func (d *Debugger) Add(message *kafka.Message) {
 		return
 	}
 
-	d.events <- &Event{
-		Timestamp: event.ClusterTime.Unix(),
+	debugEvent := &Event{
+		Timestamp: int64(event.ClusterTime.T),
 		ID:        event.DocumentKey.ID.Hex(),
 		Operation: event.Operation,
 		Value:     value,
 	}
+	if deliveryErr != nil {
+		debugEvent.Error = deliveryErr.Error()
+	}
+
+	// Called on the dispatcher goroutine, which must never wait for the debug clients
+	select {
+	case d.events <- debugEvent:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events dropped because the debug handler was busy
+func (d *Debugger) Dropped() uint64 {
+	return d.dropped.Load()
 }
 
 func (d *Debugger) Context() map[string]interface{} {
@@ -5,4 +5,6 @@ type Event struct {
 	ID        string `json:"id"`
 	Operation string `json:"operation"`
 	Value     []byte `json:"value"`
+	// Delivery error, empty when the message has been delivered
+	Error string `json:"error,omitempty"`
 }
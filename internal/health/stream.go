@@ -0,0 +1,162 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StreamDetails describes the state of the change stream
+type StreamDetails struct {
+	Running     bool       `json:"running"`
+	CursorOpen  bool       `json:"cursor_open"`
+	Paused      bool       `json:"paused"`
+	LastAdvance *time.Time `json:"last_advance,omitempty"`
+	ResumeToken string     `json:"resume_token,omitempty"`
+}
+
+// StreamOption allows to configure a stream monitor
+type StreamOption func(m *StreamMonitor)
+
+// PauseState tells whether the stream is paused by its flow control
+type PauseState interface {
+	Paused() bool
+	// LastResumed returns when the stream has been resumed for the last time, zero when it never was
+	LastResumed() time.Time
+}
+
+// WithPauseState tells the monitor whether the stream is paused by its flow control, a paused stream
+// is not stalled even though its cursor is open
+func WithPauseState(state PauseState) StreamOption {
+	return func(m *StreamMonitor) {
+		m.pause = state
+	}
+}
+
+// StreamMonitor follows the state of the change stream, it tells whether the stream is running and
+// whether it is stalled: its cursor is open but its resume token did not advance for too long
+type StreamMonitor struct {
+	stallThreshold time.Duration
+	pause          PauseState
+	now            func() time.Time
+
+	mutex       sync.Mutex
+	started     bool
+	stopped     bool
+	cursorOpen  bool
+	resumeToken bson.Raw
+	lastAdvance time.Time
+}
+
+// NewStreamMonitor returns a change stream monitor, the stream is stalled once its resume token did
+// not advance within the threshold
+func NewStreamMonitor(stallThreshold time.Duration, options ...StreamOption) *StreamMonitor {
+	m := &StreamMonitor{
+		stallThreshold: stallThreshold,
+		now:            time.Now,
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// CursorOpened is called when a cursor starts being read, which counts as a progress
+func (m *StreamMonitor) CursorOpened() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.started = true
+	m.cursorOpen = true
+	m.lastAdvance = m.now()
+}
+
+// CursorClosed is called once a cursor is left, when the stream is paused or is retried
+func (m *StreamMonitor) CursorClosed() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cursorOpen = false
+}
+
+// Advanced is called with the resume token of the cursor, the stream progresses when it changes
+func (m *StreamMonitor) Advanced(resumeToken bson.Raw) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if bytes.Equal(resumeToken, m.resumeToken) {
+		return
+	}
+	m.resumeToken = append(m.resumeToken[:0], resumeToken...)
+	m.lastAdvance = m.now()
+}
+
+// Stopped is called once the stream stopped for good
+func (m *StreamMonitor) Stopped() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.stopped = true
+	m.cursorOpen = false
+}
+
+// Running returns an error when the stream has not started yet or has stopped
+func (m *StreamMonitor) Running(_ context.Context) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	details := m.details()
+	switch {
+	case !m.started:
+		return details, errors.New("change stream not started")
+	case m.stopped:
+		return details, errors.New("change stream stopped")
+	}
+	return details, nil
+}
+
+// Progressing returns an error when the cursor of the stream is open but the stream did not
+// advance within the stall threshold
+func (m *StreamMonitor) Progressing(_ context.Context) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	details := m.details()
+	if m.cursorOpen && !details.Paused {
+		// The stall is measured from the end of the pause
+		since := m.lastAdvance
+		if m.pause != nil && m.pause.LastResumed().After(since) {
+			since = m.pause.LastResumed()
+		}
+		if idle := m.now().Sub(since); idle > m.stallThreshold {
+			return details, fmt.Errorf("change stream stalled: no progress for %s", idle.Truncate(time.Second))
+		}
+	}
+	return details, nil
+}
+
+func (m *StreamMonitor) isPaused() bool {
+	return m.pause != nil && m.pause.Paused()
+}
+
+// Returns the details of the stream, the mutex should be held
+func (m *StreamMonitor) details() StreamDetails {
+	details := StreamDetails{
+		Running:    m.started && !m.stopped,
+		CursorOpen: m.cursorOpen,
+		Paused:     m.isPaused(),
+	}
+	if !m.lastAdvance.IsZero() {
+		lastAdvance := m.lastAdvance
+		details.LastAdvance = &lastAdvance
+	}
+	if len(m.resumeToken) > 0 {
+		details.ResumeToken = m.resumeToken.String()
+	}
+	return details
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStreamMonitor_Running(t *testing.T) {
+	monitor := NewStreamMonitor(time.Minute)
+
+	_, err := monitor.Running(context.Background())
+	assert.EqualError(t, err, "change stream not started")
+
+	monitor.CursorOpened()
+	details, err := monitor.Running(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, details.(StreamDetails).Running)
+	assert.True(t, details.(StreamDetails).CursorOpen)
+
+	// A retried or paused stream keeps running
+	monitor.CursorClosed()
+	_, err = monitor.Running(context.Background())
+	assert.NoError(t, err)
+
+	monitor.Stopped()
+	details, err = monitor.Running(context.Background())
+	assert.EqualError(t, err, "change stream stopped")
+	assert.False(t, details.(StreamDetails).Running)
+}
+
+func TestStreamMonitor_Progressing(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	monitor := NewStreamMonitor(time.Minute)
+	monitor.now = func() time.Time { return now }
+
+	firstToken, _ := bson.Marshal(bson.M{"_data": "first"})
+	secondToken, _ := bson.Marshal(bson.M{"_data": "second"})
+
+	monitor.CursorOpened()
+	monitor.Advanced(firstToken)
+
+	now = now.Add(2 * time.Minute)
+	// The same resume token is no progress
+	monitor.Advanced(firstToken)
+	_, err := monitor.Progressing(context.Background())
+	assert.EqualError(t, err, "change stream stalled: no progress for 2m0s")
+
+	monitor.Advanced(secondToken)
+	details, err := monitor.Progressing(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, now, *details.(StreamDetails).LastAdvance)
+	assert.Equal(t, `{"_data": "second"}`, details.(StreamDetails).ResumeToken)
+
+	// A closed cursor, such as a paused stream, is not stalled
+	monitor.CursorClosed()
+	now = now.Add(time.Hour)
+	_, err = monitor.Progressing(context.Background())
+	assert.NoError(t, err)
+
+	// Reopening the cursor counts as a progress
+	monitor.CursorOpened()
+	_, err = monitor.Progressing(context.Background())
+	assert.NoError(t, err)
+}
+
+// pauseState is a flow control paused until resumed
+type pauseState struct {
+	paused      bool
+	lastResumed time.Time
+}
+
+func (s *pauseState) Paused() bool           { return s.paused }
+func (s *pauseState) LastResumed() time.Time { return s.lastResumed }
+
+func TestStreamMonitor_ProgressingWhenPaused(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pause := &pauseState{paused: true}
+	monitor := NewStreamMonitor(time.Minute, WithPauseState(pause))
+	monitor.now = func() time.Time { return now }
+
+	monitor.CursorOpened()
+	opened := now
+
+	// The cursor stays open while the stream waits for the deliveries
+	now = now.Add(time.Hour)
+	details, err := monitor.Progressing(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, details.(StreamDetails).Paused)
+	assert.Equal(t, opened, *details.(StreamDetails).LastAdvance, "the check does not change the stream state")
+
+	// The stall is measured from the end of the pause, whenever the checks happen
+	pause.paused, pause.lastResumed = false, now.Add(-30*time.Second)
+	_, err = monitor.Progressing(context.Background())
+	assert.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = monitor.Progressing(context.Background())
+	assert.EqualError(t, err, "change stream stalled: no progress for 1m30s")
+}
@@ -18,12 +18,16 @@ func send(w http.ResponseWriter, event string, data interface{}) {
 	fmt.Fprintf(w, "event: %s\ndata: %v\n\n", event, data)
 }
 
+// Number of events buffered for each client, the following ones are dropped until it catches up
+const clientBufferSize = 16
+
 type Debug struct {
 	logger         logger.LoggerInterface
 	debugger       Debugger
 	newClients     chan chan *debug.Event
 	closingClients chan chan *debug.Event
-	clients        map[chan *debug.Event]bool
+	// Number of events dropped for each client
+	clients map[chan *debug.Event]uint64
 }
 
 // NewDebug returns the debug HTTP request handler
@@ -33,7 +37,7 @@ func NewDebug(logger logger.LoggerInterface, debugger Debugger) http.Handler {
 		debugger:       debugger,
 		newClients:     make(chan chan *debug.Event),
 		closingClients: make(chan chan *debug.Event),
-		clients:        make(map[chan *debug.Event]bool),
+		clients:        make(map[chan *debug.Event]uint64),
 	}
 
 	go handler.listen()
@@ -56,7 +60,7 @@ func (h *Debug) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 
 	// Create a new client message channel.
-	messageChan := make(chan *debug.Event)
+	messageChan := make(chan *debug.Event, clientBufferSize)
 
 	// Set the new client message channel as active.
 	h.newClients <- messageChan
@@ -95,15 +99,21 @@ func (h *Debug) listen() {
 		select {
 		case s := <-h.newClients:
 
-			h.clients[s] = true
+			h.clients[s] = 0
 			h.logger.Debug("New client connected", logger.Any("length", len(h.clients)))
 		case s := <-h.closingClients:
 
+			dropped := h.clients[s]
 			delete(h.clients, s)
-			h.logger.Debug("Client disconnected", logger.Any("length", len(h.clients)))
+			h.logger.Debug("Client disconnected", logger.Any("length", len(h.clients)), logger.Any("dropped", dropped))
 		case event := <-h.debugger.Events():
+			// A slow client neither holds the others back nor the debugger
 			for clientMessageChan := range h.clients {
-				clientMessageChan <- event
+				select {
+				case clientMessageChan <- event:
+				default:
+					h.clients[clientMessageChan]++
+				}
 			}
 		}
 	}
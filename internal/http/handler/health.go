@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gol4ng/logger"
+)
+
+// Component states
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check returns the details of a component, with an error when the component is down
+type Check func(ctx context.Context) (interface{}, error)
+
+type componentHealth struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type healthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentHealth `json:"components"`
+}
+
+type Health struct {
+	logger logger.LoggerInterface
+	checks map[string]Check
+}
+
+// NewHealth returns an HTTP request handler running the checks of the components, it answers with
+// the state of each of them and a 503 status when one of them is down
+func NewHealth(logger logger.LoggerInterface, checks map[string]Check) http.Handler {
+	return Health{logger: logger, checks: checks}
+}
+
+// ServeHTTP handles an HTTP request
+func (h Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{Status: StatusUp, Components: make(map[string]componentHealth, len(h.checks))}
+	for name, check := range h.checks {
+		details, err := check(r.Context())
+		if err != nil {
+			response.Status = StatusDown
+			response.Components[name] = componentHealth{Status: StatusDown, Error: err.Error(), Details: details}
+			continue
+		}
+		response.Components[name] = componentHealth{Status: StatusUp, Details: details}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status != StatusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Unable to write health response", logger.Error("error", err))
+	}
+}
@@ -28,21 +28,22 @@ type Server struct {
 	debugger   Debugger
 }
 
-// NewServer returns a technical HTTP server that is used for liveness/readiness
-// and serving Prometheus metrics for instance
+// NewServer returns a technical HTTP server that is used for liveness/readiness, reporting the
+// state of the components checked, and serving Prometheus metrics for instance
 func NewServer(
 	logger logger.LoggerInterface,
 	debugger Debugger,
 	httpTechAddr string,
 	readHeaderTimeout, writeTimeout, idleTimeout time.Duration,
 	pprofEnabled bool,
+	readinessChecks, livenessChecks map[string]handler.Check,
 ) *Server {
 	return &Server{
 		logger:   logger,
 		debugger: debugger,
 		httpServer: &http.Server{
 			Addr:              httpTechAddr,
-			Handler:           getHttpHandler(pprofEnabled, logger, debugger),
+			Handler:           getHttpHandler(pprofEnabled, logger, debugger, readinessChecks, livenessChecks),
 			ReadHeaderTimeout: readHeaderTimeout,
 			WriteTimeout:      writeTimeout,
 			IdleTimeout:       idleTimeout,
@@ -70,13 +71,12 @@ func getHttpHandler(
 	pprofEnabled bool,
 	logger logger.LoggerInterface,
 	debugger Debugger,
+	readinessChecks, livenessChecks map[string]handler.Check,
 ) http.Handler {
-	livenessHandler := handler.NewLiveness(logger)
-
 	router := mux.NewRouter()
 	router.Methods(http.MethodGet).Path("/metrics").Handler(promhttp.Handler())
-	router.Methods(http.MethodGet).Path("/liveness").Handler(livenessHandler)
-	router.Methods(http.MethodGet).Path("/readiness").Handler(livenessHandler)
+	router.Methods(http.MethodGet).Path("/liveness").Handler(handler.NewHealth(logger, livenessChecks))
+	router.Methods(http.MethodGet).Path("/readiness").Handler(handler.NewHealth(logger, readinessChecks))
 
 	if debugger.Enabled() {
 		debugHandler := handler.NewDebug(logger, debugger)
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+)
+
+// Backpressure measures the messages produced and not delivered yet. Once their size reaches the byte
+// budget the stream is paused, until enough of them have been delivered for the size to go back under
+// the resume threshold.
+type Backpressure struct {
+	maxBytes    int64
+	resumeBytes int64
+	logger      logger.LoggerInterface
+
+	mutex    sync.Mutex
+	bytes    int64
+	messages int64
+	// Closed when the stream is resumed, nil while it is flowing
+	resumed chan struct{}
+	// When the stream has been resumed for the last time
+	lastResumed time.Time
+}
+
+// NewBackpressure returns a backpressure pausing the stream when the outstanding messages reach maxBytes,
+// and resuming it once they are under the given ratio of maxBytes
+func NewBackpressure(maxBytes int64, resumeRatio float64, logger logger.LoggerInterface) *Backpressure {
+	if resumeRatio <= 0 || resumeRatio >= 1 {
+		resumeRatio = 0.5
+	}
+
+	return &Backpressure{
+		maxBytes:    maxBytes,
+		resumeBytes: int64(float64(maxBytes) * resumeRatio),
+		logger:      logger,
+	}
+}
+
+// Outstanding returns the size and the number of the messages produced and not delivered yet
+func (b *Backpressure) Outstanding() (int64, int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.bytes, b.messages
+}
+
+// Paused tells whether the stream is paused until outstanding messages are delivered
+func (b *Backpressure) Paused() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.resumed != nil
+}
+
+// LastResumed returns when the stream has been resumed for the last time, zero when it never was
+func (b *Backpressure) LastResumed() time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.lastResumed
+}
+
+// Wait blocks while the stream is paused. It returns false when the stream is still paused once the
+// timeout elapsed, or once the context is done. A zero timeout waits until the stream is resumed.
+func (b *Backpressure) Wait(ctx context.Context, timeout time.Duration) bool {
+	b.mutex.Lock()
+	resumed := b.resumed
+	b.mutex.Unlock()
+
+	if resumed == nil {
+		return true
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-expired:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Wrap counts the message as outstanding until its delivery report is received, it has to be the
+// last middleware so that each produce attempt is counted
+func (b *Backpressure) Wrap(next ProduceFunc) ProduceFunc {
+	return func(ctx context.Context, message *Message) error {
+		size := messageSize(message)
+		b.acquire(size)
+
+		err := next(ctx, message)
+		if err != nil {
+			// The message has not been queued, no delivery report will be received for it
+			b.release(size)
+		}
+		return err
+	}
+}
+
+// Subscriber returns the dispatcher subscriber releasing the delivered messages. It has to be subscribed
+// after the dead letter middleware, messages produced again are only released by their last report.
+func (b *Backpressure) Subscriber() DeliverySubscriber {
+	release := func(report *kafka.Message) {
+		if delivery := DeliveryOf(report); delivery != nil && !delivery.unresolved {
+			b.release(messageSize(delivery.Message))
+		}
+	}
+
+	return DeliverySubscriberFuncs{
+		Delivery: release,
+		DeliveryFailure: func(report *kafka.Message, _ error) {
+			release(report)
+		},
+	}
+}
+
+func (b *Backpressure) acquire(size int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.bytes += size
+	b.messages++
+	if b.resumed == nil && b.bytes >= b.maxBytes {
+		b.resumed = make(chan struct{})
+		b.logger.Warning("Backpressure: Stream paused, outstanding messages reached the byte budget", logger.Int64("bytes", b.bytes), logger.Int64("messages", b.messages))
+	}
+}
+
+func (b *Backpressure) release(size int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.bytes -= size
+	b.messages--
+	if b.resumed != nil && b.bytes <= b.resumeBytes {
+		close(b.resumed)
+		b.resumed = nil
+		b.lastResumed = time.Now()
+		b.logger.Info("Backpressure: Stream resumed", logger.Int64("bytes", b.bytes), logger.Int64("messages", b.messages))
+	}
+}
+
+// Returns the size of the message payload kept in memory until its delivery
+func messageSize(message *Message) int64 {
+	if message == nil {
+		return 0
+	}
+
+	size := len(message.Key) + len(message.Value)
+	for _, header := range message.Headers {
+		size += len(header.Key) + len(header.Value)
+	}
+	return int64(size)
+}
@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func giveDeliveryReport(message *Message, unresolved bool) *kafkaconfluent.Message {
+	return &kafkaconfluent.Message{
+		TopicPartition: kafkaconfluent.TopicPartition{Topic: &message.Topic},
+		Opaque:         &Delivery{Message: message, Attempts: 1, unresolved: unresolved},
+	}
+}
+
+func TestBackpressurePausesAndResumesStream(t *testing.T) {
+	// Given
+	backpressure := NewBackpressure(100, 0.5, logger.NewNopLogger())
+	produce := backpressure.Wrap(func(context.Context, *Message) error { return nil })
+
+	first := &Message{Topic: "my-topic", Value: make([]byte, 60)}
+	second := &Message{Topic: "my-topic", Key: []byte("my-key"), Value: make([]byte, 34)}
+
+	// When - Then
+	assert := assert.New(t)
+	assert.NoError(produce(context.Background(), first))
+	assert.True(backpressure.Wait(context.Background(), time.Millisecond), "the byte budget is not reached")
+
+	assert.NoError(produce(context.Background(), second))
+	assert.False(backpressure.Wait(context.Background(), time.Millisecond), "the byte budget is reached")
+	assert.True(backpressure.Paused())
+	assert.True(backpressure.LastResumed().IsZero())
+
+	bytes, messages := backpressure.Outstanding()
+	assert.Equal(int64(100), bytes)
+	assert.Equal(int64(2), messages)
+
+	// The message produced again is still outstanding
+	backpressure.Subscriber().OnDeliveryFailure(giveDeliveryReport(first, true), errors.New("failure"))
+	assert.False(backpressure.Wait(context.Background(), time.Millisecond))
+
+	resumed := make(chan bool)
+	go func() {
+		resumed <- backpressure.Wait(context.Background(), 0)
+	}()
+	backpressure.Subscriber().OnDelivery(giveDeliveryReport(first, false))
+	assert.True(<-resumed, "the outstanding bytes went under the resume threshold")
+	assert.False(backpressure.Paused())
+	assert.False(backpressure.LastResumed().IsZero())
+
+	bytes, messages = backpressure.Outstanding()
+	assert.Equal(int64(40), bytes)
+	assert.Equal(int64(1), messages)
+}
+
+func TestBackpressureReleasesMessagesThatCannotBeProduced(t *testing.T) {
+	// Given
+	backpressure := NewBackpressure(10, 0.5, logger.NewNopLogger())
+	produce := backpressure.Wrap(func(context.Context, *Message) error { return errors.New("too large") })
+
+	// When
+	err := produce(context.Background(), &Message{Topic: "my-topic", Value: make([]byte, 20)})
+
+	// Then
+	assert := assert.New(t)
+	assert.Error(err)
+	assert.True(backpressure.Wait(context.Background(), time.Millisecond))
+
+	bytes, messages := backpressure.Outstanding()
+	assert.Equal(int64(0), bytes)
+	assert.Equal(int64(0), messages)
+}
+
+func TestBackpressureWaitReturnsWhenContextIsDone(t *testing.T) {
+	// Given
+	backpressure := NewBackpressure(1, 0.5, logger.NewNopLogger())
+	produce := backpressure.Wrap(func(context.Context, *Message) error { return nil })
+	assert.NoError(t, produce(context.Background(), &Message{Topic: "my-topic", Value: []byte("value")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// When - Then
+	assert.False(t, backpressure.Wait(ctx, 0))
+}
@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// CheckpointConsumer is the Kafka consumer used to read the checkpoint topic
+type CheckpointConsumer interface {
+	Assign(partitions []kafka.TopicPartition) error
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+	Poll(timeoutMs int) kafka.Event
+	Unassign() error
+}
+
+// CheckpointReader reads the resume checkpoints stored in a (compacted) Kafka topic, keyed by pipeline name
+type CheckpointReader struct {
+	consumer CheckpointConsumer
+	topic    string
+}
+
+// NewCheckpointReader returns a checkpoint reader. The consumer has to be configured with the
+// "read_committed" isolation level and "enable.partition.eof" so that the end of the topic is known.
+func NewCheckpointReader(consumer CheckpointConsumer, topic string) *CheckpointReader {
+	return &CheckpointReader{
+		consumer: consumer,
+		topic:    topic,
+	}
+}
+
+// Read returns the last committed checkpoint of the given key, nil when there is none
+func (r *CheckpointReader) Read(ctx context.Context, key string) ([]byte, error) {
+	timeoutMs := 10000
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutMs = int(time.Until(deadline).Milliseconds())
+	}
+
+	metadata, err := r.consumer.GetMetadata(&r.topic, false, timeoutMs)
+	if err != nil {
+		return nil, err
+	}
+	topic, ok := metadata.Topics[r.topic]
+	if !ok || topic.Error.Code() == kafka.ErrUnknownTopicOrPart || len(topic.Partitions) == 0 {
+		return nil, nil
+	}
+	if topic.Error.Code() != kafka.ErrNoError {
+		return nil, topic.Error
+	}
+
+	partitions := make([]kafka.TopicPartition, 0, len(topic.Partitions))
+	for _, partition := range topic.Partitions {
+		partitions = append(partitions, kafka.TopicPartition{Topic: &r.topic, Partition: partition.ID, Offset: kafka.OffsetBeginning})
+	}
+	if err := r.consumer.Assign(partitions); err != nil {
+		return nil, err
+	}
+	defer r.consumer.Unassign()
+
+	var checkpoint []byte
+	var remaining = map[int32]struct{}{}
+	for _, partition := range partitions {
+		remaining[partition.Partition] = struct{}{}
+	}
+
+	for len(remaining) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		switch event := r.consumer.Poll(100).(type) {
+		case *kafka.Message:
+			if event.TopicPartition.Error == nil && string(event.Key) == key {
+				// A tombstone removes the checkpoint
+				checkpoint = event.Value
+			}
+		case kafka.PartitionEOF:
+			delete(remaining, event.Partition)
+		case kafka.Error:
+			if event.IsFatal() {
+				return nil, event
+			}
+		}
+	}
+
+	if len(checkpoint) == 0 {
+		return nil, nil
+	}
+	return checkpoint, nil
+}
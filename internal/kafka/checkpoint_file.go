@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ReadCheckpointFile returns the checkpoint stored in the given file, nil when the file does not exist
+func ReadCheckpointFile(file string) ([]byte, error) {
+	checkpoint, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint = bytes.TrimSpace(checkpoint)
+	if len(checkpoint) == 0 {
+		return nil, nil
+	}
+	return checkpoint, nil
+}
+
+// WriteCheckpointFile stores the checkpoint in the given file. The file is replaced atomically so
+// that a crash while writing never leaves a truncated checkpoint.
+func WriteCheckpointFile(file string, checkpoint []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(checkpoint); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), file)
+}
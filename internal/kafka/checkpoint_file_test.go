@@ -0,0 +1,31 @@
+package kafka
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointFile(t *testing.T) {
+	// Given
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// When
+	missing, err := ReadCheckpointFile(file)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	assert.NoError(t, WriteCheckpointFile(file, []byte(`{"_data":"1"}`)))
+	assert.NoError(t, WriteCheckpointFile(file, []byte(`{"_data":"2"}`)))
+
+	// Then
+	checkpoint, err := ReadCheckpointFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"_data":"2"}`), checkpoint)
+
+	entries, err := os.ReadDir(filepath.Dir(file))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left")
+}
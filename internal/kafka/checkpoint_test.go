@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCheckpointMockCluster(t *testing.T) *kafkaconfluent.MockCluster {
+	cluster, err := kafkaconfluent.NewMockCluster(1)
+	if err != nil {
+		t.Fatalf("unable to create the mock cluster: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+
+	for _, topic := range []string{"items", "checkpoints"} {
+		if err := cluster.CreateTopic(topic, 2, 1); err != nil {
+			t.Fatalf("unable to create the %q topic: %v", topic, err)
+		}
+	}
+	return cluster
+}
+
+func newCheckpointConsumer(t *testing.T, cluster *kafkaconfluent.MockCluster) *kafkaconfluent.Consumer {
+	consumer, err := kafkaconfluent.NewConsumer(&kafkaconfluent.ConfigMap{
+		"bootstrap.servers":    cluster.BootstrapServers(),
+		"group.id":             "checkpoint-reader",
+		"isolation.level":      "read_committed",
+		"enable.partition.eof": true,
+		"enable.auto.commit":   false,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the consumer: %v", err)
+	}
+	t.Cleanup(func() { consumer.Close() })
+	return consumer
+}
+
+func TestCheckpointReaderReadWhenTopicIsEmpty(t *testing.T) {
+	// Given
+	cluster := newCheckpointMockCluster(t)
+	reader := NewCheckpointReader(newCheckpointConsumer(t, cluster), "checkpoints")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// When
+	checkpoint, err := reader.Read(ctx, "watcher.items")
+
+	// Then
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+}
+
+func TestTransactionalClientCommitsCheckpoint(t *testing.T) {
+	// Given
+	cluster := newCheckpointMockCluster(t)
+
+	producer, err := kafkaconfluent.NewProducer(&kafkaconfluent.ConfigMap{
+		"bootstrap.servers": cluster.BootstrapServers(),
+		"transactional.id":  "watcher-test",
+	})
+	if err != nil {
+		t.Fatalf("unable to create the producer: %v", err)
+	}
+	go func() {
+		for range producer.Events() {
+		}
+	}()
+
+	messages := make(chan *Message, 3)
+	messages <- &Message{Topic: "items", Key: []byte("1"), Value: []byte("a"), Checkpoint: []byte(`{"_data":"1"}`)}
+	messages <- &Message{Topic: "items", Key: []byte("2"), Value: []byte("b"), Checkpoint: []byte(`{"_data":"2"}`)}
+	messages <- &Message{Topic: "items", Key: []byte("3"), Value: []byte("c")}
+	close(messages)
+
+	client := NewTransactionalClient(producer, logger.NewNopLogger(), WithCheckpointTopic("checkpoints", "watcher.items"), WithTransactionOperationTimeout(10*time.Second))
+
+	// When
+	ProduceAll(context.Background(), client, messages, logger.NewNopLogger())
+
+	// Then
+	reader := NewCheckpointReader(newCheckpointConsumer(t, cluster), "checkpoints")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	checkpoint, err := reader.Read(ctx, "watcher.items")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"_data":"2"}`), checkpoint)
+
+	other, err := reader.Read(ctx, "other.pipeline")
+	assert.Nil(t, err)
+	assert.Nil(t, other)
+}
@@ -0,0 +1,126 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// CheckpointTracker follows the delivery reports to know the checkpoint of the latest message whose
+// preceding messages have all been delivered, or skipped by the delivery failure policy.
+// Messages that are retried or that halted the stream hold the checkpoint back.
+type CheckpointTracker struct {
+	mutex sync.Mutex
+	// Sequence of the oldest message that is not acknowledged yet
+	next uint64
+	// Acknowledged messages following a message that is not, by sequence
+	acknowledged map[uint64]*Message
+	checkpoint   []byte
+
+	// Sequence of the last message produced by the tracked client
+	produced uint64
+	// Checkpoints of the change events without message, by sequence of the message produced before them
+	marks map[uint64][]byte
+}
+
+// NewCheckpointTracker returns a checkpoint tracker, to be subscribed to the dispatcher after the
+// dead letter client
+func NewCheckpointTracker() *CheckpointTracker {
+	return &CheckpointTracker{
+		next:         1,
+		acknowledged: map[uint64]*Message{},
+		marks:        map[uint64][]byte{},
+	}
+}
+
+// Checkpoint returns the latest safe checkpoint, nil when there is none yet
+func (t *CheckpointTracker) Checkpoint() []byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.checkpoint
+}
+
+// Subscriber returns the dispatcher subscriber acknowledging the messages
+func (t *CheckpointTracker) Subscriber() DeliverySubscriber {
+	return DeliverySubscriberFuncs{
+		Delivery: func(report *kafka.Message) {
+			t.acknowledge(DeliveryOf(report))
+		},
+		DeliveryFailure: func(report *kafka.Message, _ error) {
+			if delivery := DeliveryOf(report); delivery != nil && !delivery.unresolved {
+				t.acknowledge(delivery)
+			}
+		},
+	}
+}
+
+// Client returns the given client, counting the messages it produced so that the checkpoint markers
+// are acknowledged once the messages produced before them are. It has to be the client numbering the
+// delivered sequence.
+func (t *CheckpointTracker) Client(client Client) Client {
+	return &trackedClient{Client: client, tracker: t}
+}
+
+type trackedClient struct {
+	Client
+	tracker *CheckpointTracker
+}
+
+// Produce counts the produced messages, those that cannot be produced are not part of the sequence
+func (c *trackedClient) Produce(ctx context.Context, message *Message) error {
+	err := c.Client.Produce(ctx, message)
+	if err == nil {
+		c.tracker.mutex.Lock()
+		c.tracker.produced++
+		c.tracker.mutex.Unlock()
+	}
+	return err
+}
+
+// MarkCheckpoint acknowledges the checkpoint once the messages produced so far are
+func (c *trackedClient) MarkCheckpoint(checkpoint []byte) {
+	c.tracker.mark(checkpoint)
+}
+
+func (t *CheckpointTracker) mark(checkpoint []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.next > t.produced {
+		t.checkpoint = checkpoint
+		return
+	}
+	t.marks[t.produced] = checkpoint
+}
+
+func (t *CheckpointTracker) acknowledge(delivery *Delivery) {
+	if delivery == nil || delivery.Message == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if delivery.Sequence < t.next {
+		return
+	}
+
+	t.acknowledged[delivery.Sequence] = delivery.Message
+	for {
+		message, ok := t.acknowledged[t.next]
+		if !ok {
+			return
+		}
+		if message.Checkpoint != nil {
+			t.checkpoint = message.Checkpoint
+		}
+		if checkpoint, ok := t.marks[t.next]; ok {
+			t.checkpoint = checkpoint
+			delete(t.marks, t.next)
+		}
+		delete(t.acknowledged, t.next)
+		t.next++
+	}
+}
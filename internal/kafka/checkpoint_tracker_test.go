@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func giveTrackedReport(sequence uint64, checkpoint string) *kafkaconfluent.Message {
+	message := &Message{Topic: "my-topic"}
+	if checkpoint != "" {
+		message.Checkpoint = []byte(checkpoint)
+	}
+	return &kafkaconfluent.Message{Opaque: &Delivery{Message: message, Attempts: 1, Sequence: sequence}}
+}
+
+func TestCheckpointTrackerWaitsForPrecedingMessages(t *testing.T) {
+	// Given
+	tracker := NewCheckpointTracker()
+	subscriber := tracker.Subscriber()
+
+	assert := assert.New(t)
+
+	// When - Then
+	subscriber.OnDelivery(giveTrackedReport(2, "token-2"))
+	assert.Nil(tracker.Checkpoint(), "the first message is not delivered yet")
+
+	subscriber.OnDelivery(giveTrackedReport(1, "token-1"))
+	assert.Equal([]byte("token-2"), tracker.Checkpoint())
+
+	// A message without checkpoint keeps the previous one
+	subscriber.OnDelivery(giveTrackedReport(3, ""))
+	assert.Equal([]byte("token-2"), tracker.Checkpoint())
+}
+
+func TestCheckpointTrackerWithFailedDeliveries(t *testing.T) {
+	// Given
+	tracker := NewCheckpointTracker()
+	subscriber := tracker.Subscriber()
+
+	retried := giveTrackedReport(2, "token-2")
+	DeliveryOf(retried).unresolved = true
+
+	assert := assert.New(t)
+
+	// When - Then
+	subscriber.OnDeliveryFailure(giveTrackedReport(1, "token-1"), errors.New("skipped"))
+	assert.Equal([]byte("token-1"), tracker.Checkpoint(), "skipped messages are acknowledged")
+
+	subscriber.OnDeliveryFailure(retried, errors.New("retried"))
+	subscriber.OnDelivery(giveTrackedReport(3, "token-3"))
+	assert.Equal([]byte("token-1"), tracker.Checkpoint(), "the retried message holds the checkpoint back")
+
+	subscriber.OnDelivery(giveTrackedReport(2, "token-2"))
+	assert.Equal([]byte("token-3"), tracker.Checkpoint())
+}
+
+func TestCheckpointTrackerAcknowledgesMarkedCheckpoints(t *testing.T) {
+	// Given
+	tracker := NewCheckpointTracker()
+	subscriber := tracker.Subscriber()
+
+	produced := make(chan *Message, 2)
+	client := tracker.Client(&producingClient{produced: produced})
+	marker := client.(CheckpointMarker)
+
+	assert := assert.New(t)
+
+	// When - Then
+	marker.MarkCheckpoint([]byte("token-1"))
+	assert.Equal([]byte("token-1"), tracker.Checkpoint(), "no message is waiting to be delivered")
+
+	assert.NoError(client.Produce(context.Background(), &Message{Topic: "my-topic"}))
+	assert.NoError(client.Produce(context.Background(), &Message{Topic: "my-topic"}))
+	marker.MarkCheckpoint([]byte("token-4"))
+	assert.Equal([]byte("token-1"), tracker.Checkpoint(), "the produced messages are not delivered yet")
+
+	subscriber.OnDelivery(giveTrackedReport(1, "token-2"))
+	assert.Equal([]byte("token-2"), tracker.Checkpoint())
+
+	subscriber.OnDelivery(giveTrackedReport(2, "token-3"))
+	assert.Equal([]byte("token-4"), tracker.Checkpoint(), "the marked checkpoint follows the last produced message")
+}
+
+// producingClient accepts all the messages
+type producingClient struct {
+	produced chan *Message
+}
+
+func (c *producingClient) Produce(_ context.Context, message *Message) error {
+	c.produced <- message
+	return nil
+}
+
+func (c *producingClient) Events() chan kafkaconfluent.Event { return nil }
+
+func (c *producingClient) Close() error { return nil }
@@ -1,38 +1,96 @@
 package kafka
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 )
 
+// ErrUndelivered is returned, wrapped, when a client is closed while messages are still waiting to be delivered
+var ErrUndelivered = errors.New("messages left undelivered")
+
 type Client interface {
-	Produce(messages chan *Message)
+	Produce(ctx context.Context, message *Message) error
 	Events() chan kafka.Event
-	Close()
+	Close() error
 }
 
 type client struct {
-	producer KafkaProducer
+	producer     KafkaProducer
+	partitions   *PartitionCounter
+	sequence     uint64
+	flushTimeout time.Duration
+}
+
+// ClientOption allows to customize the client behavior
+type ClientOption func(*client)
+
+// WithFlushTimeout allows to specify the maximum duration the client waits for the queued messages
+// to be delivered when it is closed
+func WithFlushTimeout(timeout time.Duration) ClientOption {
+	return func(c *client) {
+		if timeout > 0 {
+			c.flushTimeout = timeout
+		}
+	}
+}
+
+// WithPartitionCounter allows to compute the partition of the messages with a partition key, from the
+// number of partitions of their topic
+func WithPartitionCounter(counter *PartitionCounter) ClientOption {
+	return func(c *client) {
+		c.partitions = counter
+	}
 }
 
 // NewClient returns a basic kafka client
-func NewClient(producer KafkaProducer) *client {
-	return &client{
-		producer: producer,
+func NewClient(producer KafkaProducer, options ...ClientOption) *client {
+	client := &client{
+		producer:     producer,
+		flushTimeout: 30 * time.Second,
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// Produce sends the message using the producer, waiting for room in its local queue when it is full.
+// The Kafka message carries its Delivery as opaque, a message that cannot be produced is not part of
+// the delivered sequence and its error is returned.
+func (c *client) Produce(_ context.Context, message *Message) error {
+	partition, err := messagePartition(message, c.partitions)
+	if err != nil {
+		return err
+	}
+	kafkaMessage := buildMessage(message, partition)
+	kafkaMessage.Opaque = &Delivery{Message: message, Attempts: 1, Sequence: c.sequence + 1}
+
+	if err := produceBlocking(c.producer, kafkaMessage, queueFullWait); err != nil {
+		return err
 	}
+	c.sequence++
+
+	return nil
 }
 
-// Produce sends a message using the producer
-func (c *client) Produce(messages chan *Message) {
-	defer c.Close()
+func buildMessage(message *Message, partition int32) *kafka.Message {
+	kafkaMessage := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &message.Topic, Partition: partition},
+		Key:            message.Key,
+		Value:          message.Value,
+		Headers:        buildHeaders(message.Headers),
+	}
 
-	for message := range messages {
-		c.producer.ProduceChannel() <- &kafka.Message{
-			TopicPartition: kafka.TopicPartition{Topic: &message.Topic, Partition: kafka.PartitionAny},
-			Key:            message.Key,
-			Value:          message.Value,
-			Headers:        buildHeaders(message.Headers),
-		}
+	if !message.Timestamp.IsZero() {
+		kafkaMessage.Timestamp = message.Timestamp
+		kafkaMessage.TimestampType = kafka.TimestampCreateTime
 	}
+
+	return kafkaMessage
 }
 
 func buildHeaders(headers []Header) []kafka.Header {
@@ -53,11 +111,14 @@ func (c *client) Events() chan kafka.Event {
 	return c.producer.Events()
 }
 
-// Close allows to close/disconnect the kafka client
-func (c *client) Close() {
-	for wait := true; wait; wait = c.producer.Len() > 0 {
-		// Wait for all events to be retrieved from Kafka library
-	}
-
+// Close waits for the queued messages to be delivered, during the flush timeout at most, and then
+// closes/disconnects the kafka client. An ErrUndelivered error is returned when messages remain.
+func (c *client) Close() error {
+	remaining := c.producer.Flush(int(c.flushTimeout.Milliseconds()))
 	c.producer.Close()
+
+	if remaining > 0 {
+		return fmt.Errorf("%w: %d messages still queued after %s", ErrUndelivered, remaining, c.flushTimeout)
+	}
+	return nil
 }
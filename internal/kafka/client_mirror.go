@@ -0,0 +1,329 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+)
+
+// MirrorConfig is the configuration of a Kafka cluster the messages are mirrored to
+type MirrorConfig struct {
+	Name string `json:"name"`
+	// Producer configuration properties, such as "bootstrap.servers"
+	Config map[string]interface{} `json:"config"`
+	// Destination topics by source topic, the source topic is kept when it is not mapped
+	Topics map[string]string `json:"topics"`
+	// The messages are acknowledged without waiting for their delivery to the cluster
+	BestEffort bool `json:"best_effort"`
+}
+
+// ParseMirrorConfigs decodes a JSON array of mirror configurations
+func ParseMirrorConfigs(configs string) ([]*MirrorConfig, error) {
+	var mirrorConfigs []*MirrorConfig
+	if configs == "" {
+		return mirrorConfigs, nil
+	}
+
+	if err := json.Unmarshal([]byte(configs), &mirrorConfigs); err != nil {
+		return nil, err
+	}
+
+	for index, config := range mirrorConfigs {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("mirror-%d", index)
+		}
+		if _, ok := config.Config["bootstrap.servers"]; !ok {
+			return nil, fmt.Errorf("mirror %q should define the \"bootstrap.servers\" config property", config.Name)
+		}
+	}
+
+	return mirrorConfigs, nil
+}
+
+// ConfigMap returns the producer configuration of the mirror, applied over the given base configuration
+func (m *MirrorConfig) ConfigMap(base kafka.ConfigMap) (*kafka.ConfigMap, error) {
+	configMap := kafka.ConfigMap{}
+	for key, value := range base {
+		configMap[key] = value
+	}
+
+	for key, value := range m.Config {
+		switch typed := value.(type) {
+		case string, bool:
+			configMap[key] = typed
+		case float64:
+			// JSON numbers are decoded as floats, the producer only accepts integers
+			if typed == math.Trunc(typed) {
+				configMap[key] = int(typed)
+			} else {
+				configMap[key] = strconv.FormatFloat(typed, 'f', -1, 64)
+			}
+		default:
+			return nil, fmt.Errorf("mirror %q has an invalid %q config property value: %v", m.Name, key, value)
+		}
+	}
+
+	return &configMap, nil
+}
+
+// MirrorDestination is a client the messages are mirrored to
+type MirrorDestination struct {
+	Name   string
+	Client Client
+	// Destination topics by source topic, the source topic is kept when it is not mapped
+	Topics map[string]string
+	// The messages are acknowledged without waiting for their delivery to the destination
+	BestEffort bool
+}
+
+// Returns the message to produce to the destination
+func (d *MirrorDestination) message(message *Message) *Message {
+	mirrored := *message
+	if topic, ok := d.Topics[message.Topic]; ok {
+		mirrored.Topic = topic
+	}
+	return &mirrored
+}
+
+// A message mirrored to the destinations, acknowledged once all the required destinations reported
+// its delivery
+type mirroredMessage struct {
+	delivery  *Delivery
+	remaining int
+	// First delivery error of a required destination
+	err error
+	// The message could not be produced to a required destination, it is not part of the delivered sequence
+	abandoned bool
+}
+
+type mirrorClient struct {
+	destinations []*MirrorDestination
+	dispatchers  map[string]*Dispatcher
+	required     int
+	logger       logger.LoggerInterface
+
+	halt func(error)
+
+	events chan kafka.Event
+
+	mutex    sync.Mutex
+	sequence uint64
+	// Mirrored messages by the message produced to each destination
+	pending map[*Message]*mirroredMessage
+	// Set once a required destination failed to deliver a message, the following messages are not
+	// produced anymore
+	err error
+}
+
+// MirrorOption allows to customize the mirror client
+type MirrorOption func(*mirrorClient)
+
+// WithMirrorHaltFunc allows to specify how the stream is stopped when a required destination failed
+// to deliver a message
+func WithMirrorHaltFunc(halt func(error)) MirrorOption {
+	return func(c *mirrorClient) {
+		c.halt = halt
+	}
+}
+
+// NewMirrorClient returns a client producing the messages to all the destinations. The delivery report
+// of a message is sent once all the destinations that are not best effort reported its delivery. When
+// one of them failed, the report is unresolved and the stream halted, so that no later checkpoint is
+// delivered.
+func NewMirrorClient(destinations []*MirrorDestination, logger logger.LoggerInterface, options ...MirrorOption) (*mirrorClient, error) {
+	client := &mirrorClient{
+		destinations: destinations,
+		dispatchers:  make(map[string]*Dispatcher, len(destinations)),
+		logger:       logger,
+		halt:         func(error) {},
+		events:       make(chan kafka.Event, 1000),
+		pending:      make(map[*Message]*mirroredMessage),
+	}
+	for _, option := range options {
+		option(client)
+	}
+
+	for _, destination := range destinations {
+		if _, ok := client.dispatchers[destination.Name]; ok {
+			return nil, fmt.Errorf("mirror destination %q is defined twice", destination.Name)
+		}
+		if !destination.BestEffort {
+			client.required++
+		}
+
+		// Each destination has its own delivery tracking, fed by its own dispatcher
+		dispatcher := NewDispatcher(destination.Client.Events())
+		dispatcher.Subscribe(client.subscriber(destination))
+		client.dispatchers[destination.Name] = dispatcher
+	}
+	if client.required == 0 {
+		return nil, errors.New("at least one mirror destination should not be best effort")
+	}
+
+	for _, dispatcher := range client.dispatchers {
+		go dispatcher.Run()
+	}
+
+	return client, nil
+}
+
+// Dispatcher returns the dispatcher of the events of the named destination, nil when there is none
+func (c *mirrorClient) Dispatcher(name string) *Dispatcher {
+	return c.dispatchers[name]
+}
+
+// Produce sends the message to all the destinations. A message that cannot be produced to a required
+// destination is not part of the delivered sequence and halts the stream, it may have been sent to the
+// other destinations though. Once the stream is halted, the messages are not produced anymore.
+func (c *mirrorClient) Produce(ctx context.Context, message *Message) error {
+	c.mutex.Lock()
+	err := c.err
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	mirrored := &mirroredMessage{
+		delivery:  &Delivery{Message: message, Attempts: 1, Sequence: c.sequence + 1},
+		remaining: c.required,
+	}
+
+	// Registered first, the delivery reports can be received before all the destinations are produced to
+	messages := make([]*Message, len(c.destinations))
+	c.mutex.Lock()
+	for index, destination := range c.destinations {
+		messages[index] = destination.message(message)
+		c.pending[messages[index]] = mirrored
+	}
+	c.mutex.Unlock()
+
+	var errs []error
+	for index, destination := range c.destinations {
+		err := destination.Client.Produce(ctx, messages[index])
+		if err == nil {
+			continue
+		}
+
+		c.logger.Error("Mirror: Unable to produce message", logger.String("destination", destination.Name), logger.Bool("best_effort", destination.BestEffort), logger.Error("error", err))
+		c.mutex.Lock()
+		delete(c.pending, messages[index])
+		if !destination.BestEffort {
+			mirrored.abandoned = true
+			mirrored.remaining--
+			errs = append(errs, fmt.Errorf("mirror destination %q: %w", destination.Name, err))
+		}
+		c.mutex.Unlock()
+	}
+	if len(errs) > 0 {
+		// The message is missing from a required destination, no later message can be delivered
+		err := errors.Join(errs...)
+		c.mutex.Lock()
+		haltErr := c.stopLocked(err)
+		c.mutex.Unlock()
+		if haltErr != nil {
+			c.logger.Error("Mirror: Halting the stream", logger.Error("error", err))
+			c.halt(haltErr)
+		}
+		return fmt.Errorf("%w: %w", ErrStreamHalted, err)
+	}
+
+	c.sequence++
+	return nil
+}
+
+// Halts the stream once, the mutex being locked. It returns the halt error when the stream has just
+// been halted, nil when it already was.
+func (c *mirrorClient) stopLocked(err error) error {
+	if c.err != nil {
+		return nil
+	}
+	c.err = fmt.Errorf("%w: %w", ErrStreamHalted, err)
+	return c.err
+}
+
+func (c *mirrorClient) subscriber(destination *MirrorDestination) DeliverySubscriber {
+	return DeliverySubscriberFuncs{
+		Delivery: func(report *kafka.Message) {
+			c.acknowledge(destination, report, nil)
+		},
+		DeliveryFailure: func(report *kafka.Message, err error) {
+			c.acknowledge(destination, report, err)
+		},
+		Error: func(err kafka.Error) {
+			c.logger.Error("Mirror: Destination error", logger.String("destination", destination.Name), logger.Error("error", err))
+		},
+	}
+}
+
+func (c *mirrorClient) acknowledge(destination *MirrorDestination, report *kafka.Message, err error) {
+	delivery := DeliveryOf(report)
+	if delivery == nil {
+		return
+	}
+	if err != nil {
+		c.logger.Error("Mirror: Message not delivered", logger.String("destination", destination.Name), logger.Bool("best_effort", destination.BestEffort), logger.Error("error", err))
+	}
+
+	c.mutex.Lock()
+	mirrored, ok := c.pending[delivery.Message]
+	delete(c.pending, delivery.Message)
+	if !ok || destination.BestEffort {
+		c.mutex.Unlock()
+		return
+	}
+
+	if err != nil && mirrored.err == nil {
+		mirrored.err = fmt.Errorf("mirror destination %q: %w", destination.Name, err)
+	}
+	mirrored.remaining--
+	acknowledged := mirrored.remaining == 0 && !mirrored.abandoned
+	var haltErr error
+	if acknowledged && mirrored.err != nil {
+		// The message is missing from a required destination, the checkpoint cannot move past it
+		mirrored.delivery.unresolved = true
+		haltErr = c.stopLocked(mirrored.err)
+	}
+	c.mutex.Unlock()
+
+	if haltErr != nil {
+		c.logger.Error("Mirror: Halting the stream", logger.String("destination", destination.Name), logger.Error("error", mirrored.err))
+		c.halt(haltErr)
+	}
+	if acknowledged {
+		message := mirrored.delivery.Message
+		c.events <- &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &message.Topic, Partition: kafka.PartitionAny, Error: mirrored.err},
+			Key:            message.Key,
+			Value:          message.Value,
+			Opaque:         mirrored.delivery,
+		}
+	}
+}
+
+// Events returns the delivery reports of the mirrored messages
+func (c *mirrorClient) Events() chan kafka.Event {
+	return c.events
+}
+
+// Close closes the destinations, waiting for their last delivery reports
+func (c *mirrorClient) Close() error {
+	var errs []error
+	for _, destination := range c.destinations {
+		if err := destination.Client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("mirror destination %q: %w", destination.Name, err))
+		}
+	}
+	for _, dispatcher := range c.dispatchers {
+		<-dispatcher.Done()
+	}
+	close(c.events)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,223 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// destinationClient records the produced messages, their delivery is reported by the test
+type destinationClient struct {
+	events   chan kafkaconfluent.Event
+	produced chan *Message
+	err      error
+}
+
+func newDestinationClient() *destinationClient {
+	return &destinationClient{
+		events:   make(chan kafkaconfluent.Event, 10),
+		produced: make(chan *Message, 10),
+	}
+}
+
+func (c *destinationClient) Produce(_ context.Context, message *Message) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.produced <- message
+	return nil
+}
+
+func (c *destinationClient) Events() chan kafkaconfluent.Event { return c.events }
+
+func (c *destinationClient) Close() error {
+	close(c.events)
+	return nil
+}
+
+// Reports the delivery of the oldest produced message, and returns it
+func (c *destinationClient) report(err error) *Message {
+	message := <-c.produced
+	c.events <- &kafkaconfluent.Message{
+		TopicPartition: kafkaconfluent.TopicPartition{Topic: &message.Topic, Error: err},
+		Opaque:         &Delivery{Message: message, Attempts: 1},
+	}
+	return message
+}
+
+func receiveReport(t *testing.T, client Client) *kafkaconfluent.Message {
+	select {
+	case event := <-client.Events():
+		return event.(*kafkaconfluent.Message)
+	case <-time.After(time.Second):
+		t.Fatal("no delivery report received")
+		return nil
+	}
+}
+
+func assertNoReport(t *testing.T, client Client) {
+	select {
+	case event := <-client.Events():
+		t.Fatalf("unexpected delivery report %v", event)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestParseMirrorConfigs(t *testing.T) {
+	assert := assert.New(t)
+
+	configs, err := ParseMirrorConfigs(`[
+		{"name": "dc1", "config": {"bootstrap.servers": "dc1:9092", "linger.ms": 5, "enable.idempotence": true}},
+		{"config": {"bootstrap.servers": "dc2:9092"}, "topics": {"items": "dc2-items"}, "best_effort": true}
+	]`)
+	assert.NoError(err)
+	if assert.Len(configs, 2) {
+		assert.Equal("dc1", configs[0].Name)
+		assert.Equal("mirror-1", configs[1].Name)
+		assert.Equal(map[string]string{"items": "dc2-items"}, configs[1].Topics)
+		assert.True(configs[1].BestEffort)
+
+		configMap, err := configs[0].ConfigMap(kafkaconfluent.ConfigMap{"message.max.bytes": 1024, "linger.ms": 100})
+		assert.NoError(err)
+		assert.Equal(&kafkaconfluent.ConfigMap{
+			"bootstrap.servers":  "dc1:9092",
+			"linger.ms":          5,
+			"enable.idempotence": true,
+			"message.max.bytes":  1024,
+		}, configMap)
+	}
+
+	_, err = ParseMirrorConfigs(`[{"name": "dc1", "config": {}}]`)
+	assert.EqualError(err, `mirror "dc1" should define the "bootstrap.servers" config property`)
+
+	configs, err = ParseMirrorConfigs("")
+	assert.NoError(err)
+	assert.Empty(configs)
+}
+
+func TestNewMirrorClientValidatesDestinations(t *testing.T) {
+	_, err := NewMirrorClient([]*MirrorDestination{
+		{Name: "dc1", Client: newDestinationClient(), BestEffort: true},
+	}, logger.NewNopLogger())
+	assert.EqualError(t, err, "at least one mirror destination should not be best effort")
+
+	_, err = NewMirrorClient([]*MirrorDestination{
+		{Name: "dc1", Client: newDestinationClient()},
+		{Name: "dc1", Client: newDestinationClient()},
+	}, logger.NewNopLogger())
+	assert.EqualError(t, err, `mirror destination "dc1" is defined twice`)
+}
+
+func TestMirrorClientAcknowledgesOnceRequiredDestinationsDelivered(t *testing.T) {
+	// Given
+	dc1, dc2, dc3 := newDestinationClient(), newDestinationClient(), newDestinationClient()
+	client, err := NewMirrorClient([]*MirrorDestination{
+		{Name: "dc1", Client: dc1},
+		{Name: "dc2", Client: dc2, Topics: map[string]string{"items": "dc2-items"}},
+		{Name: "dc3", Client: dc3, BestEffort: true},
+	}, logger.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := &Message{Topic: "items", Key: []byte("key"), Value: []byte("value")}
+
+	// When - Then
+	assert := assert.New(t)
+	assert.NoError(client.Produce(context.Background(), message))
+
+	dc1.report(nil)
+	assertNoReport(t, client)
+
+	dc3.report(errors.New("dc3 is down"))
+	assertNoReport(t, client)
+
+	// Reports of messages that are not mirrored are ignored
+	dc2.events <- &kafkaconfluent.Message{Opaque: &Delivery{Message: &Message{Topic: "unknown"}}}
+	assertNoReport(t, client)
+
+	assert.Equal("dc2-items", dc2.report(nil).Topic)
+	report := receiveReport(t, client)
+	assert.NoError(report.TopicPartition.Error)
+	assert.Equal(&Delivery{Message: message, Attempts: 1, Sequence: 1}, DeliveryOf(report))
+
+	assert.NoError(client.Close())
+	_, ok := <-client.Events()
+	assert.False(ok)
+}
+
+func TestMirrorClientHaltsWhenRequiredDestinationFailed(t *testing.T) {
+	// Given
+	var halted error
+	dc1, dc2 := newDestinationClient(), newDestinationClient()
+	client, err := NewMirrorClient([]*MirrorDestination{
+		{Name: "dc1", Client: dc1},
+		{Name: "dc2", Client: dc2},
+	}, logger.NewNopLogger(), WithMirrorHaltFunc(func(err error) {
+		halted = err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// When
+	assert := assert.New(t)
+	assert.NoError(client.Produce(context.Background(), &Message{Topic: "items"}))
+	dc1.report(errors.New("dc1 is down"))
+	dc2.report(nil)
+
+	// Then
+	report := receiveReport(t, client)
+	assert.EqualError(report.TopicPartition.Error, `mirror destination "dc1": dc1 is down`)
+	assert.True(DeliveryOf(report).unresolved, "the checkpoint does not advance past the failed message")
+
+	assert.ErrorIs(halted, ErrStreamHalted)
+	err = client.Produce(context.Background(), &Message{Topic: "items"})
+	assert.ErrorIs(err, ErrStreamHalted)
+	assert.ErrorContains(err, "dc1 is down")
+	assert.Len(dc1.produced, 0, "no message is produced after the failed one")
+}
+
+func TestMirrorClientHaltsWhenRequiredDestinationProduceFailed(t *testing.T) {
+	// Given
+	var halted error
+	dc1, dc2 := newDestinationClient(), newDestinationClient()
+	client, err := NewMirrorClient([]*MirrorDestination{
+		{Name: "dc1", Client: dc1},
+		{Name: "dc2", Client: dc2, BestEffort: true},
+	}, logger.NewNopLogger(), WithMirrorHaltFunc(func(err error) {
+		halted = err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// When - Then
+	assert := assert.New(t)
+
+	dc2.err = errors.New("dc2 queue is full")
+	assert.NoError(client.Produce(context.Background(), &Message{Topic: "items", Value: []byte("first")}), "best effort errors are ignored")
+	dc1.report(nil)
+	assert.Equal(uint64(1), DeliveryOf(receiveReport(t, client)).Sequence)
+	assert.Nil(halted)
+
+	dc1.err = errors.New("dc1 queue is full")
+	dc2.err = nil
+	err = client.Produce(context.Background(), &Message{Topic: "items", Value: []byte("second")})
+	assert.ErrorIs(err, ErrStreamHalted)
+	assert.ErrorContains(err, `mirror destination "dc1": dc1 queue is full`)
+	assert.ErrorIs(halted, ErrStreamHalted, "the message missing from a required destination halts the stream")
+	dc2.report(nil)
+	assertNoReport(t, client)
+
+	dc1.err = nil
+	assert.ErrorIs(client.Produce(context.Background(), &Message{Topic: "items", Value: []byte("third")}), ErrStreamHalted)
+	assert.Len(dc1.produced, 0, "no message is produced after the failed one")
+}
@@ -5,6 +5,7 @@
 package kafka
 
 import (
+	context "context"
 	reflect "reflect"
 
 	kafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -35,9 +36,11 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 }
 
 // Close mocks base method.
-func (m *MockClient) Close() {
+func (m *MockClient) Close() error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Close")
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Close indicates an expected call of Close.
@@ -61,13 +64,15 @@ func (mr *MockClientMockRecorder) Events() *gomock.Call {
 }
 
 // Produce mocks base method.
-func (m *MockClient) Produce(messages chan *Message) {
+func (m *MockClient) Produce(ctx context.Context, message *Message) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Produce", messages)
+	ret := m.ctrl.Call(m, "Produce", ctx, message)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Produce indicates an expected call of Produce.
-func (mr *MockClientMockRecorder) Produce(messages interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Produce(ctx, message interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Produce", reflect.TypeOf((*MockClient)(nil).Produce), messages)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Produce", reflect.TypeOf((*MockClient)(nil).Produce), ctx, message)
 }
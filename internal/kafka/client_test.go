@@ -1,7 +1,9 @@
 package kafka
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/golang/mock/gomock"
@@ -28,35 +30,29 @@ func TestClientProduce(t *testing.T) {
 	defer ctrl.Finish()
 
 	// Given
-	produceChannel := make(chan *kafkaconfluent.Message, 1)
-
-	messages := make(chan *Message)
-	go func() {
-		defer close(messages)
-		messages <- &Message{
-			Topic: "test-topic",
-			Key:   []byte(`my-key`),
-			Value: []byte(`my-value`),
-			Headers: []Header{
-				Header{Key: "x-test-header", Value: []byte("test")},
-			},
-		}
-	}()
-
+	message := &Message{
+		Topic: "test-topic",
+		Key:   []byte(`my-key`),
+		Value: []byte(`my-value`),
+		Headers: []Header{
+			Header{Key: "x-test-header", Value: []byte("test")},
+		},
+	}
+	var inserted *kafkaconfluent.Message
 	producer := NewMockKafkaProducer(ctrl)
-	producer.EXPECT().ProduceChannel().Return(produceChannel)
-	producer.EXPECT().Len().Return(0)
-	producer.EXPECT().Close()
+	producer.EXPECT().Produce(gomock.Any(), nil).DoAndReturn(func(msg *kafkaconfluent.Message, _ chan kafkaconfluent.Event) error {
+		inserted = msg
+		return nil
+	})
 
 	cli := NewClient(producer)
 
 	// When
-	cli.Produce(messages)
+	err := cli.Produce(context.Background(), message)
 
 	// Then
-	inserted := <-produceChannel
-
 	assert := assert.New(t)
+	assert.NoError(err)
 	assert.IsType(new(kafkaconfluent.Message), inserted)
 
 	assert.Equal("test-topic", *inserted.TopicPartition.Topic)
@@ -65,6 +61,54 @@ func TestClientProduce(t *testing.T) {
 
 	assert.Equal("x-test-header", inserted.Headers[0].Key)
 	assert.Equal([]byte("test"), inserted.Headers[0].Value)
+
+	assert.Equal(&Delivery{Message: message, Attempts: 1, Sequence: 1}, DeliveryOf(inserted))
+}
+
+func TestClientProduceWhenQueueFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	producer := NewMockKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().Produce(gomock.Any(), nil).Return(kafkaconfluent.NewError(kafkaconfluent.ErrQueueFull, "queue full", false)),
+		producer.EXPECT().Flush(100).Return(0),
+		producer.EXPECT().Produce(gomock.Any(), nil).Return(nil),
+	)
+
+	cli := NewClient(producer)
+
+	// When - Then
+	assert.NoError(t, cli.Produce(context.Background(), &Message{Topic: "test-topic"}))
+}
+
+func TestClientProduceReturnsProduceErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	var produced []*kafkaconfluent.Message
+	producer := NewMockKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().Produce(gomock.Any(), nil).Return(kafkaconfluent.NewError(kafkaconfluent.ErrMsgSizeTooLarge, "too large", false)),
+		producer.EXPECT().Produce(gomock.Any(), nil).DoAndReturn(func(msg *kafkaconfluent.Message, _ chan kafkaconfluent.Event) error {
+			produced = append(produced, msg)
+			return nil
+		}),
+	)
+
+	cli := NewClient(producer)
+
+	// When
+	err := cli.Produce(context.Background(), &Message{Topic: "test-topic"})
+	next := cli.Produce(context.Background(), &Message{Topic: "test-topic"})
+
+	// Then
+	assert := assert.New(t)
+	assert.Error(err)
+	assert.NoError(next)
+	assert.Equal(uint64(1), DeliveryOf(produced[0]).Sequence, "the message that cannot be produced is not part of the sequence")
 }
 
 func TestClientEvents(t *testing.T) {
@@ -91,11 +135,65 @@ func TestClientClose(t *testing.T) {
 
 	// Given
 	producer := NewMockKafkaProducer(ctrl)
-	producer.EXPECT().Len().Return(0)
-	producer.EXPECT().Close()
+	gomock.InOrder(
+		producer.EXPECT().Flush(30000).Return(0),
+		producer.EXPECT().Close(),
+	)
 
 	cli := NewClient(producer)
 
 	// When - Then
-	cli.Close()
+	assert.NoError(t, cli.Close())
+}
+
+func TestClientCloseWhenMessagesAreLeftUndelivered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	producer := NewMockKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().Flush(5000).Return(2),
+		producer.EXPECT().Close(),
+	)
+
+	cli := NewClient(producer, WithFlushTimeout(5*time.Second))
+
+	// When
+	err := cli.Close()
+
+	// Then
+	assert.ErrorIs(t, err, ErrUndelivered)
+	assert.EqualError(t, err, "messages left undelivered: 2 messages still queued after 5s")
+}
+
+func TestClientProduceWithTimestamp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	timestamp := time.Unix(1600000000, 0)
+
+	message := &Message{
+		Topic:     "test-topic",
+		Key:       []byte(`my-key`),
+		Value:     []byte(`my-value`),
+		Timestamp: timestamp,
+	}
+
+	var inserted *kafkaconfluent.Message
+	producer := NewMockKafkaProducer(ctrl)
+	producer.EXPECT().Produce(gomock.Any(), nil).DoAndReturn(func(msg *kafkaconfluent.Message, _ chan kafkaconfluent.Event) error {
+		inserted = msg
+		return nil
+	})
+
+	cli := NewClient(producer)
+
+	// When
+	cli.Produce(context.Background(), message)
+
+	// Then
+	assert.Equal(t, timestamp, inserted.Timestamp)
+	assert.Equal(t, kafkaconfluent.TimestampCreateTime, inserted.TimestampType)
 }
@@ -0,0 +1,395 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+)
+
+// ErrTransactionIncomplete is returned when the last message of a Mongo transaction is not received within
+// the transaction timeout, its Kafka transaction being aborted
+var ErrTransactionIncomplete = errors.New("mongo transaction incomplete within the transaction timeout")
+
+type transactionalClient struct {
+	producer TransactionalKafkaProducer
+	logger   logger.LoggerInterface
+
+	batchSize          int
+	batchTimeout       time.Duration
+	operationTimeout   time.Duration
+	transactionTimeout time.Duration
+	maxRetries         int
+
+	// Topic and key of the checkpoint message committed with each transaction
+	checkpointTopic string
+	checkpointKey   string
+
+	// Computes the partition of the messages with a partition key
+	partitions *PartitionCounter
+
+	// Called once the client failed and stopped producing
+	halt func(error)
+
+	// Guards the opened transaction, which is also committed by the batch timer
+	mutex       sync.Mutex
+	initialized bool
+	batch       *transactionBatch
+	timer       *time.Timer
+	err         error
+	// Checkpoint marked while no transaction is opened, committed with the next one
+	checkpoint []byte
+}
+
+// TransactionalOption allows to customize the transactional client behavior
+type TransactionalOption func(*transactionalClient)
+
+// WithTransactionBatchSize allows to specify the maximum number of messages not belonging to a Mongo
+// transaction that are committed in a same Kafka transaction
+func WithTransactionBatchSize(size int) TransactionalOption {
+	return func(c *transactionalClient) {
+		if size > 0 {
+			c.batchSize = size
+		}
+	}
+}
+
+// WithTransactionBatchTimeout allows to specify the duration without new message after which the
+// current Kafka transaction is committed
+func WithTransactionBatchTimeout(timeout time.Duration) TransactionalOption {
+	return func(c *transactionalClient) {
+		if timeout > 0 {
+			c.batchTimeout = timeout
+		}
+	}
+}
+
+// WithTransactionOperationTimeout allows to specify the timeout of the transactions initialization,
+// commit and abort operations
+func WithTransactionOperationTimeout(timeout time.Duration) TransactionalOption {
+	return func(c *transactionalClient) {
+		if timeout > 0 {
+			c.operationTimeout = timeout
+		}
+	}
+}
+
+// WithTransactionTimeout allows to specify the duration a Kafka transaction holding a Mongo transaction
+// can stay opened waiting for its last message, it should not exceed the producer transaction.timeout.ms
+func WithTransactionTimeout(timeout time.Duration) TransactionalOption {
+	return func(c *transactionalClient) {
+		if timeout > 0 {
+			c.transactionTimeout = timeout
+		}
+	}
+}
+
+// WithCheckpointTopic allows to commit the last checkpoint of the messages of each transaction,
+// in the same transaction, as a message of the given topic keyed by the given key
+func WithCheckpointTopic(topic string, key string) TransactionalOption {
+	return func(c *transactionalClient) {
+		c.checkpointTopic = topic
+		c.checkpointKey = key
+	}
+}
+
+// WithTransactionPartitionCounter allows to compute the partition of the messages with a partition key,
+// from the number of partitions of their topic
+func WithTransactionPartitionCounter(counter *PartitionCounter) TransactionalOption {
+	return func(c *transactionalClient) {
+		c.partitions = counter
+	}
+}
+
+// WithTransactionHaltFunc allows to specify the function called when the client failed and stopped
+// producing, typically to stop the stream
+func WithTransactionHaltFunc(halt func(error)) TransactionalOption {
+	return func(c *transactionalClient) {
+		c.halt = halt
+	}
+}
+
+// NewTransactionalClient returns a kafka client producing messages inside Kafka transactions: the
+// messages of a Mongo transaction are committed together, other messages are committed by batches.
+// Consumers using the "read_committed" isolation level never see partially sent transactions.
+func NewTransactionalClient(producer TransactionalKafkaProducer, logger logger.LoggerInterface, options ...TransactionalOption) *transactionalClient {
+	client := &transactionalClient{
+		producer:           producer,
+		logger:             logger,
+		batchSize:          1000,
+		batchTimeout:       100 * time.Millisecond,
+		operationTimeout:   30 * time.Second,
+		transactionTimeout: 60 * time.Second,
+		maxRetries:         3,
+		halt:               func(error) {},
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// transactionBatch holds the messages of the opened Kafka transaction, in order to produce them again
+// when the transaction has to be aborted
+type transactionBatch struct {
+	messages    []*kafka.Message
+	transaction string
+	// Time after which the batch of a Mongo transaction is aborted when its last message is not received
+	deadline   time.Time
+	checkpoint []byte
+	// Explicit partitions of the messages, the others are partitioned by the producer
+	partitions map[*kafka.Message]int32
+}
+
+// Produce sends the message inside the opened Kafka transaction, beginning a new one when needed.
+// Once a transaction cannot be committed nor aborted the client stops producing and returns an
+// ErrStreamHalted error for all the following messages.
+func (c *transactionalClient) Produce(_ context.Context, message *Message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	// The message is not produced, without failing the transactions
+	partition, err := messagePartition(message, c.partitions)
+	if err != nil {
+		return err
+	}
+	if err := c.add(message, partition); err != nil {
+		c.fail(err)
+		return c.err
+	}
+	return nil
+}
+
+// MarkCheckpoint commits the checkpoint of the change events without message with the opened
+// transaction, or with the next one
+func (c *transactionalClient) MarkCheckpoint(checkpoint []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.batch != nil {
+		c.batch.checkpoint = checkpoint
+		return
+	}
+	c.checkpoint = checkpoint
+}
+
+func (c *transactionalClient) add(message *Message, partition int32) error {
+	if !c.initialized {
+		if err := c.withTimeout(c.producer.InitTransactions); err != nil {
+			c.logger.Error("Kafka client: Unable to initialize transactions", logger.Error("error", err))
+			return err
+		}
+		c.initialized = true
+		c.timer = time.AfterFunc(c.batchTimeout, c.commitOnTimeout)
+	}
+	c.timer.Stop()
+
+	// A Mongo transaction is never committed with other messages
+	if c.batch != nil && c.batch.transaction != message.Transaction {
+		if err := c.commitBatch(); err != nil {
+			return err
+		}
+	}
+
+	if c.batch == nil {
+		if err := c.producer.BeginTransaction(); err != nil {
+			c.logger.Error("Kafka client: Unable to begin transaction", logger.Error("error", err))
+			return err
+		}
+		c.batch = &transactionBatch{transaction: message.Transaction, checkpoint: c.checkpoint}
+		c.checkpoint = nil
+		if message.Transaction != "" {
+			c.batch.deadline = time.Now().Add(c.transactionTimeout)
+		}
+	}
+	if c.batch.expired() {
+		return c.abortBatch()
+	}
+
+	kafkaMessage := buildMessage(message, partition)
+	c.batch.messages = append(c.batch.messages, kafkaMessage)
+	if partition != kafka.PartitionAny {
+		if c.batch.partitions == nil {
+			c.batch.partitions = map[*kafka.Message]int32{}
+		}
+		c.batch.partitions[kafkaMessage] = partition
+	}
+	if message.Checkpoint != nil {
+		c.batch.checkpoint = message.Checkpoint
+	}
+	if err := c.produce(kafkaMessage); err != nil {
+		c.logger.Error("Kafka client: Unable to produce message in transaction", logger.String("topic", message.Topic), logger.Error("error", err))
+		if !c.retry(c.batch) {
+			return err
+		}
+	}
+
+	batchFull := message.Transaction == "" && len(c.batch.messages) >= c.batchSize
+	if message.TransactionEnd || batchFull {
+		return c.commitBatch()
+	}
+	c.timer.Reset(c.batchTimeout)
+
+	return nil
+}
+
+// Commits the opened transaction once no message has been produced during the batch timeout. The
+// transaction of a Mongo transaction is only committed with its last message, it is aborted once it
+// stayed opened longer than the transaction timeout.
+func (c *transactionalClient) commitOnTimeout() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil || c.batch == nil {
+		return
+	}
+	if c.batch.transaction != "" {
+		if !c.batch.expired() {
+			c.timer.Reset(time.Until(c.batch.deadline))
+			return
+		}
+		c.fail(c.abortBatch())
+		return
+	}
+	if err := c.commitBatch(); err != nil {
+		c.fail(err)
+	}
+}
+
+func (b *transactionBatch) expired() bool {
+	return b.transaction != "" && !time.Now().Before(b.deadline)
+}
+
+func (c *transactionalClient) commitBatch() error {
+	batch := c.batch
+	c.batch = nil
+	return c.commit(batch)
+}
+
+// Aborts the transaction of an incomplete Mongo transaction, which cannot be committed partially
+func (c *transactionalClient) abortBatch() error {
+	batch := c.batch
+	c.batch = nil
+
+	err := fmt.Errorf("%w: %s", ErrTransactionIncomplete, batch.transaction)
+	c.logger.Error("Kafka client: Mongo transaction incomplete, aborting its Kafka transaction", logger.String("transaction", batch.transaction), logger.Int64("messages", int64(len(batch.messages))))
+	if abortErr := c.withTimeout(c.producer.AbortTransaction); abortErr != nil {
+		c.logger.Error("Kafka client: Unable to abort transaction", logger.Error("error", abortErr))
+	}
+	return err
+}
+
+func (c *transactionalClient) fail(err error) {
+	c.err = fmt.Errorf("%w: transactional client failed: %w", ErrStreamHalted, err)
+	c.halt(c.err)
+}
+
+// Produces the message, waiting for the local queue to have room for it
+func (c *transactionalClient) produce(message *kafka.Message) error {
+	return produceBlocking(c.producer, message, c.batchTimeout)
+}
+
+// Commits the batch transaction, the transaction is aborted and its messages produced again in a new
+// transaction when the commit cannot succeed
+func (c *transactionalClient) commit(batch *transactionBatch) error {
+	if c.checkpointTopic != "" && batch.checkpoint != nil {
+		checkpoint := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &c.checkpointTopic, Partition: kafka.PartitionAny},
+			Key:            []byte(c.checkpointKey),
+			Value:          batch.checkpoint,
+		}
+		batch.messages = append(batch.messages, checkpoint)
+		if err := c.produce(checkpoint); err != nil {
+			c.logger.Error("Kafka client: Unable to produce checkpoint in transaction", logger.String("topic", c.checkpointTopic), logger.Error("error", err))
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.withTimeout(c.producer.CommitTransaction)
+		if err == nil {
+			return nil
+		}
+
+		var kafkaErr kafka.Error
+		isKafkaErr := errors.As(err, &kafkaErr)
+		if isKafkaErr && kafkaErr.IsRetriable() && attempt < c.maxRetries {
+			c.logger.Warning("Kafka client: Retrying transaction commit", logger.Int64("attempt", int64(attempt+1)), logger.Error("error", err))
+			continue
+		}
+		if !isKafkaErr || !kafkaErr.TxnRequiresAbort() || attempt >= c.maxRetries {
+			c.logger.Error("Kafka client: Unable to commit transaction", logger.Int64("messages", int64(len(batch.messages))), logger.Error("error", err))
+			return err
+		}
+
+		c.logger.Warning("Kafka client: Transaction aborted, producing its messages again", logger.Int64("messages", int64(len(batch.messages))), logger.Error("error", err))
+		if !c.retry(batch) {
+			return err
+		}
+	}
+}
+
+// Aborts the current transaction and produces the batch messages again in a new one
+func (c *transactionalClient) retry(batch *transactionBatch) bool {
+	if err := c.withTimeout(c.producer.AbortTransaction); err != nil {
+		c.logger.Error("Kafka client: Unable to abort transaction", logger.Error("error", err))
+		return false
+	}
+	if err := c.producer.BeginTransaction(); err != nil {
+		c.logger.Error("Kafka client: Unable to begin transaction", logger.Error("error", err))
+		return false
+	}
+	for _, message := range batch.messages {
+		// A message that has already been produced cannot be sent again as is
+		message.TopicPartition.Error = nil
+		message.TopicPartition.Partition = kafka.PartitionAny
+		if partition, ok := batch.partitions[message]; ok {
+			message.TopicPartition.Partition = partition
+		}
+		if err := c.produce(message); err != nil {
+			c.logger.Error("Kafka client: Unable to produce message in transaction", logger.String("topic", *message.TopicPartition.Topic), logger.Error("error", err))
+			return false
+		}
+	}
+	return true
+}
+
+func (c *transactionalClient) withTimeout(operation func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.operationTimeout)
+	defer cancel()
+	return operation(ctx)
+}
+
+// Events returns the kafka producer events
+func (c *transactionalClient) Events() chan kafka.Event {
+	return c.producer.Events()
+}
+
+// Close allows to close/disconnect the kafka client, the opened transaction is committed first unless it
+// holds a Mongo transaction whose last message has not been received, which is aborted.
+// The error of the client is returned when it failed, its last transaction being left undelivered.
+func (c *transactionalClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if c.err == nil && c.batch != nil {
+		if c.batch.transaction != "" {
+			c.fail(c.abortBatch())
+		} else if err := c.commitBatch(); err != nil {
+			c.fail(err)
+		}
+	}
+	c.producer.Close()
+
+	return c.err
+}
@@ -0,0 +1,269 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionalClientProduceCommitsMongoTransactionsAndBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	messages := make(chan *Message, 5)
+	messages <- &Message{Topic: "topic", Key: []byte("1"), Transaction: "txn-1"}
+	messages <- &Message{Topic: "topic", Key: []byte("2"), Transaction: "txn-1", TransactionEnd: true}
+	messages <- &Message{Topic: "topic", Key: []byte("3")}
+	messages <- &Message{Topic: "topic", Key: []byte("4")}
+	messages <- &Message{Topic: "topic", Key: []byte("5")}
+	close(messages)
+
+	var produced []string
+
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().InitTransactions(gomock.Any()).Return(nil),
+		// Mongo transaction
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(gomock.Any(), nil).Times(2).DoAndReturn(func(message *kafkaconfluent.Message, _ chan kafkaconfluent.Event) error {
+			produced = append(produced, string(message.Key))
+			return nil
+		}),
+		producer.EXPECT().CommitTransaction(gomock.Any()).Return(nil),
+		// Batch of 2 messages
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(gomock.Any(), nil).Times(2).Return(nil),
+		producer.EXPECT().CommitTransaction(gomock.Any()).Return(nil),
+		// Remaining message, committed once the messages channel is closed
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(gomock.Any(), nil).Return(nil),
+		producer.EXPECT().CommitTransaction(gomock.Any()).Return(nil),
+		producer.EXPECT().Close(),
+	)
+
+	cli := NewTransactionalClient(producer, logger.NewNopLogger(), WithTransactionBatchSize(2), WithTransactionBatchTimeout(time.Hour))
+
+	// When
+	ProduceAll(context.Background(), cli, messages, logger.NewNopLogger())
+
+	// Then
+	assert.Equal(t, []string{"1", "2"}, produced)
+}
+
+func TestTransactionalClientProduceWaitsWhenQueueIsFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	messages := make(chan *Message, 1)
+	messages <- &Message{Topic: "topic", Key: []byte("1"), Transaction: "txn-1", TransactionEnd: true}
+	close(messages)
+
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().InitTransactions(gomock.Any()).Return(nil),
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(gomock.Any(), nil).Return(kafkaconfluent.NewError(kafkaconfluent.ErrQueueFull, "queue full", false)),
+		producer.EXPECT().Flush(100).Return(1),
+		producer.EXPECT().Produce(gomock.Any(), nil).Return(nil),
+		producer.EXPECT().CommitTransaction(gomock.Any()).Return(nil),
+		producer.EXPECT().Close(),
+	)
+
+	cli := NewTransactionalClient(producer, logger.NewNopLogger())
+
+	// When
+	ProduceAll(context.Background(), cli, messages, logger.NewNopLogger())
+}
+
+func TestTransactionalClientRetryProducesBatchAgain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	topic := "topic"
+	message := &kafkaconfluent.Message{TopicPartition: kafkaconfluent.TopicPartition{Topic: &topic, Partition: 2, Error: assert.AnError}}
+
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().AbortTransaction(gomock.Any()).Return(nil),
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(message, nil).Return(nil),
+	)
+
+	cli := NewTransactionalClient(producer, logger.NewNopLogger())
+
+	// When
+	ok := cli.retry(&transactionBatch{messages: []*kafkaconfluent.Message{message}})
+
+	// Then
+	assert.True(t, ok)
+	assert.Nil(t, message.TopicPartition.Error)
+	assert.Equal(t, kafkaconfluent.PartitionAny, message.TopicPartition.Partition)
+}
+
+func TestTransactionalClientRetryKeepsExplicitPartitions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	topic := "topic"
+	message := &kafkaconfluent.Message{TopicPartition: kafkaconfluent.TopicPartition{Topic: &topic, Partition: 2, Error: assert.AnError}}
+
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().AbortTransaction(gomock.Any()).Return(nil),
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(message, nil).Return(nil),
+	)
+
+	cli := NewTransactionalClient(producer, logger.NewNopLogger())
+
+	// When
+	ok := cli.retry(&transactionBatch{
+		messages:   []*kafkaconfluent.Message{message},
+		partitions: map[*kafkaconfluent.Message]int32{message: 5},
+	})
+
+	// Then
+	assert.True(t, ok)
+	assert.Nil(t, message.TopicPartition.Error)
+	assert.Equal(t, int32(5), message.TopicPartition.Partition)
+}
+
+func TestTransactionalClientCommitsAfterBatchTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	committed := make(chan struct{})
+
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	producer.EXPECT().InitTransactions(gomock.Any()).Return(nil)
+	producer.EXPECT().BeginTransaction().Return(nil)
+	producer.EXPECT().Produce(gomock.Any(), nil).Return(nil)
+	producer.EXPECT().CommitTransaction(gomock.Any()).DoAndReturn(func(_ interface{}) error {
+		close(committed)
+		return nil
+	})
+	producer.EXPECT().Close()
+
+	cli := NewTransactionalClient(producer, logger.NewNopLogger(), WithTransactionBatchTimeout(10*time.Millisecond))
+
+	// When
+	err := cli.Produce(context.Background(), &Message{Topic: "topic", Key: []byte("1")})
+
+	// Then
+	select {
+	case <-committed:
+	case <-time.After(time.Second):
+		t.Fatal("the transaction should have been committed after the batch timeout")
+	}
+	assert.NoError(t, err)
+	cli.Close()
+}
+
+func TestTransactionalClientKeepsMongoTransactionOpenedAfterBatchTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	var produced []string
+	committed := make(chan struct{})
+
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().InitTransactions(gomock.Any()).Return(nil),
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(gomock.Any(), nil).Times(2).DoAndReturn(func(message *kafkaconfluent.Message, _ chan kafkaconfluent.Event) error {
+			produced = append(produced, string(message.Key))
+			return nil
+		}),
+		// A single commit, once the last message of the Mongo transaction is received
+		producer.EXPECT().CommitTransaction(gomock.Any()).DoAndReturn(func(_ interface{}) error {
+			close(committed)
+			return nil
+		}),
+		producer.EXPECT().Close(),
+	)
+
+	cli := NewTransactionalClient(producer, logger.NewNopLogger(), WithTransactionBatchTimeout(10*time.Millisecond))
+
+	// When the messages of the Mongo transaction are further apart than the batch timeout
+	assert.NoError(t, cli.Produce(context.Background(), &Message{Topic: "topic", Key: []byte("1"), Transaction: "txn-1"}))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, cli.Produce(context.Background(), &Message{Topic: "topic", Key: []byte("2"), Transaction: "txn-1", TransactionEnd: true}))
+
+	// Then
+	select {
+	case <-committed:
+	case <-time.After(time.Second):
+		t.Fatal("the transaction should have been committed with its last message")
+	}
+	assert.Equal(t, []string{"1", "2"}, produced)
+	assert.NoError(t, cli.Close())
+}
+
+func TestTransactionalClientAbortsIncompleteMongoTransaction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	halted := make(chan error, 1)
+
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	gomock.InOrder(
+		producer.EXPECT().InitTransactions(gomock.Any()).Return(nil),
+		producer.EXPECT().BeginTransaction().Return(nil),
+		producer.EXPECT().Produce(gomock.Any(), nil).Return(nil),
+		producer.EXPECT().AbortTransaction(gomock.Any()).Return(nil),
+		producer.EXPECT().Close(),
+	)
+
+	cli := NewTransactionalClient(producer, logger.NewNopLogger(),
+		WithTransactionBatchTimeout(10*time.Millisecond),
+		WithTransactionTimeout(30*time.Millisecond),
+		WithTransactionHaltFunc(func(err error) { halted <- err }),
+	)
+
+	// When the last message of the Mongo transaction is not received
+	assert.NoError(t, cli.Produce(context.Background(), &Message{Topic: "topic", Key: []byte("1"), Transaction: "txn-1"}))
+
+	// Then its Kafka transaction is aborted instead of being committed partially
+	select {
+	case err := <-halted:
+		assert.ErrorIs(t, err, ErrStreamHalted)
+		assert.ErrorIs(t, err, ErrTransactionIncomplete)
+	case <-time.After(time.Second):
+		t.Fatal("the stream should have been halted once the transaction timeout elapsed")
+	}
+	assert.ErrorIs(t, cli.Close(), ErrTransactionIncomplete)
+}
+
+func TestTransactionalClientStopsProducingOnceFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	producer := NewMockTransactionalKafkaProducer(ctrl)
+	producer.EXPECT().InitTransactions(gomock.Any()).Return(assert.AnError)
+
+	var haltErr error
+	cli := NewTransactionalClient(producer, logger.NewNopLogger(), WithTransactionHaltFunc(func(err error) { haltErr = err }))
+
+	// When
+	err := cli.Produce(context.Background(), &Message{Topic: "topic", Key: []byte("1")})
+	next := cli.Produce(context.Background(), &Message{Topic: "topic", Key: []byte("2")})
+
+	// Then
+	assert.ErrorIs(t, err, ErrStreamHalted)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, err, haltErr)
+	assert.Equal(t, err, next, "no message is produced once the client failed")
+}
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Security protocols of the connections to the brokers
+const (
+	SecurityProtocolPlaintext     = "plaintext"
+	SecurityProtocolSSL           = "ssl"
+	SecurityProtocolSASLPlaintext = "sasl_plaintext"
+	SecurityProtocolSASLSSL       = "sasl_ssl"
+)
+
+// SASL mechanisms
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	SASLMechanismSCRAMSHA512 = "SCRAM-SHA-512"
+	SASLMechanismOAuthBearer = "OAUTHBEARER"
+)
+
+// DefaultProducerConfig returns the producer properties set unless overridden: messages are neither
+// duplicated nor reordered by the producer retries, and are acknowledged once written to all the
+// in-sync replicas
+func DefaultProducerConfig() kafka.ConfigMap {
+	return kafka.ConfigMap{
+		"enable.idempotence": true,
+		"acks":               "all",
+	}
+}
+
+// SecurityConfig is the TLS and SASL configuration of the connections to the brokers
+type SecurityConfig struct {
+	// Defaults to sasl_ssl when a SASL mechanism is set, to ssl when a TLS option is set
+	Protocol string
+
+	SSLCALocation          string
+	SSLCertificateLocation string
+	SSLKeyLocation         string
+	SSLKeyPassword         string
+
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+
+	OAuthBearerClientID         string
+	OAuthBearerClientSecret     string
+	OAuthBearerTokenEndpointURL string
+	OAuthBearerScope            string
+}
+
+// ConfigMap validates the security configuration and returns its properties
+func (c *SecurityConfig) ConfigMap() (kafka.ConfigMap, error) {
+	configMap := kafka.ConfigMap{}
+
+	protocol := strings.ToLower(c.Protocol)
+	mechanism := strings.ToUpper(c.SASLMechanism)
+	hasSSL := c.SSLCALocation != "" || c.SSLCertificateLocation != "" || c.SSLKeyLocation != "" || c.SSLKeyPassword != ""
+	if protocol == "" {
+		switch {
+		case mechanism != "":
+			protocol = SecurityProtocolSASLSSL
+		case hasSSL:
+			protocol = SecurityProtocolSSL
+		default:
+			return configMap, nil
+		}
+	}
+
+	switch protocol {
+	case SecurityProtocolPlaintext, SecurityProtocolSASLPlaintext:
+		if hasSSL {
+			return nil, fmt.Errorf("the TLS options require the %s or %s security protocol, got %s", SecurityProtocolSSL, SecurityProtocolSASLSSL, protocol)
+		}
+	case SecurityProtocolSSL, SecurityProtocolSASLSSL:
+		if err := c.sslConfig(configMap); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown security protocol %q (available: %s, %s, %s, %s)", c.Protocol, SecurityProtocolPlaintext, SecurityProtocolSSL, SecurityProtocolSASLPlaintext, SecurityProtocolSASLSSL)
+	}
+	configMap["security.protocol"] = protocol
+
+	isSASL := protocol == SecurityProtocolSASLPlaintext || protocol == SecurityProtocolSASLSSL
+	switch {
+	case isSASL && mechanism == "":
+		return nil, fmt.Errorf("the %s security protocol requires a SASL mechanism", protocol)
+	case !isSASL && (mechanism != "" || c.SASLUsername != "" || c.SASLPassword != "" || c.OAuthBearerClientID != ""):
+		return nil, fmt.Errorf("the SASL options require the %s or %s security protocol, got %s", SecurityProtocolSASLPlaintext, SecurityProtocolSASLSSL, protocol)
+	case isSASL:
+		if err := c.saslConfig(configMap, mechanism); err != nil {
+			return nil, err
+		}
+	}
+
+	return configMap, nil
+}
+
+func (c *SecurityConfig) sslConfig(configMap kafka.ConfigMap) error {
+	if (c.SSLCertificateLocation == "") != (c.SSLKeyLocation == "") {
+		return errors.New("the TLS client certificate and key locations have to be set together")
+	}
+	if c.SSLKeyPassword != "" && c.SSLKeyLocation == "" {
+		return errors.New("the TLS key password requires the TLS key location")
+	}
+
+	for property, location := range map[string]string{
+		"ssl.ca.location":          c.SSLCALocation,
+		"ssl.certificate.location": c.SSLCertificateLocation,
+		"ssl.key.location":         c.SSLKeyLocation,
+	} {
+		if location == "" {
+			continue
+		}
+		if _, err := os.Stat(location); err != nil {
+			return fmt.Errorf("invalid %s: %w", property, err)
+		}
+		configMap[property] = location
+	}
+	if c.SSLKeyPassword != "" {
+		configMap["ssl.key.password"] = c.SSLKeyPassword
+	}
+
+	return nil
+}
+
+func (c *SecurityConfig) saslConfig(configMap kafka.ConfigMap, mechanism string) error {
+	switch mechanism {
+	case SASLMechanismPlain, SASLMechanismSCRAMSHA256, SASLMechanismSCRAMSHA512:
+		if c.SASLUsername == "" || c.SASLPassword == "" {
+			return fmt.Errorf("the %s SASL mechanism requires a username and a password", mechanism)
+		}
+		configMap["sasl.username"] = c.SASLUsername
+		configMap["sasl.password"] = c.SASLPassword
+	case SASLMechanismOAuthBearer:
+		if c.OAuthBearerClientID == "" || c.OAuthBearerClientSecret == "" || c.OAuthBearerTokenEndpointURL == "" {
+			return fmt.Errorf("the %s SASL mechanism requires a client id, a client secret and a token endpoint URL", mechanism)
+		}
+		configMap["sasl.oauthbearer.method"] = "oidc"
+		configMap["sasl.oauthbearer.client.id"] = c.OAuthBearerClientID
+		configMap["sasl.oauthbearer.client.secret"] = c.OAuthBearerClientSecret
+		configMap["sasl.oauthbearer.token.endpoint.url"] = c.OAuthBearerTokenEndpointURL
+		if c.OAuthBearerScope != "" {
+			configMap["sasl.oauthbearer.scope"] = c.OAuthBearerScope
+		}
+	default:
+		return fmt.Errorf("unknown SASL mechanism %q (available: %s, %s, %s, %s)", c.SASLMechanism, SASLMechanismPlain, SASLMechanismSCRAMSHA256, SASLMechanismSCRAMSHA512, SASLMechanismOAuthBearer)
+	}
+	configMap["sasl.mechanism"] = mechanism
+
+	return nil
+}
+
+// ReadSecret returns the secret, or the content of the secret file when one is given. The name of the
+// secret is used in the errors.
+func ReadSecret(name string, secret string, file string) (string, error) {
+	if file == "" {
+		return secret, nil
+	}
+	if secret != "" {
+		return "", fmt.Errorf("%s and its file cannot be both set", name)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s file: %w", name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
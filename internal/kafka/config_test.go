@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityConfigMap(t *testing.T) {
+	directory := t.TempDir()
+	ca := filepath.Join(directory, "ca.pem")
+	certificate := filepath.Join(directory, "client.pem")
+	key := filepath.Join(directory, "client.key")
+	for _, file := range []string{ca, certificate, key} {
+		if err := os.WriteFile(file, []byte("pem"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		config   SecurityConfig
+		expected kafka.ConfigMap
+		err      string
+	}{
+		{
+			name:     "no security",
+			expected: kafka.ConfigMap{},
+		},
+		{
+			name:   "mutual TLS",
+			config: SecurityConfig{SSLCALocation: ca, SSLCertificateLocation: certificate, SSLKeyLocation: key, SSLKeyPassword: "secret"},
+			expected: kafka.ConfigMap{
+				"security.protocol":        "ssl",
+				"ssl.ca.location":          ca,
+				"ssl.certificate.location": certificate,
+				"ssl.key.location":         key,
+				"ssl.key.password":         "secret",
+			},
+		},
+		{
+			name:   "SCRAM over TLS",
+			config: SecurityConfig{SSLCALocation: ca, SASLMechanism: "scram-sha-512", SASLUsername: "watcher", SASLPassword: "secret"},
+			expected: kafka.ConfigMap{
+				"security.protocol": "sasl_ssl",
+				"ssl.ca.location":   ca,
+				"sasl.mechanism":    "SCRAM-SHA-512",
+				"sasl.username":     "watcher",
+				"sasl.password":     "secret",
+			},
+		},
+		{
+			name: "OAUTHBEARER",
+			config: SecurityConfig{
+				Protocol:                    "SASL_PLAINTEXT",
+				SASLMechanism:               "OAUTHBEARER",
+				OAuthBearerClientID:         "watcher",
+				OAuthBearerClientSecret:     "secret",
+				OAuthBearerTokenEndpointURL: "https://auth.example.com/token",
+				OAuthBearerScope:            "kafka",
+			},
+			expected: kafka.ConfigMap{
+				"security.protocol":                   "sasl_plaintext",
+				"sasl.mechanism":                      "OAUTHBEARER",
+				"sasl.oauthbearer.method":             "oidc",
+				"sasl.oauthbearer.client.id":          "watcher",
+				"sasl.oauthbearer.client.secret":      "secret",
+				"sasl.oauthbearer.token.endpoint.url": "https://auth.example.com/token",
+				"sasl.oauthbearer.scope":              "kafka",
+			},
+		},
+		{
+			name:   "unknown protocol",
+			config: SecurityConfig{Protocol: "tls"},
+			err:    `unknown security protocol "tls" (available: plaintext, ssl, sasl_plaintext, sasl_ssl)`,
+		},
+		{
+			name:   "TLS options over plaintext",
+			config: SecurityConfig{Protocol: "plaintext", SSLCALocation: ca},
+			err:    "the TLS options require the ssl or sasl_ssl security protocol, got plaintext",
+		},
+		{
+			name:   "certificate without key",
+			config: SecurityConfig{SSLCertificateLocation: certificate},
+			err:    "the TLS client certificate and key locations have to be set together",
+		},
+		{
+			name:   "missing CA file",
+			config: SecurityConfig{SSLCALocation: filepath.Join(directory, "missing.pem")},
+			err:    "invalid ssl.ca.location: stat " + filepath.Join(directory, "missing.pem") + ": no such file or directory",
+		},
+		{
+			name:   "SASL protocol without mechanism",
+			config: SecurityConfig{Protocol: "sasl_ssl"},
+			err:    "the sasl_ssl security protocol requires a SASL mechanism",
+		},
+		{
+			name:   "SASL options over TLS only",
+			config: SecurityConfig{Protocol: "ssl", SASLUsername: "watcher"},
+			err:    "the SASL options require the sasl_plaintext or sasl_ssl security protocol, got ssl",
+		},
+		{
+			name:   "PLAIN without password",
+			config: SecurityConfig{SASLMechanism: "PLAIN", SASLUsername: "watcher"},
+			err:    "the PLAIN SASL mechanism requires a username and a password",
+		},
+		{
+			name:   "OAUTHBEARER without token endpoint",
+			config: SecurityConfig{SASLMechanism: "OAUTHBEARER", OAuthBearerClientID: "watcher", OAuthBearerClientSecret: "secret"},
+			err:    "the OAUTHBEARER SASL mechanism requires a client id, a client secret and a token endpoint URL",
+		},
+		{
+			name:   "unknown mechanism",
+			config: SecurityConfig{SASLMechanism: "GSSAPI"},
+			err:    `unknown SASL mechanism "GSSAPI" (available: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512, OAUTHBEARER)`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			configMap, err := testCase.config.ConfigMap()
+			if testCase.err != "" {
+				assert.EqualError(t, err, testCase.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, configMap)
+		})
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+
+	secret, err := ReadSecret("KAFKA_SASL_PASSWORD", "inline", "")
+	assert.NoError(err)
+	assert.Equal("inline", secret)
+
+	secret, err = ReadSecret("KAFKA_SASL_PASSWORD", "", file)
+	assert.NoError(err)
+	assert.Equal("from-file", secret)
+
+	_, err = ReadSecret("KAFKA_SASL_PASSWORD", "inline", file)
+	assert.EqualError(err, "KAFKA_SASL_PASSWORD and its file cannot be both set")
+
+	_, err = ReadSecret("KAFKA_SASL_PASSWORD", "", file+"-missing")
+	assert.ErrorIs(err, os.ErrNotExist)
+}
@@ -0,0 +1,398 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+	"github.com/gol4ng/logger"
+)
+
+// Processing stages where an event can fail
+const (
+	DeadLetterStageDecode    = "decode"
+	DeadLetterStageTransform = "transform"
+	DeadLetterStageDelivery  = "delivery"
+)
+
+// Headers added to the dead letter messages
+const (
+	HeaderDeadLetterStage         = "x-dlq-stage"
+	HeaderDeadLetterErrorClass    = "x-dlq-error-class"
+	HeaderDeadLetterErrorMessage  = "x-dlq-error-message"
+	HeaderDeadLetterAttempts      = "x-dlq-attempts"
+	HeaderDeadLetterOriginalTopic = "x-dlq-original-topic"
+)
+
+// DeadLetterAction is the action applied when a stage fails
+type DeadLetterAction string
+
+const (
+	// DeadLetterActionLog logs the failure and skips the event
+	DeadLetterActionLog DeadLetterAction = "log"
+	// DeadLetterActionQueue sends the event to the dead letter queue
+	DeadLetterActionQueue DeadLetterAction = "dlq"
+	// DeadLetterActionRetry retries the stage, the event is sent to the dead letter queue (or logged when
+	// there is none) once the retries are exhausted
+	DeadLetterActionRetry DeadLetterAction = "retry"
+	// DeadLetterActionHalt stops the stream
+	DeadLetterActionHalt DeadLetterAction = "halt"
+)
+
+// DeadLetterPolicy defines the action applied when a stage fails
+type DeadLetterPolicy struct {
+	Action  DeadLetterAction
+	Retries int
+}
+
+// ParseDeadLetterPolicies decodes a comma-separated list of "<stage>=<action>" policies where the action
+// is one of "log", "dlq", "halt" or "retry:<count>"
+func ParseDeadLetterPolicies(policies string) (map[string]DeadLetterPolicy, error) {
+	var result = map[string]DeadLetterPolicy{}
+	for _, policy := range strings.Split(policies, ",") {
+		policy = strings.TrimSpace(policy)
+		if policy == "" {
+			continue
+		}
+
+		stage, action, found := strings.Cut(policy, "=")
+		stage, action = strings.TrimSpace(stage), strings.TrimSpace(action)
+		switch stage {
+		case DeadLetterStageDecode, DeadLetterStageTransform, DeadLetterStageDelivery:
+		default:
+			return nil, fmt.Errorf("unknown dead letter stage %q (available: decode, transform, delivery)", stage)
+		}
+		if !found {
+			return nil, fmt.Errorf("dead letter policy %q should be formatted as <stage>=<action>", policy)
+		}
+
+		switch {
+		case action == string(DeadLetterActionLog), action == string(DeadLetterActionQueue), action == string(DeadLetterActionHalt):
+			result[stage] = DeadLetterPolicy{Action: DeadLetterAction(action)}
+		case strings.HasPrefix(action, string(DeadLetterActionRetry)+":"):
+			retries, err := strconv.Atoi(strings.TrimPrefix(action, string(DeadLetterActionRetry)+":"))
+			if err != nil || retries < 0 {
+				return nil, fmt.Errorf("invalid retry count in dead letter policy %q", policy)
+			}
+			result[stage] = DeadLetterPolicy{Action: DeadLetterActionRetry, Retries: retries}
+		default:
+			return nil, fmt.Errorf("unknown dead letter action %q (available: log, dlq, halt, retry:<count>)", action)
+		}
+	}
+	return result, nil
+}
+
+// DeadLetter is an event that failed at a stage
+type DeadLetter struct {
+	Stage string
+	// Topic of the message when the event has been transformed
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers []Header
+	Err     error
+	// Number of failed attempts, starting at 1
+	Attempts int
+}
+
+func (l *DeadLetter) headers() []Header {
+	headers := append([]Header(nil), l.Headers...)
+	headers = append(headers,
+		Header{Key: HeaderDeadLetterStage, Value: []byte(l.Stage)},
+		Header{Key: HeaderDeadLetterErrorClass, Value: []byte(errorClass(l.Err))},
+		Header{Key: HeaderDeadLetterErrorMessage, Value: []byte(l.Err.Error())},
+		Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(l.Attempts))},
+	)
+	if l.Topic != "" {
+		headers = append(headers, Header{Key: HeaderDeadLetterOriginalTopic, Value: []byte(l.Topic)})
+	}
+	return headers
+}
+
+// Returns the Kafka error code or the type of the root cause of an error
+func errorClass(err error) string {
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return "kafka.Error(" + kafkaErr.Code().String() + ")"
+	}
+	for unwrapped := errors.Unwrap(err); unwrapped != nil; unwrapped = errors.Unwrap(err) {
+		err = unwrapped
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// DeadLetterQueue publishes dead letters to a Kafka topic, or appends them to a local file
+// when the topic is not configured or Kafka is failing
+type DeadLetterQueue struct {
+	producer KafkaProducer
+	topic    string
+	file     string
+	timeout  time.Duration
+
+	mutex sync.Mutex
+}
+
+// NewDeadLetterQueue returns a dead letter queue. The producer should not be transactional,
+// it is only used when a topic is given.
+func NewDeadLetterQueue(producer KafkaProducer, topic string, file string, timeout time.Duration) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		producer: producer,
+		topic:    topic,
+		file:     file,
+		timeout:  timeout,
+	}
+}
+
+// Send publishes the dead letter, waiting for its delivery
+func (q *DeadLetterQueue) Send(letter *DeadLetter) error {
+	var err error
+	if q.topic != "" {
+		if err = q.produce(letter); err == nil || q.file == "" {
+			return err
+		}
+	}
+	if q.file != "" {
+		if writeErr := q.write(letter); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+		return nil
+	}
+	return errors.New("no dead letter topic nor file is configured")
+}
+
+func (q *DeadLetterQueue) produce(letter *DeadLetter) error {
+	deliveryChan := make(chan kafka.Event, 1)
+	message := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &q.topic, Partition: kafka.PartitionAny},
+		Key:            letter.Key,
+		Value:          letter.Value,
+		Headers:        buildHeaders(letter.headers()),
+	}
+	if err := q.producer.Produce(message, deliveryChan); err != nil {
+		return err
+	}
+
+	select {
+	case event := <-deliveryChan:
+		if delivered, ok := event.(*kafka.Message); ok {
+			return delivered.TopicPartition.Error
+		}
+		return fmt.Errorf("unexpected dead letter delivery event: %v", event)
+	case <-time.After(q.timeout):
+		return fmt.Errorf("dead letter not delivered after %s", q.timeout)
+	}
+}
+
+// deadLetterRecord is a dead letter written as a JSON line in the dead letter file
+type deadLetterRecord struct {
+	Time       time.Time         `json:"time"`
+	Stage      string            `json:"stage"`
+	ErrorClass string            `json:"error_class"`
+	Error      string            `json:"error"`
+	Attempts   int               `json:"attempts"`
+	Topic      string            `json:"topic,omitempty"`
+	Key        string            `json:"key,omitempty"`
+	Value      string            `json:"value"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+func (q *DeadLetterQueue) write(letter *DeadLetter) error {
+	record := deadLetterRecord{
+		Time:       time.Now(),
+		Stage:      letter.Stage,
+		ErrorClass: errorClass(letter.Err),
+		Error:      letter.Err.Error(),
+		Attempts:   letter.Attempts,
+		Topic:      letter.Topic,
+		Key:        string(letter.Key),
+		Value:      string(letter.Value),
+	}
+	if len(letter.Headers) > 0 {
+		record.Headers = map[string]string{}
+		for _, header := range letter.Headers {
+			record.Headers[header.Key] = string(header.Value)
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	file, err := os.OpenFile(q.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// DeadLetterDecision is what the failing stage has to do with the event
+type DeadLetterDecision int
+
+const (
+	// DeadLetterContinue means that the failure has been handled and the event skipped
+	DeadLetterContinue DeadLetterDecision = iota
+	// DeadLetterRetry means that the stage has to be attempted again
+	DeadLetterRetry
+	// DeadLetterHalt means that the stream has to stop without processing the following events
+	DeadLetterHalt
+)
+
+// DeadLetterHandler applies the stage policies to the failing events
+type DeadLetterHandler struct {
+	policies map[string]DeadLetterPolicy
+	queue    *DeadLetterQueue
+	halt     func(err error)
+	logger   logger.LoggerInterface
+	recorder metrics.PipelineRecorder
+
+	// Delay before the first retry, doubled for each following one up to the max backoff
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// DeadLetterOption allows to customize the dead letter handler
+type DeadLetterOption func(*DeadLetterHandler)
+
+// WithDeadLetterQueue allows to specify where the dead letters are sent
+func WithDeadLetterQueue(queue *DeadLetterQueue) DeadLetterOption {
+	return func(h *DeadLetterHandler) {
+		h.queue = queue
+	}
+}
+
+// WithHaltFunc allows to specify how the stream is stopped
+func WithHaltFunc(halt func(err error)) DeadLetterOption {
+	return func(h *DeadLetterHandler) {
+		h.halt = halt
+	}
+}
+
+// WithDeadLetterRecorder allows to record the failures per stage and decision
+func WithDeadLetterRecorder(recorder metrics.PipelineRecorder) DeadLetterOption {
+	return func(h *DeadLetterHandler) {
+		h.recorder = recorder
+	}
+}
+
+// WithRetryBackoff allows to wait before retrying a failed stage, the delay is doubled after each attempt
+// up to the given max backoff
+func WithRetryBackoff(backoff time.Duration, maxBackoff time.Duration) DeadLetterOption {
+	return func(h *DeadLetterHandler) {
+		h.backoff = backoff
+		h.maxBackoff = maxBackoff
+	}
+}
+
+// NewDeadLetterHandler returns a dead letter handler, failures of stages without policy are logged
+func NewDeadLetterHandler(policies map[string]DeadLetterPolicy, logger logger.LoggerInterface, options ...DeadLetterOption) *DeadLetterHandler {
+	handler := &DeadLetterHandler{
+		policies: policies,
+		logger:   logger,
+	}
+	for _, option := range options {
+		option(handler)
+	}
+	return handler
+}
+
+// Handle applies the policy of the letter stage and returns what the stage has to do with the event,
+// waiting for the retry backoff before returning a retry
+func (h *DeadLetterHandler) Handle(letter *DeadLetter) DeadLetterDecision {
+	decision, backoff := h.Decide(letter)
+	if decision == DeadLetterRetry {
+		time.Sleep(backoff)
+	}
+	return decision
+}
+
+// Decide applies the policy of the letter stage like Handle without waiting, a retry has to be attempted
+// once the returned backoff elapsed
+func (h *DeadLetterHandler) Decide(letter *DeadLetter) (DeadLetterDecision, time.Duration) {
+	decision, outcome := h.decide(letter)
+	if h.recorder != nil {
+		h.recorder.IncDeadLetterCounter(letter.Stage, outcome)
+	}
+	if decision != DeadLetterRetry {
+		return decision, 0
+	}
+	return decision, h.retryBackoff(letter.Attempts)
+}
+
+func (h *DeadLetterHandler) decide(letter *DeadLetter) (DeadLetterDecision, string) {
+	policy, ok := h.policies[letter.Stage]
+	if !ok {
+		policy.Action = DeadLetterActionLog
+	}
+
+	fields := []logger.Field{
+		logger.String("stage", letter.Stage),
+		logger.String("topic", letter.Topic),
+		logger.ByteString("key", letter.Key),
+		logger.Int64("attempts", int64(letter.Attempts)),
+		logger.Error("error", letter.Err),
+	}
+
+	switch policy.Action {
+	case DeadLetterActionRetry:
+		if letter.Attempts <= policy.Retries {
+			backoff := h.retryBackoff(letter.Attempts)
+			h.logger.Warning("Dead letter: Retrying failed event", append(fields, logger.Duration("backoff", backoff))...)
+			return DeadLetterRetry, string(DeadLetterActionRetry)
+		}
+		if h.queue == nil {
+			h.logger.Error("Dead letter: Event skipped after exhausting retries", fields...)
+			return DeadLetterContinue, string(DeadLetterActionLog)
+		}
+		fallthrough
+	case DeadLetterActionQueue:
+		if h.queue == nil {
+			return h.stop(letter, errors.New("no dead letter queue is configured"), fields)
+		}
+		if err := h.queue.Send(letter); err != nil {
+			return h.stop(letter, err, fields)
+		}
+		h.logger.Warning("Dead letter: Event sent to the dead letter queue", fields...)
+		return DeadLetterContinue, string(DeadLetterActionQueue)
+	case DeadLetterActionHalt:
+		return h.stop(letter, letter.Err, fields)
+	}
+
+	h.logger.Error("Dead letter: Event skipped", fields...)
+	return DeadLetterContinue, string(DeadLetterActionLog)
+}
+
+// Returns the delay to wait before the retry following the given attempt
+func (h *DeadLetterHandler) retryBackoff(attempts int) time.Duration {
+	backoff := h.backoff
+	for i := 1; i < attempts && backoff > 0; i++ {
+		backoff *= 2
+		if h.maxBackoff > 0 && backoff >= h.maxBackoff {
+			return h.maxBackoff
+		}
+	}
+	return backoff
+}
+
+// Stops the stream as the failing event cannot be skipped
+func (h *DeadLetterHandler) stop(letter *DeadLetter, err error, fields []logger.Field) (DeadLetterDecision, string) {
+	h.logger.Error("Dead letter: Halting the stream", append(fields, logger.Error("halt_error", err))...)
+	if h.halt != nil {
+		h.halt(fmt.Errorf("%s stage failed: %w", letter.Stage, err))
+	}
+	return DeadLetterHalt, string(DeadLetterActionHalt)
+}
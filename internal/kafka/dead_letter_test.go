@@ -0,0 +1,240 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+	"github.com/gol4ng/logger"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeadLetterPolicies(t *testing.T) {
+	// When
+	policies, err := ParseDeadLetterPolicies("decode=dlq, transform=retry:3,delivery=halt")
+
+	// Then
+	assert := assert.New(t)
+	assert.NoError(err)
+	assert.Equal(map[string]DeadLetterPolicy{
+		DeadLetterStageDecode:    {Action: DeadLetterActionQueue},
+		DeadLetterStageTransform: {Action: DeadLetterActionRetry, Retries: 3},
+		DeadLetterStageDelivery:  {Action: DeadLetterActionHalt},
+	}, policies)
+
+	policies, err = ParseDeadLetterPolicies("")
+	assert.NoError(err)
+	assert.Len(policies, 0)
+}
+
+func TestParseDeadLetterPoliciesWhenInvalid(t *testing.T) {
+	for _, policies := range []string{"unknown=dlq", "decode", "decode=skip", "decode=retry:x", "decode=retry:-1"} {
+		_, err := ParseDeadLetterPolicies(policies)
+		assert.Error(t, err, policies)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("kafka.Error(Local: Message timed out)", errorClass(fmt.Errorf("wrapped: %w", kafkaconfluent.NewError(kafkaconfluent.ErrMsgTimedOut, "timed out", false))))
+	assert.Equal("*json.SyntaxError", errorClass(fmt.Errorf("wrapped: %w", &json.SyntaxError{})))
+	assert.Equal("*errors.errorString", errorClass(errors.New("failure")))
+}
+
+func giveDeadLetter(stage string, attempts int) *DeadLetter {
+	return &DeadLetter{
+		Stage:    stage,
+		Topic:    "my-topic",
+		Key:      []byte("my-key"),
+		Value:    []byte(`{"hello":"world"}`),
+		Headers:  []Header{{Key: "x-mongo-operation", Value: []byte("insert")}},
+		Err:      errors.New("failure"),
+		Attempts: attempts,
+	}
+}
+
+func TestDeadLetterHandlerWithoutPolicyLogs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	recorder := metrics.NewMockPipelineRecorder(ctrl)
+	recorder.EXPECT().IncDeadLetterCounter(DeadLetterStageDecode, "log")
+
+	handler := NewDeadLetterHandler(nil, logger.NewNopLogger(), WithDeadLetterRecorder(recorder))
+
+	// When - Then
+	assert.Equal(t, DeadLetterContinue, handler.Handle(giveDeadLetter(DeadLetterStageDecode, 1)))
+}
+
+func TestDeadLetterHandlerRetries(t *testing.T) {
+	// Given
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageTransform: {Action: DeadLetterActionRetry, Retries: 2},
+	}, logger.NewNopLogger())
+
+	// When - Then
+	assert := assert.New(t)
+	assert.Equal(DeadLetterRetry, handler.Handle(giveDeadLetter(DeadLetterStageTransform, 1)))
+	assert.Equal(DeadLetterRetry, handler.Handle(giveDeadLetter(DeadLetterStageTransform, 2)))
+	// Retries are exhausted and there is no dead letter queue
+	assert.Equal(DeadLetterContinue, handler.Handle(giveDeadLetter(DeadLetterStageTransform, 3)))
+}
+
+func TestDeadLetterHandlerHalts(t *testing.T) {
+	// Given
+	var haltErr error
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDelivery: {Action: DeadLetterActionHalt},
+	}, logger.NewNopLogger(), WithHaltFunc(func(err error) { haltErr = err }))
+
+	// When
+	decision := handler.Handle(giveDeadLetter(DeadLetterStageDelivery, 1))
+
+	// Then
+	assert := assert.New(t)
+	assert.Equal(DeadLetterHalt, decision)
+	assert.EqualError(haltErr, "delivery stage failed: failure")
+}
+
+func TestDeadLetterHandlerHaltsWhenNoQueue(t *testing.T) {
+	// Given
+	var halted bool
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDecode: {Action: DeadLetterActionQueue},
+	}, logger.NewNopLogger(), WithHaltFunc(func(err error) { halted = true }))
+
+	// When - Then
+	assert.Equal(t, DeadLetterHalt, handler.Handle(giveDeadLetter(DeadLetterStageDecode, 1)))
+	assert.True(t, halted)
+}
+
+func TestDeadLetterQueueWritesFile(t *testing.T) {
+	// Given
+	file := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	queue := NewDeadLetterQueue(nil, "", file, time.Second)
+
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageTransform: {Action: DeadLetterActionRetry, Retries: 1},
+	}, logger.NewNopLogger(), WithDeadLetterQueue(queue))
+
+	// When
+	decision := handler.Handle(giveDeadLetter(DeadLetterStageTransform, 2))
+
+	// Then
+	assert := assert.New(t)
+	assert.Equal(DeadLetterContinue, decision)
+
+	content, err := os.ReadFile(file)
+	assert.NoError(err)
+
+	var record deadLetterRecord
+	assert.NoError(json.Unmarshal([]byte(strings.TrimSpace(string(content))), &record))
+	assert.Equal("transform", record.Stage)
+	assert.Equal("*errors.errorString", record.ErrorClass)
+	assert.Equal("failure", record.Error)
+	assert.Equal(2, record.Attempts)
+	assert.Equal("my-topic", record.Topic)
+	assert.Equal("my-key", record.Key)
+	assert.Equal(`{"hello":"world"}`, record.Value)
+	assert.Equal(map[string]string{"x-mongo-operation": "insert"}, record.Headers)
+}
+
+func TestDeadLetterQueueProducesToTopic(t *testing.T) {
+	cluster, err := kafkaconfluent.NewMockCluster(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	producer, err := kafkaconfluent.NewProducer(&kafkaconfluent.ConfigMap{"bootstrap.servers": cluster.BootstrapServers()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	// Given
+	queue := NewDeadLetterQueue(producer, "my-topic.dlq", "", 10*time.Second)
+
+	// When
+	err = queue.Send(giveDeadLetter(DeadLetterStageDecode, 1))
+
+	// Then
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	consumer, err := kafkaconfluent.NewConsumer(&kafkaconfluent.ConfigMap{
+		"bootstrap.servers": cluster.BootstrapServers(),
+		"group.id":          "test",
+		"auto.offset.reset": "earliest",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	assert.NoError(consumer.Subscribe("my-topic.dlq", nil))
+
+	message, err := consumer.ReadMessage(10 * time.Second)
+	if !assert.NoError(err) {
+		return
+	}
+
+	headers := map[string]string{}
+	for _, header := range message.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	assert.Equal([]byte("my-key"), message.Key)
+	assert.Equal([]byte(`{"hello":"world"}`), message.Value)
+	assert.Equal(map[string]string{
+		"x-mongo-operation":    "insert",
+		"x-dlq-stage":          "decode",
+		"x-dlq-error-class":    "*errors.errorString",
+		"x-dlq-error-message":  "failure",
+		"x-dlq-attempts":       "1",
+		"x-dlq-original-topic": "my-topic",
+	}, headers)
+}
+
+func TestDeadLetterQueueFallsBackToFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	producer := NewMockKafkaProducer(ctrl)
+	producer.EXPECT().Produce(gomock.Any(), gomock.Any()).Return(kafkaconfluent.NewError(kafkaconfluent.ErrQueueFull, "queue full", false))
+
+	file := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	queue := NewDeadLetterQueue(producer, "my-topic.dlq", file, time.Second)
+
+	// When
+	err := queue.Send(giveDeadLetter(DeadLetterStageDelivery, 1))
+
+	// Then
+	assert := assert.New(t)
+	assert.NoError(err)
+	content, err := os.ReadFile(file)
+	assert.NoError(err)
+	assert.Contains(string(content), `"stage":"delivery"`)
+}
+
+func TestDeadLetterHandlerRetryBackoff(t *testing.T) {
+	// Given
+	handler := NewDeadLetterHandler(nil, logger.NewNopLogger(), WithRetryBackoff(100*time.Millisecond, time.Second))
+
+	// When - Then
+	assert := assert.New(t)
+	assert.Equal(100*time.Millisecond, handler.retryBackoff(1))
+	assert.Equal(200*time.Millisecond, handler.retryBackoff(2))
+	assert.Equal(800*time.Millisecond, handler.retryBackoff(4))
+	assert.Equal(time.Second, handler.retryBackoff(5))
+	assert.Equal(time.Second, handler.retryBackoff(50))
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"errors"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Duration the producer is flushed for when its local queue is full, before producing again
+const queueFullWait = 100 * time.Millisecond
+
+// Delivery is set as the opaque of the produced Kafka messages so that their delivery reports can be
+// matched back to the message, and the change event it has been built from
+type Delivery struct {
+	Message *Message
+	// Number of times the message has been produced, starting at 1
+	Attempts int
+	// Position of the message in the produced stream, starting at 1
+	Sequence uint64
+
+	// The failed delivery is not over yet: the message is produced again or the stream halted
+	unresolved bool
+}
+
+// MarkUnresolved tells the subscribers of the failed delivery report that the failure is not over: the
+// checkpoint is held back at the message, which is produced again or halted the stream
+func (d *Delivery) MarkUnresolved() {
+	d.unresolved = true
+}
+
+// DeliveryOf returns the delivery of a delivery report, nil when the message has not been produced by a client
+func DeliveryOf(report *kafka.Message) *Delivery {
+	delivery, _ := report.Opaque.(*Delivery)
+	return delivery
+}
+
+// Produces the message, blocking until the producer local queue has room for it
+func produceBlocking(producer KafkaProducer, message *kafka.Message, wait time.Duration) error {
+	for {
+		err := producer.Produce(message, nil)
+
+		var kafkaErr kafka.Error
+		if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrQueueFull {
+			producer.Flush(int(wait.Milliseconds()))
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// DeliverySubscriber receives the producer events fanned out by a Dispatcher
+type DeliverySubscriber interface {
+	// OnDelivery is called when a message has been delivered
+	OnDelivery(report *kafka.Message)
+	// OnDeliveryFailure is called when a message could not be delivered, once librdkafka gave up retrying
+	OnDeliveryFailure(report *kafka.Message, err error)
+	// OnError is called for the errors that are not related to a message
+	OnError(err kafka.Error)
+	// OnStats is called with the statistics emitted every "statistics.interval.ms"
+	OnStats(stats *kafka.Stats)
+}
+
+// DeliverySubscriberFuncs is a DeliverySubscriber calling the defined functions, the others events are ignored
+type DeliverySubscriberFuncs struct {
+	Delivery        func(report *kafka.Message)
+	DeliveryFailure func(report *kafka.Message, err error)
+	Error           func(err kafka.Error)
+	Stats           func(stats *kafka.Stats)
+}
+
+// OnDelivery calls the Delivery function, if any
+func (s DeliverySubscriberFuncs) OnDelivery(report *kafka.Message) {
+	if s.Delivery != nil {
+		s.Delivery(report)
+	}
+}
+
+// OnDeliveryFailure calls the DeliveryFailure function, if any
+func (s DeliverySubscriberFuncs) OnDeliveryFailure(report *kafka.Message, err error) {
+	if s.DeliveryFailure != nil {
+		s.DeliveryFailure(report, err)
+	}
+}
+
+// OnError calls the Error function, if any
+func (s DeliverySubscriberFuncs) OnError(err kafka.Error) {
+	if s.Error != nil {
+		s.Error(err)
+	}
+}
+
+// OnStats calls the Stats function, if any
+func (s DeliverySubscriberFuncs) OnStats(stats *kafka.Stats) {
+	if s.Stats != nil {
+		s.Stats(stats)
+	}
+}
+
+// Dispatcher is the single reader of the producer events, it fans them out to the subscribers
+// in their subscription order
+type Dispatcher struct {
+	events chan kafka.Event
+	done   chan struct{}
+
+	mutex       sync.RWMutex
+	subscribers []DeliverySubscriber
+}
+
+// NewDispatcher returns a dispatcher of the given producer events, they are consumed once Run is called
+func NewDispatcher(events chan kafka.Event) *Dispatcher {
+	return &Dispatcher{
+		events: events,
+		done:   make(chan struct{}),
+	}
+}
+
+// Subscribe registers a subscriber, it only receives the events dispatched after its subscription
+func (d *Dispatcher) Subscribe(subscriber DeliverySubscriber) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.subscribers = append(d.subscribers, subscriber)
+}
+
+// Run dispatches the events until the producer events channel is closed
+func (d *Dispatcher) Run() {
+	defer close(d.done)
+
+	for event := range d.events {
+		d.dispatch(event)
+	}
+}
+
+// Done returns a channel closed once all the events have been dispatched
+func (d *Dispatcher) Done() <-chan struct{} {
+	return d.done
+}
+
+func (d *Dispatcher) dispatch(event kafka.Event) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	for _, subscriber := range d.subscribers {
+		switch ev := event.(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				subscriber.OnDeliveryFailure(ev, ev.TopicPartition.Error)
+			} else {
+				subscriber.OnDelivery(ev)
+			}
+		case kafka.Error:
+			subscriber.OnError(ev)
+		case *kafka.Stats:
+			subscriber.OnStats(ev)
+		}
+	}
+}
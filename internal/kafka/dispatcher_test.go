@@ -0,0 +1,72 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcherFansOutEvents(t *testing.T) {
+	// Given
+	topic := "my-topic"
+	delivered := &kafkaconfluent.Message{TopicPartition: kafkaconfluent.TopicPartition{Topic: &topic}}
+	failed := &kafkaconfluent.Message{TopicPartition: kafkaconfluent.TopicPartition{Topic: &topic, Error: errors.New("failure")}}
+	producerErr := kafkaconfluent.NewError(kafkaconfluent.ErrAllBrokersDown, "all brokers down", false)
+	stats := &kafkaconfluent.Stats{}
+
+	events := make(chan kafkaconfluent.Event, 4)
+	events <- delivered
+	events <- failed
+	events <- producerErr
+	events <- stats
+	close(events)
+
+	var calls [2][]string
+	subscriber := func(index int) DeliverySubscriber {
+		return DeliverySubscriberFuncs{
+			Delivery: func(report *kafkaconfluent.Message) {
+				assert.Equal(t, delivered, report)
+				calls[index] = append(calls[index], "delivery")
+			},
+			DeliveryFailure: func(report *kafkaconfluent.Message, err error) {
+				assert.Equal(t, failed, report)
+				assert.EqualError(t, err, "failure")
+				calls[index] = append(calls[index], "failure")
+			},
+			Error: func(err kafkaconfluent.Error) {
+				assert.Equal(t, producerErr, err)
+				calls[index] = append(calls[index], "error")
+			},
+			Stats: func(s *kafkaconfluent.Stats) {
+				assert.Equal(t, stats, s)
+				calls[index] = append(calls[index], "stats")
+			},
+		}
+	}
+
+	dispatcher := NewDispatcher(events)
+	dispatcher.Subscribe(subscriber(0))
+	dispatcher.Subscribe(subscriber(1))
+
+	// When
+	go dispatcher.Run()
+	<-dispatcher.Done()
+
+	// Then
+	for _, subscriberCalls := range calls {
+		assert.Equal(t, []string{"delivery", "failure", "error", "stats"}, subscriberCalls)
+	}
+}
+
+func TestDeliverySubscriberFuncsIgnoresUndefinedFunctions(t *testing.T) {
+	subscriber := DeliverySubscriberFuncs{}
+
+	assert.NotPanics(t, func() {
+		subscriber.OnDelivery(&kafkaconfluent.Message{})
+		subscriber.OnDeliveryFailure(&kafkaconfluent.Message{}, errors.New("failure"))
+		subscriber.OnError(kafkaconfluent.Error{})
+		subscriber.OnStats(&kafkaconfluent.Stats{})
+	})
+}
@@ -0,0 +1,210 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+)
+
+type deadLetterMiddleware struct {
+	producer   KafkaProducer
+	partitions *PartitionCounter
+	handler    *DeadLetterHandler
+
+	// Set once a failed delivery halted the stream, the following messages are not produced anymore
+	// so that no checkpoint after the failed message is delivered
+	halted atomic.Bool
+
+	// Retries waiting for their backoff or being queued, closing waits for them
+	mutex   sync.Mutex
+	idle    *sync.Cond
+	pending int
+	closing bool
+}
+
+// NewDeadLetterMiddleware returns a client pipeline stage that applies the delivery stage dead letter
+// policy to the messages that cannot be produced, and to the messages whose delivery failed once its
+// subscriber is registered on the dispatcher. Failed deliveries are retried using the given producer,
+// which has to be the one of the original client, to the partition computed as the client does with the
+// given partition counter. They can be nil when the client never reports a failed delivery, such as the
+// sinks acknowledging the messages once written.
+// Failed deliveries are retried once their backoff elapsed, after the messages produced in between:
+// a retry gives up the ordering of the messages sharing its key.
+func NewDeadLetterMiddleware(producer KafkaProducer, partitions *PartitionCounter, handler *DeadLetterHandler) *deadLetterMiddleware {
+	m := &deadLetterMiddleware{
+		producer:   producer,
+		partitions: partitions,
+		handler:    handler,
+	}
+	m.idle = sync.NewCond(&m.mutex)
+
+	return m
+}
+
+// Subscriber returns the dispatcher subscriber handling the failed deliveries
+func (m *deadLetterMiddleware) Subscriber() DeliverySubscriber {
+	return DeliverySubscriberFuncs{
+		DeliveryFailure: func(report *kafka.Message, _ error) {
+			m.handleFailure(report)
+		},
+	}
+}
+
+func (m *deadLetterMiddleware) handleFailure(message *kafka.Message) {
+	delivery := DeliveryOf(message)
+	if delivery == nil {
+		delivery = &Delivery{Attempts: 1}
+	}
+	report := delivery
+	if m.halted.Load() {
+		// The messages in flight when the stream has been halted are not handled anymore
+		report.unresolved = true
+		return
+	}
+
+	letter := &DeadLetter{
+		Stage:    DeadLetterStageDelivery,
+		Key:      message.Key,
+		Value:    message.Value,
+		Err:      message.TopicPartition.Error,
+		Attempts: delivery.Attempts,
+	}
+	if message.TopicPartition.Topic != nil {
+		letter.Topic = *message.TopicPartition.Topic
+	}
+	for _, header := range message.Headers {
+		letter.Headers = append(letter.Headers, Header{Key: header.Key, Value: header.Value})
+	}
+
+	decision, backoff := m.handler.Decide(letter)
+	switch decision {
+	case DeadLetterHalt:
+		m.halted.Store(true)
+		report.unresolved = true
+		return
+	case DeadLetterContinue:
+		return
+	}
+
+	// The retry waits for its backoff off the dispatcher goroutine so that the reports of the other
+	// messages are not held back. It is produced after the messages following the failed one.
+	report.unresolved = true
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closing {
+		// The client is flushing its last messages, the failed one holds the checkpoint back
+		m.handler.logger.Warning("Dead letter: Failed delivery not retried while closing", logger.String("topic", letter.Topic), logger.ByteString("key", letter.Key))
+		return
+	}
+	m.pending++
+	time.AfterFunc(backoff, func() {
+		defer m.done()
+		m.retry(message, delivery, letter)
+	})
+}
+
+func (m *deadLetterMiddleware) done() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pending--
+	if m.pending == 0 {
+		m.idle.Broadcast()
+	}
+}
+
+// Close waits for the pending retries to be queued, so that closing the client flushes them. The
+// deliveries failing afterwards are not retried anymore.
+func (m *deadLetterMiddleware) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closing = true
+	for m.pending > 0 {
+		m.idle.Wait()
+	}
+	return nil
+}
+
+// Produces the failed message again, until it is queued or the stream is halted
+func (m *deadLetterMiddleware) retry(message *kafka.Message, delivery *Delivery, letter *DeadLetter) {
+	for !m.halted.Load() {
+		retry := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: message.TopicPartition.Topic, Partition: kafka.PartitionAny},
+			Key:            message.Key,
+			Value:          message.Value,
+			Headers:        message.Headers,
+			Timestamp:      message.Timestamp,
+			TimestampType:  message.TimestampType,
+			Opaque:         &Delivery{Message: delivery.Message, Attempts: delivery.Attempts + 1, Sequence: delivery.Sequence},
+		}
+		err := m.partition(retry, delivery.Message)
+		if err == nil {
+			err = produceBlocking(m.producer, retry, queueFullWait)
+		}
+		if err == nil {
+			return
+		}
+
+		// The message could not even be queued, the failure is handled as a new attempt
+		delivery = retry.Opaque.(*Delivery)
+		letter.Err = err
+		letter.Attempts = delivery.Attempts
+		if m.handler.Handle(letter) != DeadLetterRetry {
+			// The failed delivery has already been reported as unresolved, skipping the message would
+			// hold the checkpoint back forever
+			m.halted.Store(true)
+		}
+	}
+}
+
+// Sets the partition of the retried message as the client did, the producer partitioner chooses it
+// from the key when the message is unknown
+func (m *deadLetterMiddleware) partition(retry *kafka.Message, message *Message) error {
+	if message == nil {
+		return nil
+	}
+	partition, err := messagePartition(message, m.partitions)
+	if err != nil {
+		return err
+	}
+	retry.TopicPartition.Partition = partition
+	return nil
+}
+
+// Wrap produces the message until a failure halts the stream, the policy is applied when the message
+// cannot be produced
+func (m *deadLetterMiddleware) Wrap(next ProduceFunc) ProduceFunc {
+	return func(ctx context.Context, message *Message) error {
+		if m.halted.Load() {
+			return ErrStreamHalted
+		}
+
+		err := next(ctx, message)
+		letter := &DeadLetter{
+			Stage:   DeadLetterStageDelivery,
+			Topic:   message.Topic,
+			Key:     message.Key,
+			Value:   message.Value,
+			Headers: message.Headers,
+		}
+		for attempts := 1; err != nil; attempts++ {
+			letter.Err = err
+			letter.Attempts = attempts
+
+			switch m.handler.Handle(letter) {
+			case DeadLetterHalt:
+				m.halted.Store(true)
+				return fmt.Errorf("%w: %w", ErrStreamHalted, err)
+			case DeadLetterContinue:
+				return nil
+			}
+			err = next(ctx, message)
+		}
+
+		return nil
+	}
+}
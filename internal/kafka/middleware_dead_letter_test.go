@@ -0,0 +1,206 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func giveFailedDelivery(opaque interface{}) *kafkaconfluent.Message {
+	topic := "my-topic"
+	return &kafkaconfluent.Message{
+		TopicPartition: kafkaconfluent.TopicPartition{Topic: &topic, Partition: 2, Error: errors.New("failure")},
+		Key:            []byte("my-key"),
+		Value:          []byte("my-value"),
+		Opaque:         opaque,
+	}
+}
+
+func TestDeadLetterMiddlewareRetriesFailedDeliveries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	partition := int32(4)
+	message := &Message{Topic: "my-topic", Partition: &partition}
+	first := &Delivery{Message: message, Attempts: 1, Sequence: 3}
+	second := &Delivery{Message: message, Attempts: 2, Sequence: 3}
+
+	retried := make(chan *kafkaconfluent.Message, 2)
+	producer := NewMockKafkaProducer(ctrl)
+	producer.EXPECT().Produce(gomock.Any(), nil).DoAndReturn(func(message *kafkaconfluent.Message, _ chan kafkaconfluent.Event) error {
+		retried <- message
+		return nil
+	})
+
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDelivery: {Action: DeadLetterActionRetry, Retries: 1},
+	}, logger.NewNopLogger(), WithRetryBackoff(50*time.Millisecond, time.Second))
+
+	middleware := NewDeadLetterMiddleware(producer, nil, handler)
+
+	// When
+	start := time.Now()
+	middleware.Subscriber().OnDeliveryFailure(giveFailedDelivery(first), errors.New("failure"))
+	middleware.Subscriber().OnDeliveryFailure(giveFailedDelivery(second), errors.New("failure"))
+	elapsed := time.Since(start)
+
+	// Then
+	assert := assert.New(t)
+	assert.Less(elapsed, 50*time.Millisecond, "the dispatcher does not wait for the retry backoff")
+	assert.True(first.unresolved, "the message is produced again")
+	assert.False(second.unresolved, "the message is skipped")
+
+	// The second failure exhausted the retries
+	var retry *kafkaconfluent.Message
+	select {
+	case retry = <-retried:
+	case <-time.After(time.Second):
+		t.Fatal("the message is not produced again")
+	}
+	assert.GreaterOrEqual(time.Since(start), 50*time.Millisecond, "the retry waits for its backoff")
+	assert.Equal("my-topic", *retry.TopicPartition.Topic)
+	assert.Equal(int32(4), retry.TopicPartition.Partition, "the partition of the message is kept")
+	assert.Nil(retry.TopicPartition.Error)
+	assert.Equal([]byte("my-value"), retry.Value)
+	assert.Equal(&Delivery{Message: message, Attempts: 2, Sequence: 3}, DeliveryOf(retry))
+}
+
+func TestDeadLetterMiddlewareHaltsWhenRetryCannotBeQueued(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	producer := NewMockKafkaProducer(ctrl)
+	producer.EXPECT().Produce(gomock.Any(), nil).Return(errors.New("producer closed"))
+
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDelivery: {Action: DeadLetterActionRetry, Retries: 1},
+	}, logger.NewNopLogger())
+
+	middleware := NewDeadLetterMiddleware(producer, nil, handler)
+	produce := middleware.Wrap(func(_ context.Context, message *Message) error {
+		return nil
+	})
+
+	delivery := &Delivery{Attempts: 1, Sequence: 1}
+
+	// When
+	middleware.Subscriber().OnDeliveryFailure(giveFailedDelivery(delivery), errors.New("failure"))
+
+	// Then
+	assert.True(t, delivery.unresolved)
+	assert.Eventually(t, func() bool {
+		return errors.Is(produce(context.Background(), &Message{Topic: "my-topic"}), ErrStreamHalted)
+	}, time.Second, 10*time.Millisecond, "the skipped retry would hold the checkpoint back")
+}
+
+func TestDeadLetterMiddlewareCloseWaitsForPendingRetries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	var retried atomic.Bool
+	producer := NewMockKafkaProducer(ctrl)
+	producer.EXPECT().Produce(gomock.Any(), nil).DoAndReturn(func(_ *kafkaconfluent.Message, _ chan kafkaconfluent.Event) error {
+		retried.Store(true)
+		return nil
+	})
+
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDelivery: {Action: DeadLetterActionRetry, Retries: 2},
+	}, logger.NewNopLogger(), WithRetryBackoff(50*time.Millisecond, time.Second))
+
+	middleware := NewDeadLetterMiddleware(producer, nil, handler)
+	middleware.Subscriber().OnDeliveryFailure(giveFailedDelivery(&Delivery{Attempts: 1, Sequence: 1}), errors.New("failure"))
+
+	// When
+	assert.NoError(t, middleware.Close())
+
+	// Then
+	assert.True(t, retried.Load(), "the pending retry is queued before the client is closed")
+
+	delivery := &Delivery{Attempts: 1, Sequence: 2}
+	middleware.Subscriber().OnDeliveryFailure(giveFailedDelivery(delivery), errors.New("failure"))
+	assert.True(t, delivery.unresolved, "the failures reported while closing are not retried")
+}
+
+func TestDeadLetterMiddlewareStopsProducingWhenHalted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDelivery: {Action: DeadLetterActionHalt},
+	}, logger.NewNopLogger())
+
+	middleware := NewDeadLetterMiddleware(NewMockKafkaProducer(ctrl), nil, handler)
+
+	delivery := &Delivery{Attempts: 1, Sequence: 1}
+	middleware.Subscriber().OnDeliveryFailure(giveFailedDelivery(delivery), errors.New("failure"))
+	assert.True(t, delivery.unresolved)
+
+	var produced []*Message
+	produce := middleware.Wrap(func(_ context.Context, message *Message) error {
+		produced = append(produced, message)
+		return nil
+	})
+
+	// When
+	err := produce(context.Background(), &Message{Topic: "my-topic"})
+
+	// Then
+	assert.ErrorIs(t, err, ErrStreamHalted)
+	assert.Len(t, produced, 0, "no message is produced after the failed one")
+}
+
+func TestDeadLetterMiddlewareRetriesMessagesThatCannotBeProduced(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDelivery: {Action: DeadLetterActionRetry, Retries: 1},
+	}, logger.NewNopLogger())
+
+	attempts := 0
+	produce := NewDeadLetterMiddleware(NewMockKafkaProducer(ctrl), nil, handler).Wrap(func(_ context.Context, message *Message) error {
+		attempts++
+		return errors.New("too large")
+	})
+
+	// When
+	err := produce(context.Background(), &Message{Topic: "my-topic"})
+
+	// Then
+	assert.NoError(t, err, "the message is skipped once the retries are exhausted")
+	assert.Equal(t, 2, attempts)
+}
+
+func TestDeadLetterMiddlewareHaltsWhenMessageCannotBeProduced(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	handler := NewDeadLetterHandler(map[string]DeadLetterPolicy{
+		DeadLetterStageDelivery: {Action: DeadLetterActionHalt},
+	}, logger.NewNopLogger())
+
+	produce := NewDeadLetterMiddleware(NewMockKafkaProducer(ctrl), nil, handler).Wrap(func(_ context.Context, message *Message) error {
+		return errors.New("too large")
+	})
+
+	// When
+	err := produce(context.Background(), &Message{Topic: "my-topic"})
+
+	// Then
+	assert.ErrorIs(t, err, ErrStreamHalted)
+	assert.ErrorContains(t, err, "too large")
+}
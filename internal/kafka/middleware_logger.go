@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+)
+
+type loggerMiddleware struct {
+	logger logger.LoggerInterface
+}
+
+// NewLoggerMiddleware returns a client pipeline stage that logs the produced messages
+func NewLoggerMiddleware(logger logger.LoggerInterface) *loggerMiddleware {
+	return &loggerMiddleware{
+		logger: logger,
+	}
+}
+
+// Subscriber returns the dispatcher subscriber logging the delivery results and producer errors
+func (m *loggerMiddleware) Subscriber() DeliverySubscriber {
+	return DeliverySubscriberFuncs{
+		Delivery: func(report *kafka.Message) {
+			m.logger.Debug("Kafka client: Message delivered", logger.String("topic", *report.TopicPartition.Topic), logger.Int32("partition", report.TopicPartition.Partition), logger.Int64("offset", int64(report.TopicPartition.Offset)), logger.ByteString("key", report.Key))
+		},
+		DeliveryFailure: func(report *kafka.Message, err error) {
+			m.logger.Error("Kafka client: Message delivery failed", logger.String("topic", *report.TopicPartition.Topic), logger.ByteString("key", report.Key), logger.Error("error", err))
+		},
+		Error: func(err kafka.Error) {
+			m.logger.Error("Kafka client: Producer error", logger.String("code", err.Code().String()), logger.Error("error", err))
+		},
+	}
+}
+
+// Wrap logs the message production information and then produces it
+func (m *loggerMiddleware) Wrap(next ProduceFunc) ProduceFunc {
+	return func(ctx context.Context, message *Message) error {
+		m.logger.Info("Kafka client: Producing message", logger.String("topic", message.Topic), logger.ByteString("key", message.Key), logger.ByteString("value", message.Value))
+		return next(ctx, message)
+	}
+}
@@ -0,0 +1,41 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLoggerMiddleware(t *testing.T) {
+	// Given
+	logger := logger.NewNopLogger()
+
+	// When
+	middleware := NewLoggerMiddleware(logger)
+
+	// Then
+	assert.IsType(t, new(loggerMiddleware), middleware)
+	assert.Equal(t, logger, middleware.logger)
+}
+
+func TestLoggerMiddlewareWrap(t *testing.T) {
+	// Given
+	message := &Message{Topic: "test-topic"}
+	produceErr := errors.New("failure")
+
+	var produced *Message
+	produce := NewLoggerMiddleware(logger.NewNopLogger()).Wrap(func(_ context.Context, message *Message) error {
+		produced = message
+		return produceErr
+	})
+
+	// When
+	err := produce(context.Background(), message)
+
+	// Then
+	assert.Equal(t, message, produced)
+	assert.Equal(t, produceErr, err)
+}
@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+)
+
+type metricMiddleware struct {
+	recorder metrics.KafkaRecorder
+}
+
+// NewMetricMiddleware returns a client pipeline stage that records the produced messages metrics
+func NewMetricMiddleware(recorder metrics.KafkaRecorder) *metricMiddleware {
+	return &metricMiddleware{
+		recorder: recorder,
+	}
+}
+
+// Subscriber returns the dispatcher subscriber recording the delivery results
+func (m *metricMiddleware) Subscriber() DeliverySubscriber {
+	return DeliverySubscriberFuncs{
+		Delivery: func(report *kafka.Message) {
+			m.recorder.IncKafkaProducerSuccessCounter(*report.TopicPartition.Topic)
+		},
+		DeliveryFailure: func(report *kafka.Message, _ error) {
+			m.recorder.IncKafkaProducerErrorCounter(*report.TopicPartition.Topic)
+		},
+	}
+}
+
+// Wrap counts the message and then produces it
+func (m *metricMiddleware) Wrap(next ProduceFunc) ProduceFunc {
+	return func(ctx context.Context, message *Message) error {
+		m.recorder.IncKafkaClientProduceCounter(message.Topic)
+		return next(ctx, message)
+	}
+}
@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetricMiddleware(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	recorder := metrics.NewMockKafkaRecorder(ctrl)
+
+	// When
+	middleware := NewMetricMiddleware(recorder)
+
+	// Then
+	assert.IsType(t, new(metricMiddleware), middleware)
+	assert.Equal(t, recorder, middleware.recorder)
+}
+
+func TestMetricMiddlewareWrap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	message := &Message{Topic: "test-topic"}
+	produceErr := errors.New("failure")
+
+	recorder := metrics.NewMockKafkaRecorder(ctrl)
+	recorder.EXPECT().IncKafkaClientProduceCounter("test-topic")
+
+	var produced *Message
+	produce := NewMetricMiddleware(recorder).Wrap(func(_ context.Context, message *Message) error {
+		produced = message
+		return produceErr
+	})
+
+	// When
+	err := produce(context.Background(), message)
+
+	// Then
+	assert.Equal(t, message, produced)
+	assert.Equal(t, produceErr, err)
+}
+
+func TestMetricMiddlewareSubscriber(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	topic := "test-topic"
+	report := &kafkaconfluent.Message{TopicPartition: kafkaconfluent.TopicPartition{Topic: &topic}}
+
+	recorder := metrics.NewMockKafkaRecorder(ctrl)
+	recorder.EXPECT().IncKafkaProducerSuccessCounter("test-topic")
+	recorder.EXPECT().IncKafkaProducerErrorCounter("test-topic")
+
+	middleware := NewMetricMiddleware(recorder)
+
+	// When - Then
+	middleware.Subscriber().OnDelivery(report)
+	middleware.Subscriber().OnDeliveryFailure(report, errors.New("failure"))
+}
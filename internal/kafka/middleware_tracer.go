@@ -0,0 +1,36 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/config"
+)
+
+// XTracingHeaderName corresponds to the X-Tracing header to is sent in Kafka messages
+// with some tracing information
+const XTracingHeaderName = "x-tracing"
+
+// AddTracingHeader simply adds a tracing header with application name and a timestamp
+// to enable simple debugging
+func AddTracingHeader(message *Message) {
+	now := time.Now()
+
+	message.Headers = append(message.Headers, Header{
+		Key:   XTracingHeaderName,
+		Value: []byte(fmt.Sprintf(`%s,%d`, config.AppName, now.Unix())),
+	})
+}
+
+type tracerFunc func(message *Message)
+
+// NewTracerMiddleware returns a client pipeline stage that adds trace information on the messages
+func NewTracerMiddleware(fn tracerFunc) MiddlewareFunc {
+	return func(next ProduceFunc) ProduceFunc {
+		return func(ctx context.Context, message *Message) error {
+			fn(message)
+			return next(ctx, message)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type TrackerMock struct {
+	mock.Mock
+}
+
+func (t *TrackerMock) Function(msg *Message) {
+	t.Called(msg)
+}
+
+func TestTracerMiddlewareWrap(t *testing.T) {
+	// Given
+	message := &Message{
+		Topic: "test-topic",
+	}
+
+	var tracerMock TrackerMock
+	tracerMock.On("Function", message)
+
+	var produced *Message
+	produce := NewTracerMiddleware(tracerMock.Function).Wrap(func(_ context.Context, message *Message) error {
+		produced = message
+		return nil
+	})
+
+	// When
+	err := produce(context.Background(), message)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, message, produced)
+	tracerMock.AssertExpectations(t)
+}
+
+func TestAddTracingHeader(t *testing.T) {
+	// Given
+	messageTest := &Message{
+		Headers: []Header{
+			Header{Key: "test-key1", Value: []byte(`my-test-value1`)},
+			Header{Key: "test-key2", Value: []byte(`my-test-value2`)},
+		},
+	}
+
+	// Then
+	AddTracingHeader(messageTest)
+
+	// Then
+	assert.Equal(t, "x-tracing", messageTest.Headers[2].Key)
+	assert.Regexp(t, `kafka-mongo-watcher,\d*`, string(messageTest.Headers[2].Value))
+}
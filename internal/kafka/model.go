@@ -1,11 +1,35 @@
 package kafka
 
-// Message is used over a channel that is filled by kafka transformer
+import "time"
+
+// Message is used over a channel that is filled by kafka transformer. A message without topic is a
+// checkpoint marker: it is not produced, it only carries the checkpoint of change events that produced
+// no message.
 type Message struct {
-	Headers []Header
-	Topic   string
-	Key     []byte
-	Value   []byte
+	Headers   []Header
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Timestamp time.Time // Zero value lets the producer set the timestamp
+
+	// Explicit partition of the message, nil lets the producer partitioner choose it from the key
+	Partition *int32
+	// Bytes hashed as the Java producer does to choose the partition instead of the key, when there
+	// is no explicit partition (nil when the producer partitioner hashes the key)
+	PartitionKey []byte
+
+	// Extended JSON resume token of the change stream position that is safe to resume from
+	// once the message is delivered (nil when there is none yet)
+	Checkpoint []byte
+
+	// Identifier of the Mongo transaction of the message (empty when there is none), the messages of
+	// a Mongo transaction are committed together by the transactional client
+	Transaction string
+	// The message is the last one of its Mongo transaction
+	TransactionEnd bool
+
+	// Change event the message has been built from, matched back from the delivery reports
+	Event interface{}
 }
 
 // Header represents a message header
@@ -0,0 +1,173 @@
+package kafka
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Producer partitioners choosing the partition from the message key
+const (
+	// Java producer compatible hash, messages without key are spread randomly
+	PartitionerMurmur2Random = "murmur2_random"
+	// Java producer compatible hash, messages without key go to a same partition
+	PartitionerMurmur2 = "murmur2"
+	// CRC32 hash, messages without key are spread randomly (default)
+	PartitionerConsistentRandom = "consistent_random"
+	// CRC32 hash, messages without key go to a same partition
+	PartitionerConsistent = "consistent"
+	// FNV-1a hash, messages without key are spread randomly
+	PartitionerFNV1aRandom = "fnv1a_random"
+	// FNV-1a hash, messages without key go to a same partition
+	PartitionerFNV1a = "fnv1a"
+	// Random partition, the key is ignored
+	PartitionerRandom = "random"
+)
+
+// ParsePartitioner checks the given producer partitioner name, empty meaning the producer default
+func ParsePartitioner(name string) (string, error) {
+	switch name {
+	case "", PartitionerMurmur2Random, PartitionerMurmur2, PartitionerConsistentRandom, PartitionerConsistent,
+		PartitionerFNV1aRandom, PartitionerFNV1a, PartitionerRandom:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown partitioner %q (available: %s, %s, %s, %s, %s, %s, %s)", name,
+		PartitionerMurmur2Random, PartitionerMurmur2, PartitionerConsistentRandom, PartitionerConsistent,
+		PartitionerFNV1aRandom, PartitionerFNV1a, PartitionerRandom)
+}
+
+// Murmur2 returns the hash computed by the default partitioner of the Java producer
+func Murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// Murmur2Partition returns the partition chosen by the default partitioner of the Java producer for the key
+func Murmur2Partition(key []byte, partitions int32) int32 {
+	return (Murmur2(key) & 0x7fffffff) % partitions
+}
+
+// MetadataProvider retrieves the metadata of the cluster, such as a producer or an admin client
+type MetadataProvider interface {
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+}
+
+// PartitionCounter returns the number of partitions of the topics, read once per topic
+type PartitionCounter struct {
+	provider MetadataProvider
+	timeout  time.Duration
+	// Duration the counts are cached for, so that added partitions are taken into account
+	ttl time.Duration
+
+	mutex  sync.Mutex
+	counts map[string]partitionCount
+}
+
+type partitionCount struct {
+	count   int32
+	expires time.Time
+}
+
+// NewPartitionCounter returns a partition counter reading the topics metadata from the provider. The
+// counts are read again once the ttl elapsed, a zero ttl caching them forever.
+func NewPartitionCounter(provider MetadataProvider, timeout time.Duration, ttl time.Duration) *PartitionCounter {
+	return &PartitionCounter{
+		provider: provider,
+		timeout:  timeout,
+		ttl:      ttl,
+		counts:   map[string]partitionCount{},
+	}
+}
+
+// Count returns the number of partitions of the topic. When the metadata cannot be read again once
+// the cached count expired, the cached count is kept.
+func (c *PartitionCounter) Count(topic string) (int32, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cached, ok := c.counts[topic]
+	if ok && (c.ttl <= 0 || time.Now().Before(cached.expires)) {
+		return cached.count, nil
+	}
+
+	count, err := c.read(topic)
+	if err != nil {
+		if ok {
+			return cached.count, nil
+		}
+		return 0, err
+	}
+
+	c.counts[topic] = partitionCount{count: count, expires: time.Now().Add(c.ttl)}
+	return count, nil
+}
+
+// Reads the number of partitions of the topic from its metadata
+func (c *PartitionCounter) read(topic string) (int32, error) {
+	metadata, err := c.provider.GetMetadata(&topic, false, int(c.timeout.Milliseconds()))
+	if err != nil {
+		return 0, fmt.Errorf("unable to retrieve the metadata of topic %q: %w", topic, err)
+	}
+	topicMetadata, ok := metadata.Topics[topic]
+	if ok && topicMetadata.Error.Code() != kafka.ErrNoError {
+		return 0, fmt.Errorf("unable to retrieve the metadata of topic %q: %w", topic, topicMetadata.Error)
+	}
+	if !ok || len(topicMetadata.Partitions) == 0 {
+		return 0, fmt.Errorf("topic %q has no partition", topic)
+	}
+
+	return int32(len(topicMetadata.Partitions)), nil
+}
+
+// Returns the partition of the message, kafka.PartitionAny letting the producer partitioner choose it
+// from the key. The partition of a message with a partition key requires the partition counter.
+func messagePartition(message *Message, counter *PartitionCounter) (int32, error) {
+	switch {
+	case message.Partition != nil:
+		return *message.Partition, nil
+	case message.PartitionKey != nil:
+		if counter == nil {
+			return 0, fmt.Errorf("the partition of the messages of topic %q cannot be computed without their number", message.Topic)
+		}
+		count, err := counter.Count(message.Topic)
+		if err != nil {
+			return 0, err
+		}
+		return Murmur2Partition(message.PartitionKey, count), nil
+	}
+	return kafka.PartitionAny, nil
+}
@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur2(t *testing.T) {
+	// Values computed by org.apache.kafka.common.utils.Utils.murmur2
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for data, expected := range tests {
+		assert.Equal(t, expected, Murmur2([]byte(data)), data)
+	}
+}
+
+func TestMurmur2Partition(t *testing.T) {
+	assert.Equal(t, int32((-973932308&0x7fffffff)%12), Murmur2Partition([]byte("21"), 12))
+	assert.Equal(t, int32(0), Murmur2Partition([]byte("21"), 1))
+}
+
+// metadataProvider serves the given topics, counting the metadata requests
+type metadataProvider struct {
+	topics   map[string]kafkaconfluent.TopicMetadata
+	err      error
+	requests int
+}
+
+func (p *metadataProvider) GetMetadata(_ *string, _ bool, _ int) (*kafkaconfluent.Metadata, error) {
+	p.requests++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &kafkaconfluent.Metadata{Topics: p.topics}, nil
+}
+
+func TestPartitionCounter_Count(t *testing.T) {
+	provider := &metadataProvider{topics: map[string]kafkaconfluent.TopicMetadata{
+		"items":       existingTopic("items", 6),
+		"unavailable": {Topic: "unavailable", Error: kafkaconfluent.NewError(kafkaconfluent.ErrUnknownTopicOrPart, "unknown topic", false)},
+	}}
+	counter := NewPartitionCounter(provider, 0, 0)
+
+	count, err := counter.Count("items")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(6), count)
+
+	// Read once per topic
+	count, err = counter.Count("items")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(6), count)
+	assert.Equal(t, 1, provider.requests)
+
+	_, err = counter.Count("unavailable")
+	assert.ErrorContains(t, err, "unknown topic")
+
+	_, err = counter.Count("absent")
+	assert.EqualError(t, err, `topic "absent" has no partition`)
+
+	provider.err = errors.New("broker unreachable")
+	_, err = counter.Count("other")
+	assert.ErrorContains(t, err, "broker unreachable")
+}
+
+func TestPartitionCounterRefreshesExpiredCounts(t *testing.T) {
+	provider := &metadataProvider{topics: map[string]kafkaconfluent.TopicMetadata{
+		"items": existingTopic("items", 6),
+	}}
+	counter := NewPartitionCounter(provider, 0, 20*time.Millisecond)
+
+	count, err := counter.Count("items")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(6), count)
+
+	// Partitions added to the topic are counted once the cached count expired
+	provider.topics["items"] = existingTopic("items", 8)
+	count, _ = counter.Count("items")
+	assert.Equal(t, int32(6), count)
+
+	time.Sleep(30 * time.Millisecond)
+	count, err = counter.Count("items")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(8), count)
+	assert.Equal(t, 2, provider.requests)
+
+	// The expired count is kept when the metadata cannot be read
+	time.Sleep(30 * time.Millisecond)
+	provider.err = errors.New("broker unreachable")
+	count, err = counter.Count("items")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(8), count)
+}
+
+func TestMessagePartition(t *testing.T) {
+	counter := NewPartitionCounter(&metadataProvider{topics: map[string]kafkaconfluent.TopicMetadata{
+		"items": existingTopic("items", 12),
+	}}, 0, 0)
+	explicit := int32(3)
+
+	tests := map[string]struct {
+		message  *Message
+		counter  *PartitionCounter
+		expected int32
+		err      bool
+	}{
+		"key": {
+			message:  &Message{Topic: "items", Key: []byte("21")},
+			counter:  counter,
+			expected: kafkaconfluent.PartitionAny,
+		},
+		"explicit partition": {
+			message:  &Message{Topic: "items", Key: []byte("21"), Partition: &explicit, PartitionKey: []byte("21")},
+			expected: 3,
+		},
+		"partition key": {
+			message:  &Message{Topic: "items", Key: []byte("other"), PartitionKey: []byte("21")},
+			counter:  counter,
+			expected: Murmur2Partition([]byte("21"), 12),
+		},
+		"partition key without counter": {
+			message: &Message{Topic: "items", PartitionKey: []byte("21")},
+			err:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			partition, err := messagePartition(test.message, test.counter)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, partition)
+		})
+	}
+}
+
+func TestParsePartitioner(t *testing.T) {
+	partitioner, err := ParsePartitioner(PartitionerMurmur2Random)
+	assert.NoError(t, err)
+	assert.Equal(t, PartitionerMurmur2Random, partitioner)
+
+	partitioner, err = ParsePartitioner("")
+	assert.NoError(t, err)
+	assert.Empty(t, partitioner)
+
+	_, err = ParsePartitioner("crc32")
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+)
+
+// ErrStreamHalted is returned, possibly wrapped, by the clients and middlewares that stopped producing
+// because a failure halted the stream
+var ErrStreamHalted = errors.New("stream halted")
+
+// ProduceFunc produces a single message, its error is returned back up through the middlewares
+type ProduceFunc func(ctx context.Context, message *Message) error
+
+// Middleware is a stage of a client pipeline
+type Middleware interface {
+	// Wrap returns the produce function of the stage, which calls the next stage one
+	Wrap(next ProduceFunc) ProduceFunc
+}
+
+// MiddlewareFunc allows to use a function as a Middleware
+type MiddlewareFunc func(next ProduceFunc) ProduceFunc
+
+// Wrap calls the function
+func (f MiddlewareFunc) Wrap(next ProduceFunc) ProduceFunc {
+	return f(next)
+}
+
+// CheckpointMarker is implemented by the clients able to deliver the checkpoint of the change events
+// that produced no message, once the messages produced before them are delivered
+type CheckpointMarker interface {
+	MarkCheckpoint(checkpoint []byte)
+}
+
+type pipeline struct {
+	client  Client
+	produce ProduceFunc
+	// Stages that still produce messages on their own, closed before the client
+	closers []io.Closer
+}
+
+// NewPipeline returns a kafka client producing the messages through the given middlewares, in order,
+// and then through the original client. Stages are composed once and called synchronously, without
+// any goroutine or channel between them. The middlewares implementing io.Closer are closed, in order,
+// before the client.
+func NewPipeline(cli Client, middlewares ...Middleware) *pipeline {
+	produce := cli.Produce
+	var closers []io.Closer
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		produce = middlewares[i].Wrap(produce)
+	}
+	for _, middleware := range middlewares {
+		if closer, ok := middleware.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+	}
+
+	return &pipeline{
+		client:  cli,
+		produce: produce,
+		closers: closers,
+	}
+}
+
+// Produce sends the message through the middlewares
+func (p *pipeline) Produce(ctx context.Context, message *Message) error {
+	return p.produce(ctx, message)
+}
+
+// MarkCheckpoint hands the checkpoint over to the client, without going through the middlewares
+func (p *pipeline) MarkCheckpoint(checkpoint []byte) {
+	if marker, ok := p.client.(CheckpointMarker); ok {
+		marker.MarkCheckpoint(checkpoint)
+	}
+}
+
+// Events returns the kafka producer events
+func (p *pipeline) Events() chan kafka.Event {
+	return p.client.Events()
+}
+
+// Close closes the middlewares and then closes/disconnects the kafka client, which flushes what the
+// middlewares produced while closing
+func (p *pipeline) Close() error {
+	var errs []error
+	for _, closer := range p.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := p.client.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// ProduceAll produces the messages of the channel one by one until it is closed, and then closes the
+// client and returns its closing error. Messages that cannot be produced are logged, once the stream
+// is halted the remaining ones are drained so that the upstream stages can stop. Checkpoint markers
+// are handed over to the client when it is a CheckpointMarker.
+func ProduceAll(ctx context.Context, client Client, messages chan *Message, log logger.LoggerInterface) error {
+	marker, _ := client.(CheckpointMarker)
+	for message := range messages {
+		if message.Topic == "" {
+			if marker != nil && message.Checkpoint != nil {
+				marker.MarkCheckpoint(message.Checkpoint)
+			}
+			continue
+		}
+
+		err := client.Produce(ctx, message)
+		if err != nil && !errors.Is(err, ErrStreamHalted) {
+			log.Error("Kafka client: Unable to produce message", logger.String("topic", message.Topic), logger.ByteString("key", message.Key), logger.Error("error", err))
+		}
+	}
+
+	return client.Close()
+}
@@ -0,0 +1,206 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func giveStage(name string, calls *[]string) MiddlewareFunc {
+	return func(next ProduceFunc) ProduceFunc {
+		return func(ctx context.Context, message *Message) error {
+			*calls = append(*calls, name)
+			return next(ctx, message)
+		}
+	}
+}
+
+func TestPipelineProduceCallsMiddlewaresInOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	ctx := context.Background()
+	message := &Message{Topic: "test-topic"}
+
+	var calls []string
+	client := NewMockClient(ctrl)
+	client.EXPECT().Produce(ctx, message).DoAndReturn(func(_ context.Context, _ *Message) error {
+		calls = append(calls, "client")
+		return nil
+	})
+
+	cli := NewPipeline(client, giveStage("first", &calls), giveStage("second", &calls))
+
+	// When
+	err := cli.Produce(ctx, message)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "client"}, calls)
+}
+
+func TestPipelineProducePropagatesErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	produceErr := errors.New("failure")
+
+	client := NewMockClient(ctrl)
+	client.EXPECT().Produce(gomock.Any(), gomock.Any()).Return(produceErr)
+
+	var seen error
+	observer := MiddlewareFunc(func(next ProduceFunc) ProduceFunc {
+		return func(ctx context.Context, message *Message) error {
+			seen = next(ctx, message)
+			return seen
+		}
+	})
+
+	cli := NewPipeline(client, observer)
+
+	// When
+	err := cli.Produce(context.Background(), &Message{Topic: "test-topic"})
+
+	// Then
+	assert.Equal(t, produceErr, err)
+	assert.Equal(t, produceErr, seen)
+}
+
+func TestPipelineClose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	var closed []string
+	client := NewMockClient(ctrl)
+	client.EXPECT().Close().DoAndReturn(func() error {
+		closed = append(closed, "client")
+		return nil
+	})
+	stage := &closingStage{close: func() error {
+		closed = append(closed, "stage")
+		return nil
+	}}
+
+	// When
+	err := NewPipeline(client, giveStage("first", new([]string)), stage).Close()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stage", "client"}, closed, "the stages are closed before the client flushes")
+}
+
+type closingStage struct {
+	close func() error
+}
+
+func (s *closingStage) Wrap(next ProduceFunc) ProduceFunc {
+	return next
+}
+
+func (s *closingStage) Close() error {
+	return s.close()
+}
+
+func TestProduceAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	messages := make(chan *Message, 3)
+	messages <- &Message{Topic: "test-topic", Key: []byte("1")}
+	messages <- &Message{Topic: "test-topic", Key: []byte("2")}
+	messages <- &Message{Topic: "test-topic", Key: []byte("3")}
+	close(messages)
+
+	var produced []string
+	client := NewMockClient(ctrl)
+	gomock.InOrder(
+		client.EXPECT().Produce(gomock.Any(), gomock.Any()).Return(errors.New("failure")),
+		client.EXPECT().Produce(gomock.Any(), gomock.Any()).Return(ErrStreamHalted),
+		client.EXPECT().Produce(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message *Message) error {
+			produced = append(produced, string(message.Key))
+			return nil
+		}),
+		client.EXPECT().Close(),
+	)
+
+	// When
+	ProduceAll(context.Background(), client, messages, logger.NewNopLogger())
+
+	// Then
+	assert.Equal(t, []string{"3"}, produced)
+}
+
+func TestProduceAllMarksCheckpoints(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Given
+	messages := make(chan *Message, 2)
+	messages <- &Message{Topic: "test-topic", Key: []byte("1")}
+	messages <- &Message{Checkpoint: []byte("token")}
+	close(messages)
+
+	var marked []string
+	client := &markingClient{MockClient: NewMockClient(ctrl), marked: &marked}
+	gomock.InOrder(
+		client.MockClient.EXPECT().Produce(gomock.Any(), gomock.Any()),
+		client.MockClient.EXPECT().Close(),
+	)
+
+	// When
+	ProduceAll(context.Background(), NewPipeline(client), messages, logger.NewNopLogger())
+
+	// Then
+	assert.Equal(t, []string{"token"}, marked, "the checkpoint marker is not produced")
+}
+
+type markingClient struct {
+	*MockClient
+	marked *[]string
+}
+
+func (c *markingClient) MarkCheckpoint(checkpoint []byte) {
+	*c.marked = append(*c.marked, string(checkpoint))
+}
+
+const benchmarkStages = 4
+
+type nopClient struct{}
+
+func (nopClient) Produce(context.Context, *Message) error { return nil }
+func (nopClient) Events() chan kafkaconfluent.Event       { return nil }
+func (nopClient) Close() error                            { return nil }
+
+func BenchmarkPipelineMiddlewares(b *testing.B) {
+	middlewares := make([]Middleware, benchmarkStages)
+	for i := range middlewares {
+		middlewares[i] = MiddlewareFunc(func(next ProduceFunc) ProduceFunc {
+			return func(ctx context.Context, message *Message) error {
+				return next(ctx, message)
+			}
+		})
+	}
+	message := &Message{Topic: "test-topic"}
+	cli := NewPipeline(nopClient{}, middlewares...)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	messages := make(chan *Message, 1000)
+	go func() {
+		defer close(messages)
+		for i := 0; i < b.N; i++ {
+			messages <- message
+		}
+	}()
+	ProduceAll(context.Background(), cli, messages, logger.NewNopLogger())
+}
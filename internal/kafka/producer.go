@@ -1,11 +1,24 @@
 package kafka
 
-import "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
 
 type KafkaProducer interface {
 	Close()
 	Events() chan kafka.Event
+	Flush(timeoutMs int) int
 	Len() int
 	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
-	ProduceChannel() chan *kafka.Message
+}
+
+// TransactionalKafkaProducer is a Kafka producer configured with a "transactional.id"
+type TransactionalKafkaProducer interface {
+	KafkaProducer
+	InitTransactions(ctx context.Context) error
+	BeginTransaction() error
+	CommitTransaction(ctx context.Context) error
+	AbortTransaction(ctx context.Context) error
 }
@@ -5,6 +5,7 @@
 package kafka
 
 import (
+	context "context"
 	reflect "reflect"
 
 	kafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -60,6 +61,20 @@ func (mr *MockKafkaProducerMockRecorder) Events() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockKafkaProducer)(nil).Events))
 }
 
+// Flush mocks base method.
+func (m *MockKafkaProducer) Flush(timeoutMs int) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", timeoutMs)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockKafkaProducerMockRecorder) Flush(timeoutMs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockKafkaProducer)(nil).Flush), timeoutMs)
+}
+
 // Len mocks base method.
 func (m *MockKafkaProducer) Len() int {
 	m.ctrl.T.Helper()
@@ -88,16 +103,149 @@ func (mr *MockKafkaProducerMockRecorder) Produce(msg, deliveryChan interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Produce", reflect.TypeOf((*MockKafkaProducer)(nil).Produce), msg, deliveryChan)
 }
 
-// ProduceChannel mocks base method.
-func (m *MockKafkaProducer) ProduceChannel() chan *kafka.Message {
+// MockTransactionalKafkaProducer is a mock of TransactionalKafkaProducer interface.
+type MockTransactionalKafkaProducer struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransactionalKafkaProducerMockRecorder
+}
+
+// MockTransactionalKafkaProducerMockRecorder is the mock recorder for MockTransactionalKafkaProducer.
+type MockTransactionalKafkaProducerMockRecorder struct {
+	mock *MockTransactionalKafkaProducer
+}
+
+// NewMockTransactionalKafkaProducer creates a new mock instance.
+func NewMockTransactionalKafkaProducer(ctrl *gomock.Controller) *MockTransactionalKafkaProducer {
+	mock := &MockTransactionalKafkaProducer{ctrl: ctrl}
+	mock.recorder = &MockTransactionalKafkaProducerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTransactionalKafkaProducer) EXPECT() *MockTransactionalKafkaProducerMockRecorder {
+	return m.recorder
+}
+
+// AbortTransaction mocks base method.
+func (m *MockTransactionalKafkaProducer) AbortTransaction(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AbortTransaction", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AbortTransaction indicates an expected call of AbortTransaction.
+func (mr *MockTransactionalKafkaProducerMockRecorder) AbortTransaction(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AbortTransaction", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).AbortTransaction), ctx)
+}
+
+// BeginTransaction mocks base method.
+func (m *MockTransactionalKafkaProducer) BeginTransaction() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginTransaction")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BeginTransaction indicates an expected call of BeginTransaction.
+func (mr *MockTransactionalKafkaProducerMockRecorder) BeginTransaction() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginTransaction", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).BeginTransaction))
+}
+
+// Close mocks base method.
+func (m *MockTransactionalKafkaProducer) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockTransactionalKafkaProducerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).Close))
+}
+
+// CommitTransaction mocks base method.
+func (m *MockTransactionalKafkaProducer) CommitTransaction(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ProduceChannel")
-	ret0, _ := ret[0].(chan *kafka.Message)
+	ret := m.ctrl.Call(m, "CommitTransaction", ctx)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// ProduceChannel indicates an expected call of ProduceChannel.
-func (mr *MockKafkaProducerMockRecorder) ProduceChannel() *gomock.Call {
+// CommitTransaction indicates an expected call of CommitTransaction.
+func (mr *MockTransactionalKafkaProducerMockRecorder) CommitTransaction(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitTransaction", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).CommitTransaction), ctx)
+}
+
+// Events mocks base method.
+func (m *MockTransactionalKafkaProducer) Events() chan kafka.Event {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events")
+	ret0, _ := ret[0].(chan kafka.Event)
+	return ret0
+}
+
+// Events indicates an expected call of Events.
+func (mr *MockTransactionalKafkaProducerMockRecorder) Events() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).Events))
+}
+
+// Flush mocks base method.
+func (m *MockTransactionalKafkaProducer) Flush(timeoutMs int) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", timeoutMs)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockTransactionalKafkaProducerMockRecorder) Flush(timeoutMs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).Flush), timeoutMs)
+}
+
+// InitTransactions mocks base method.
+func (m *MockTransactionalKafkaProducer) InitTransactions(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InitTransactions", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InitTransactions indicates an expected call of InitTransactions.
+func (mr *MockTransactionalKafkaProducerMockRecorder) InitTransactions(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitTransactions", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).InitTransactions), ctx)
+}
+
+// Len mocks base method.
+func (m *MockTransactionalKafkaProducer) Len() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Len")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Len indicates an expected call of Len.
+func (mr *MockTransactionalKafkaProducerMockRecorder) Len() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).Len))
+}
+
+// Produce mocks base method.
+func (m *MockTransactionalKafkaProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Produce", msg, deliveryChan)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Produce indicates an expected call of Produce.
+func (mr *MockTransactionalKafkaProducerMockRecorder) Produce(msg, deliveryChan interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProduceChannel", reflect.TypeOf((*MockKafkaProducer)(nil).ProduceChannel))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Produce", reflect.TypeOf((*MockTransactionalKafkaProducer)(nil).Produce), msg, deliveryChan)
 }
@@ -0,0 +1,25 @@
+package kafka
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// debugFunc receives the messages with their delivery error, nil when they have been delivered
+type debugFunc func(message *Message, err error)
+
+// NewDebuggerSubscriber returns the dispatcher subscriber sending the delivered and failed messages
+// to the debug function
+func NewDebuggerSubscriber(fn debugFunc) DeliverySubscriber {
+	return DeliverySubscriberFuncs{
+		Delivery: func(report *kafka.Message) {
+			if delivery := DeliveryOf(report); delivery != nil {
+				fn(delivery.Message, nil)
+			}
+		},
+		DeliveryFailure: func(report *kafka.Message, err error) {
+			if delivery := DeliveryOf(report); delivery != nil {
+				fn(delivery.Message, err)
+			}
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/mock"
+)
+
+type DebuggerMock struct {
+	mock.Mock
+}
+
+func (t *DebuggerMock) Function(msg *Message, err error) {
+	t.Called(msg, err)
+}
+
+func TestDebuggerSubscriber(t *testing.T) {
+	// Given
+	topic := "test-topic"
+	message := &Message{Topic: topic}
+	report := &kafkaconfluent.Message{
+		TopicPartition: kafkaconfluent.TopicPartition{Topic: &topic},
+		Opaque:         &Delivery{Message: message, Attempts: 1, Sequence: 1},
+	}
+	deliveryErr := errors.New("failure")
+
+	var debuggerMock DebuggerMock
+	debuggerMock.On("Function", message, nil).Once()
+	debuggerMock.On("Function", message, deliveryErr).Once()
+
+	subscriber := NewDebuggerSubscriber(debuggerMock.Function)
+
+	// When
+	subscriber.OnDelivery(report)
+	subscriber.OnDeliveryFailure(report, deliveryErr)
+
+	// Then
+	debuggerMock.AssertExpectations(t)
+}
@@ -0,0 +1,354 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+)
+
+// Topic provisioning modes
+const (
+	// The topics are neither checked nor created
+	TopicProvisioningNone = "none"
+	// The topics have to exist with the required settings
+	TopicProvisioningValidate = "validate"
+	// The missing topics are created, the existing ones have to have the required settings
+	TopicProvisioningCreate = "create"
+)
+
+// Topic states reported once provisioned
+const (
+	TopicStateCreated     = "created"
+	TopicStateExisting    = "existing"
+	TopicStateMissing     = "missing"
+	TopicStateConflicting = "conflicting"
+	TopicStateFailed      = "failed"
+)
+
+// ErrTopicsNotProvisioned is returned by the provisioner status until the topics are provisioned
+var ErrTopicsNotProvisioned = errors.New("topics not provisioned yet")
+
+// TopicAdmin is the part of the Kafka admin client used to provision the topics
+type TopicAdmin interface {
+	MetadataProvider
+	CreateTopics(ctx context.Context, topics []kafka.TopicSpecification, options ...kafka.CreateTopicsAdminOption) ([]kafka.TopicResult, error)
+	DescribeConfigs(ctx context.Context, resources []kafka.ConfigResource, options ...kafka.DescribeConfigsAdminOption) ([]kafka.ConfigResourceResult, error)
+}
+
+// ParseTopicProvisioning checks the given topic provisioning mode, none by default
+func ParseTopicProvisioning(mode string) (string, error) {
+	switch mode {
+	case "":
+		return TopicProvisioningNone, nil
+	case TopicProvisioningNone, TopicProvisioningValidate, TopicProvisioningCreate:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown topic provisioning mode %q (available: %s, %s, %s)", mode, TopicProvisioningNone, TopicProvisioningValidate, TopicProvisioningCreate)
+}
+
+// ParseTopicConfig decodes a JSON object of topic configuration properties,
+// such as {"cleanup.policy": "compact"}
+func ParseTopicConfig(config string) (map[string]string, error) {
+	topicConfig := map[string]string{}
+	if config == "" {
+		return topicConfig, nil
+	}
+
+	if err := json.Unmarshal([]byte(config), &topicConfig); err != nil {
+		return nil, fmt.Errorf("invalid topic config: %w", err)
+	}
+	return topicConfig, nil
+}
+
+// TopicRequirement describes a topic the pipeline produces to
+type TopicRequirement struct {
+	Name string
+	// Configuration the topic is created with, an existing topic with a different value conflicts
+	Config map[string]string
+	// The cleanup policy of the topic has to include compaction, such as for keyed tombstones or checkpoints
+	Compacted bool
+}
+
+// Returns the configuration the topic has to have
+func (r *TopicRequirement) config() map[string]string {
+	config := make(map[string]string, len(r.Config)+1)
+	for key, value := range r.Config {
+		config[key] = value
+	}
+	if _, ok := config["cleanup.policy"]; !ok && r.Compacted {
+		config["cleanup.policy"] = "compact"
+	}
+	return config
+}
+
+// Returns the reasons why the given topic configuration does not meet the requirement
+func (r *TopicRequirement) conflicts(config map[string]kafka.ConfigEntryResult) []string {
+	var conflicts []string
+	for key, expected := range r.Config {
+		entry, ok := config[key]
+		if !ok || !sameConfigValue(expected, entry.Value) {
+			conflicts = append(conflicts, fmt.Sprintf("%s is %q instead of %q", key, entry.Value, expected))
+		}
+	}
+	if policy, ok := config["cleanup.policy"]; r.Compacted && (!ok || !slices.Contains(configValues(policy.Value), "compact")) {
+		conflicts = append(conflicts, fmt.Sprintf("cleanup.policy is %q but the topic has to be compacted", policy.Value))
+	}
+	slices.Sort(conflicts)
+	return slices.Compact(conflicts)
+}
+
+// TopicStatus is the provisioning result of a topic
+type TopicStatus struct {
+	Topic      string `json:"topic"`
+	State      string `json:"state"`
+	Partitions int    `json:"partitions,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TopicProvisioner checks that the topics produced to exist with the settings the pipeline needs,
+// and creates the missing ones when allowed to
+type TopicProvisioner struct {
+	create            bool
+	partitions        int
+	replicationFactor int
+	timeout           time.Duration
+	logger            logger.LoggerInterface
+
+	mutex    sync.Mutex
+	statuses []TopicStatus
+	err      error
+}
+
+// TopicOption allows to customize the topic provisioner
+type TopicOption func(*TopicProvisioner)
+
+// WithTopicCreation allows to create the missing topics with the given number of partitions and
+// replication factor, -1 meaning the broker default
+func WithTopicCreation(partitions int, replicationFactor int) TopicOption {
+	return func(p *TopicProvisioner) {
+		p.create = true
+		p.partitions = partitions
+		p.replicationFactor = replicationFactor
+	}
+}
+
+// WithTopicTimeout allows to set the timeout of the admin requests
+func WithTopicTimeout(timeout time.Duration) TopicOption {
+	return func(p *TopicProvisioner) {
+		p.timeout = timeout
+	}
+}
+
+// NewTopicProvisioner returns a topic provisioner, validating the topics unless WithTopicCreation is given
+func NewTopicProvisioner(log logger.LoggerInterface, options ...TopicOption) *TopicProvisioner {
+	p := &TopicProvisioner{
+		partitions:        -1,
+		replicationFactor: -1,
+		timeout:           30 * time.Second,
+		logger:            log,
+		err:               ErrTopicsNotProvisioned,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Provision checks the required topics, creating the missing ones when allowed to. An error is
+// returned when a topic is missing, cannot be created or has conflicting settings. Requirements of
+// the same topic are merged.
+func (p *TopicProvisioner) Provision(ctx context.Context, admin TopicAdmin, requirements []*TopicRequirement) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	requirements = mergeTopicRequirements(requirements)
+	statuses := make([]TopicStatus, len(requirements))
+	for index, requirement := range requirements {
+		statuses[index].Topic = requirement.Name
+		if policy, ok := requirement.Config["cleanup.policy"]; ok && requirement.Compacted && !slices.Contains(configValues(policy), "compact") {
+			statuses[index].State = TopicStateConflicting
+			statuses[index].Error = fmt.Sprintf("cleanup.policy is configured as %q but the topic has to be compacted", policy)
+		}
+	}
+
+	metadata, err := admin.GetMetadata(nil, true, int(p.timeout.Milliseconds()))
+	if err != nil {
+		return p.done(nil, fmt.Errorf("unable to retrieve the topics metadata: %w", err))
+	}
+
+	var missing []int
+	for index, requirement := range requirements {
+		if statuses[index].State != "" {
+			continue
+		}
+		topic, ok := metadata.Topics[requirement.Name]
+		switch {
+		case !ok || topic.Error.Code() == kafka.ErrUnknownTopicOrPart:
+			missing = append(missing, index)
+		case topic.Error.Code() != kafka.ErrNoError:
+			statuses[index].State, statuses[index].Error = TopicStateFailed, topic.Error.Error()
+		default:
+			statuses[index].State, statuses[index].Partitions = TopicStateExisting, len(topic.Partitions)
+		}
+	}
+
+	if len(missing) > 0 && p.create {
+		p.createTopics(ctx, admin, requirements, statuses, missing)
+	} else {
+		for _, index := range missing {
+			statuses[index].State, statuses[index].Error = TopicStateMissing, "topic does not exist"
+		}
+	}
+
+	p.validateTopics(ctx, admin, requirements, statuses)
+
+	var errs []error
+	for _, status := range statuses {
+		if status.Error != "" {
+			p.logger.Error("Topic not provisioned", logger.String("topic", status.Topic), logger.String("state", status.State), logger.String("error", status.Error))
+			errs = append(errs, fmt.Errorf("topic %q is %s: %s", status.Topic, status.State, status.Error))
+			continue
+		}
+		p.logger.Info("Topic provisioned", logger.String("topic", status.Topic), logger.String("state", status.State), logger.Int64("partitions", int64(status.Partitions)))
+	}
+
+	return p.done(statuses, errors.Join(errs...))
+}
+
+// Creates the missing topics, a topic created meanwhile is considered existing
+func (p *TopicProvisioner) createTopics(ctx context.Context, admin TopicAdmin, requirements []*TopicRequirement, statuses []TopicStatus, missing []int) {
+	specifications := make([]kafka.TopicSpecification, 0, len(missing))
+	indexes := make(map[string]int, len(missing))
+	for _, index := range missing {
+		specifications = append(specifications, kafka.TopicSpecification{
+			Topic:             requirements[index].Name,
+			NumPartitions:     p.partitions,
+			ReplicationFactor: p.replicationFactor,
+			Config:            requirements[index].config(),
+		})
+		indexes[requirements[index].Name] = index
+	}
+
+	results, err := admin.CreateTopics(ctx, specifications)
+	if err != nil {
+		for _, index := range missing {
+			statuses[index].State, statuses[index].Error = TopicStateFailed, err.Error()
+		}
+		return
+	}
+
+	for _, result := range results {
+		index, ok := indexes[result.Topic]
+		if !ok {
+			continue
+		}
+		switch result.Error.Code() {
+		case kafka.ErrNoError:
+			// Unknown when created with the broker default
+			statuses[index].State, statuses[index].Partitions = TopicStateCreated, max(p.partitions, 0)
+		case kafka.ErrTopicAlreadyExists:
+			statuses[index].State = TopicStateExisting
+		default:
+			statuses[index].State, statuses[index].Error = TopicStateFailed, result.Error.Error()
+		}
+	}
+}
+
+// Checks the configuration of the existing topics
+func (p *TopicProvisioner) validateTopics(ctx context.Context, admin TopicAdmin, requirements []*TopicRequirement, statuses []TopicStatus) {
+	var resources []kafka.ConfigResource
+	indexes := map[string]int{}
+	for index, requirement := range requirements {
+		if statuses[index].State != TopicStateExisting || (len(requirement.Config) == 0 && !requirement.Compacted) {
+			continue
+		}
+		resources = append(resources, kafka.ConfigResource{Type: kafka.ResourceTopic, Name: requirement.Name})
+		indexes[requirement.Name] = index
+	}
+	if len(resources) == 0 {
+		return
+	}
+
+	results, err := admin.DescribeConfigs(ctx, resources)
+	if err != nil {
+		for _, index := range indexes {
+			statuses[index].State, statuses[index].Error = TopicStateFailed, fmt.Sprintf("unable to describe the topic configuration: %s", err)
+		}
+		return
+	}
+
+	for _, result := range results {
+		index, ok := indexes[result.Name]
+		if !ok {
+			continue
+		}
+		if result.Error.Code() != kafka.ErrNoError {
+			statuses[index].State, statuses[index].Error = TopicStateFailed, fmt.Sprintf("unable to describe the topic configuration: %s", result.Error)
+			continue
+		}
+		if conflicts := requirements[index].conflicts(result.Config); len(conflicts) > 0 {
+			statuses[index].State, statuses[index].Error = TopicStateConflicting, strings.Join(conflicts, ", ")
+		}
+	}
+}
+
+func (p *TopicProvisioner) done(statuses []TopicStatus, err error) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.statuses = statuses
+	p.err = err
+	return err
+}
+
+// Status returns the status of each topic and the provisioning error, ErrTopicsNotProvisioned until
+// the topics are provisioned
+func (p *TopicProvisioner) Status() ([]TopicStatus, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.statuses, p.err
+}
+
+// Returns one requirement per topic, in order of first appearance
+func mergeTopicRequirements(requirements []*TopicRequirement) []*TopicRequirement {
+	merged := make([]*TopicRequirement, 0, len(requirements))
+	byName := make(map[string]*TopicRequirement, len(requirements))
+	for _, requirement := range requirements {
+		existing, ok := byName[requirement.Name]
+		if !ok {
+			existing = &TopicRequirement{Name: requirement.Name, Config: map[string]string{}}
+			byName[requirement.Name] = existing
+			merged = append(merged, existing)
+		}
+		for key, value := range requirement.Config {
+			existing.Config[key] = value
+		}
+		existing.Compacted = existing.Compacted || requirement.Compacted
+	}
+	return merged
+}
+
+// List values, such as "compact,delete", are compared regardless of their order
+func sameConfigValue(expected string, actual string) bool {
+	expectedValues, actualValues := configValues(expected), configValues(actual)
+	slices.Sort(expectedValues)
+	slices.Sort(actualValues)
+	return slices.Equal(expectedValues, actualValues)
+}
+
+func configValues(value string) []string {
+	values := strings.Split(value, ",")
+	for index := range values {
+		values[index] = strings.TrimSpace(values[index])
+	}
+	return values
+}
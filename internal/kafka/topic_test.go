@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// topicAdmin serves the given topics and configurations, recording the created topics
+type topicAdmin struct {
+	topics  map[string]kafkaconfluent.TopicMetadata
+	configs map[string]map[string]string
+	created []kafkaconfluent.TopicSpecification
+}
+
+func (a *topicAdmin) GetMetadata(_ *string, _ bool, _ int) (*kafkaconfluent.Metadata, error) {
+	return &kafkaconfluent.Metadata{Topics: a.topics}, nil
+}
+
+func (a *topicAdmin) CreateTopics(_ context.Context, topics []kafkaconfluent.TopicSpecification, _ ...kafkaconfluent.CreateTopicsAdminOption) ([]kafkaconfluent.TopicResult, error) {
+	results := make([]kafkaconfluent.TopicResult, 0, len(topics))
+	for _, topic := range topics {
+		a.created = append(a.created, topic)
+		results = append(results, kafkaconfluent.TopicResult{Topic: topic.Topic, Error: kafkaconfluent.NewError(kafkaconfluent.ErrNoError, "", false)})
+	}
+	return results, nil
+}
+
+func (a *topicAdmin) DescribeConfigs(_ context.Context, resources []kafkaconfluent.ConfigResource, _ ...kafkaconfluent.DescribeConfigsAdminOption) ([]kafkaconfluent.ConfigResourceResult, error) {
+	results := make([]kafkaconfluent.ConfigResourceResult, 0, len(resources))
+	for _, resource := range resources {
+		config := map[string]kafkaconfluent.ConfigEntryResult{}
+		for key, value := range a.configs[resource.Name] {
+			config[key] = kafkaconfluent.ConfigEntryResult{Name: key, Value: value}
+		}
+		results = append(results, kafkaconfluent.ConfigResourceResult{Type: kafkaconfluent.ResourceTopic, Name: resource.Name, Config: config})
+	}
+	return results, nil
+}
+
+func existingTopic(name string, partitions int) kafkaconfluent.TopicMetadata {
+	return kafkaconfluent.TopicMetadata{Topic: name, Partitions: make([]kafkaconfluent.PartitionMetadata, partitions)}
+}
+
+func TestTopicProvisioner_Provision_Create(t *testing.T) {
+	admin := &topicAdmin{
+		topics:  map[string]kafkaconfluent.TopicMetadata{"items": existingTopic("items", 3)},
+		configs: map[string]map[string]string{"items": {"cleanup.policy": "delete,compact"}},
+	}
+	provisioner := NewTopicProvisioner(logger.NewNopLogger(), WithTopicCreation(6, 3))
+
+	_, err := provisioner.Status()
+	assert.ErrorIs(t, err, ErrTopicsNotProvisioned)
+
+	err = provisioner.Provision(context.Background(), admin, []*TopicRequirement{
+		{Name: "items", Config: map[string]string{"cleanup.policy": "compact,delete"}},
+		{Name: "items", Compacted: true},
+		{Name: "checkpoints", Compacted: true},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []kafkaconfluent.TopicSpecification{
+		{Topic: "checkpoints", NumPartitions: 6, ReplicationFactor: 3, Config: map[string]string{"cleanup.policy": "compact"}},
+	}, admin.created)
+
+	statuses, err := provisioner.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, []TopicStatus{
+		{Topic: "items", State: TopicStateExisting, Partitions: 3},
+		{Topic: "checkpoints", State: TopicStateCreated, Partitions: 6},
+	}, statuses)
+}
+
+func TestTopicProvisioner_Provision_Validate(t *testing.T) {
+	admin := &topicAdmin{
+		topics: map[string]kafkaconfluent.TopicMetadata{
+			"items":       existingTopic("items", 1),
+			"checkpoints": existingTopic("checkpoints", 1),
+			"unavailable": {Topic: "unavailable", Error: kafkaconfluent.NewError(kafkaconfluent.ErrLeaderNotAvailable, "leader not available", false)},
+			"unknown":     {Topic: "unknown", Error: kafkaconfluent.NewError(kafkaconfluent.ErrUnknownTopicOrPart, "unknown topic", false)},
+		},
+		configs: map[string]map[string]string{
+			"items":       {"cleanup.policy": "delete", "min.insync.replicas": "2"},
+			"checkpoints": {"cleanup.policy": "delete"},
+		},
+	}
+	provisioner := NewTopicProvisioner(logger.NewNopLogger())
+
+	err := provisioner.Provision(context.Background(), admin, []*TopicRequirement{
+		{Name: "items", Config: map[string]string{"min.insync.replicas": "2"}},
+		{Name: "checkpoints", Compacted: true},
+		{Name: "unavailable"},
+		{Name: "unknown"},
+		{Name: "absent"},
+		{Name: "inconsistent", Config: map[string]string{"cleanup.policy": "delete"}, Compacted: true},
+	})
+	assert.Error(t, err)
+	assert.Empty(t, admin.created)
+
+	statuses, statusErr := provisioner.Status()
+	assert.Equal(t, err, statusErr)
+	assert.Equal(t, []TopicStatus{
+		{Topic: "items", State: TopicStateExisting, Partitions: 1},
+		{Topic: "checkpoints", State: TopicStateConflicting, Partitions: 1, Error: `cleanup.policy is "delete" but the topic has to be compacted`},
+		{Topic: "unavailable", State: TopicStateFailed, Error: "leader not available"},
+		{Topic: "unknown", State: TopicStateMissing, Error: "topic does not exist"},
+		{Topic: "absent", State: TopicStateMissing, Error: "topic does not exist"},
+		{Topic: "inconsistent", State: TopicStateConflicting, Error: `cleanup.policy is configured as "delete" but the topic has to be compacted`},
+	}, statuses)
+}
+
+func TestTopicProvisioner_Provision_MetadataError(t *testing.T) {
+	provisioner := NewTopicProvisioner(logger.NewNopLogger())
+
+	err := provisioner.Provision(context.Background(), &metadataErrorAdmin{}, []*TopicRequirement{{Name: "items"}})
+	assert.ErrorContains(t, err, "unable to retrieve the topics metadata")
+
+	statuses, statusErr := provisioner.Status()
+	assert.Nil(t, statuses)
+	assert.Equal(t, err, statusErr)
+}
+
+type metadataErrorAdmin struct {
+	topicAdmin
+}
+
+func (*metadataErrorAdmin) GetMetadata(_ *string, _ bool, _ int) (*kafkaconfluent.Metadata, error) {
+	return nil, errors.New("broker unreachable")
+}
+
+func TestParseTopicConfig(t *testing.T) {
+	config, err := ParseTopicConfig(`{"cleanup.policy": "compact", "min.insync.replicas": "2"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cleanup.policy": "compact", "min.insync.replicas": "2"}, config)
+
+	config, err = ParseTopicConfig("")
+	assert.NoError(t, err)
+	assert.Empty(t, config)
+
+	_, err = ParseTopicConfig(`{"partitions": 3}`)
+	assert.Error(t, err)
+}
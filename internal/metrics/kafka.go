@@ -9,6 +9,7 @@ type KafkaRecorder interface {
 	IncKafkaClientProduceCounter(topic string)
 	IncKafkaProducerSuccessCounter(topic string)
 	IncKafkaProducerErrorCounter(topic string)
+	IncKafkaRoutingDecisionCounter(rule string, topic string)
 	RegisterOn(registry prometheus.Registerer) KafkaRecorder
 	Unregister(registry prometheus.Registerer) KafkaRecorder
 }
@@ -17,6 +18,7 @@ type kafkaRecorder struct {
 	clientProduceCounter   *prometheus.CounterVec
 	producerSuccessCounter *prometheus.CounterVec
 	producerErrorCounter   *prometheus.CounterVec
+	routingDecisionCounter *prometheus.CounterVec
 }
 
 // NewKafkaRecorder returns a kafka recorder that is used to send metrics
@@ -47,6 +49,14 @@ func NewKafkaRecorder() *kafkaRecorder {
 			},
 			[]string{"topic"},
 		),
+		routingDecisionCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "kafka",
+				Name:      "routing_decision_counter_total",
+				Help:      "This represent the number of change events routed to a topic by a routing rule (empty topic when dropped)",
+			},
+			[]string{"rule", "topic"},
+		),
 	}
 }
 
@@ -60,6 +70,7 @@ func (r *kafkaRecorder) RegisterOn(registry prometheus.Registerer) KafkaRecorder
 		r.clientProduceCounter,
 		r.producerSuccessCounter,
 		r.producerErrorCounter,
+		r.routingDecisionCounter,
 	)
 
 	return r
@@ -70,6 +81,7 @@ func (r *kafkaRecorder) Unregister(registry prometheus.Registerer) KafkaRecorder
 	registry.Unregister(r.clientProduceCounter)
 	registry.Unregister(r.producerSuccessCounter)
 	registry.Unregister(r.producerErrorCounter)
+	registry.Unregister(r.routingDecisionCounter)
 
 	return r
 }
@@ -88,3 +100,8 @@ func (r *kafkaRecorder) IncKafkaProducerSuccessCounter(topic string) {
 func (r *kafkaRecorder) IncKafkaProducerErrorCounter(topic string) {
 	r.producerErrorCounter.WithLabelValues(topic).Inc()
 }
+
+// IncKafkaRoutingDecisionCounter increments the routing decision counter
+func (r *kafkaRecorder) IncKafkaRoutingDecisionCounter(rule string, topic string) {
+	r.routingDecisionCounter.WithLabelValues(rule, topic).Inc()
+}
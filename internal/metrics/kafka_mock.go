@@ -70,6 +70,18 @@ func (mr *MockKafkaRecorderMockRecorder) IncKafkaProducerSuccessCounter(topic in
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncKafkaProducerSuccessCounter", reflect.TypeOf((*MockKafkaRecorder)(nil).IncKafkaProducerSuccessCounter), topic)
 }
 
+// IncKafkaRoutingDecisionCounter mocks base method.
+func (m *MockKafkaRecorder) IncKafkaRoutingDecisionCounter(rule, topic string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncKafkaRoutingDecisionCounter", rule, topic)
+}
+
+// IncKafkaRoutingDecisionCounter indicates an expected call of IncKafkaRoutingDecisionCounter.
+func (mr *MockKafkaRecorderMockRecorder) IncKafkaRoutingDecisionCounter(rule, topic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncKafkaRoutingDecisionCounter", reflect.TypeOf((*MockKafkaRecorder)(nil).IncKafkaRoutingDecisionCounter), rule, topic)
+}
+
 // RegisterOn mocks base method.
 func (m *MockKafkaRecorder) RegisterOn(registry prometheus.Registerer) KafkaRecorder {
 	m.ctrl.T.Helper()
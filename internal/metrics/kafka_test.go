@@ -40,6 +40,7 @@ func TestNewKafkaRecorder(t *testing.T) {
 	assert.IsType(new(prometheus.CounterVec), recorder.clientProduceCounter)
 	assert.IsType(new(prometheus.CounterVec), recorder.producerSuccessCounter)
 	assert.IsType(new(prometheus.CounterVec), recorder.producerErrorCounter)
+	assert.IsType(new(prometheus.CounterVec), recorder.routingDecisionCounter)
 }
 
 func TestRegisterOn(t *testing.T) {
@@ -53,7 +54,7 @@ func TestRegisterOn(t *testing.T) {
 
 	// Then
 	assert := assert.New(t)
-	assert.Len(testRegistry.collectors, 3)
+	assert.Len(testRegistry.collectors, 4)
 }
 
 func TestUnregister(t *testing.T) {
@@ -66,7 +67,7 @@ func TestUnregister(t *testing.T) {
 	recorder := NewKafkaRecorder()
 	recorder.RegisterOn(testRegistry)
 
-	assert.Len(testRegistry.collectors, 3)
+	assert.Len(testRegistry.collectors, 4)
 
 	// And unregistering metrics
 	recorder.Unregister(testRegistry)
@@ -128,3 +129,20 @@ func TestIncKafkaProducerErrorCounter(t *testing.T) {
 
 	assert.Equal(float64(3), testutil.ToFloat64(recorder.producerErrorCounter))
 }
+
+func TestIncKafkaRoutingDecisionCounter(t *testing.T) {
+	// Given
+	recorder := NewKafkaRecorder()
+
+	testRegistry := &prometheusRegistererMock{}
+	recorder.RegisterOn(testRegistry)
+
+	// When
+	recorder.IncKafkaRoutingDecisionCounter("deletes", "test-topic")
+	recorder.IncKafkaRoutingDecisionCounter("deletes", "test-topic")
+
+	// Then
+	assert := assert.New(t)
+
+	assert.Equal(float64(2), testutil.ToFloat64(recorder.routingDecisionCounter))
+}
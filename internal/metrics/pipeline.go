@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PipelineRecorder allows to record metrics about the change events processing pipeline
+type PipelineRecorder interface {
+	IncCoalescedEventCounter(collection string)
+	IncCoalescerFlushedEventCounter(collection string)
+	IncDeadLetterCounter(stage string, outcome string)
+	SetTombstoneTrackedKeys(collection string, keys int)
+	IncTombstoneUntrackedKeyCounter(collection string)
+	RegisterOn(registry prometheus.Registerer) PipelineRecorder
+	Unregister(registry prometheus.Registerer) PipelineRecorder
+}
+
+type pipelineRecorder struct {
+	coalescedEventCounter        *prometheus.CounterVec
+	coalescerFlushedEventCounter *prometheus.CounterVec
+	deadLetterCounter            *prometheus.CounterVec
+	tombstoneTrackedKeys         *prometheus.GaugeVec
+	tombstoneUntrackedKeyCounter *prometheus.CounterVec
+}
+
+// NewPipelineRecorder returns a pipeline recorder that is used to send metrics
+func NewPipelineRecorder() *pipelineRecorder {
+	return &pipelineRecorder{
+		coalescedEventCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "pipeline",
+				Name:      "coalesced_event_counter_total",
+				Help:      "This represent the number of change events absorbed by a more recent event of the same document",
+			},
+			[]string{"collection"},
+		),
+		coalescerFlushedEventCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "pipeline",
+				Name:      "coalescer_flushed_event_counter_total",
+				Help:      "This represent the number of change events flushed by the coalescer",
+			},
+			[]string{"collection"},
+		),
+		deadLetterCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "pipeline",
+				Name:      "dead_letter_counter_total",
+				Help:      "This represent the number of failed events per stage and outcome (log, dlq, retry, halt)",
+			},
+			[]string{"stage", "outcome"},
+		),
+		tombstoneTrackedKeys: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "pipeline",
+				Name:      "tombstone_tracked_keys",
+				Help:      "This represent the number of document keys remembered to be tombstoned on a collection drop",
+			},
+			[]string{"collection"},
+		),
+		tombstoneUntrackedKeyCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "pipeline",
+				Name:      "tombstone_untracked_key_counter_total",
+				Help:      "This represent the number of document keys not remembered because the tracked keys limit is reached",
+			},
+			[]string{"collection"},
+		),
+	}
+}
+
+// RegisterOn allows to specify a specific Prometheus registry
+func (r *pipelineRecorder) RegisterOn(registry prometheus.Registerer) PipelineRecorder {
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+
+	registry.MustRegister(
+		r.coalescedEventCounter,
+		r.coalescerFlushedEventCounter,
+		r.deadLetterCounter,
+		r.tombstoneTrackedKeys,
+		r.tombstoneUntrackedKeyCounter,
+	)
+
+	return r
+}
+
+// Unregister allows to unregister pipeline metrics from current Prometheus register
+func (r *pipelineRecorder) Unregister(registry prometheus.Registerer) PipelineRecorder {
+	registry.Unregister(r.coalescedEventCounter)
+	registry.Unregister(r.coalescerFlushedEventCounter)
+	registry.Unregister(r.deadLetterCounter)
+	registry.Unregister(r.tombstoneTrackedKeys)
+	registry.Unregister(r.tombstoneUntrackedKeyCounter)
+
+	return r
+}
+
+// IncCoalescedEventCounter increments the coalesced event counter
+func (r *pipelineRecorder) IncCoalescedEventCounter(collection string) {
+	r.coalescedEventCounter.WithLabelValues(collection).Inc()
+}
+
+// IncCoalescerFlushedEventCounter increments the coalescer flushed event counter
+func (r *pipelineRecorder) IncCoalescerFlushedEventCounter(collection string) {
+	r.coalescerFlushedEventCounter.WithLabelValues(collection).Inc()
+}
+
+// IncDeadLetterCounter increments the dead letter counter
+func (r *pipelineRecorder) IncDeadLetterCounter(stage string, outcome string) {
+	r.deadLetterCounter.WithLabelValues(stage, outcome).Inc()
+}
+
+// SetTombstoneTrackedKeys sets the number of document keys tracked for the drop tombstones
+func (r *pipelineRecorder) SetTombstoneTrackedKeys(collection string, keys int) {
+	r.tombstoneTrackedKeys.WithLabelValues(collection).Set(float64(keys))
+}
+
+// IncTombstoneUntrackedKeyCounter increments the counter of the document keys not tracked for the drop tombstones
+func (r *pipelineRecorder) IncTombstoneUntrackedKeyCounter(collection string) {
+	r.tombstoneUntrackedKeyCounter.WithLabelValues(collection).Inc()
+}
@@ -0,0 +1,123 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/metrics/pipeline.go
+
+// Package metrics is a generated GoMock package.
+package metrics
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	prometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// MockPipelineRecorder is a mock of PipelineRecorder interface.
+type MockPipelineRecorder struct {
+	ctrl     *gomock.Controller
+	recorder *MockPipelineRecorderMockRecorder
+}
+
+// MockPipelineRecorderMockRecorder is the mock recorder for MockPipelineRecorder.
+type MockPipelineRecorderMockRecorder struct {
+	mock *MockPipelineRecorder
+}
+
+// NewMockPipelineRecorder creates a new mock instance.
+func NewMockPipelineRecorder(ctrl *gomock.Controller) *MockPipelineRecorder {
+	mock := &MockPipelineRecorder{ctrl: ctrl}
+	mock.recorder = &MockPipelineRecorderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPipelineRecorder) EXPECT() *MockPipelineRecorderMockRecorder {
+	return m.recorder
+}
+
+// IncCoalescedEventCounter mocks base method.
+func (m *MockPipelineRecorder) IncCoalescedEventCounter(collection string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncCoalescedEventCounter", collection)
+}
+
+// IncCoalescedEventCounter indicates an expected call of IncCoalescedEventCounter.
+func (mr *MockPipelineRecorderMockRecorder) IncCoalescedEventCounter(collection interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncCoalescedEventCounter", reflect.TypeOf((*MockPipelineRecorder)(nil).IncCoalescedEventCounter), collection)
+}
+
+// IncCoalescerFlushedEventCounter mocks base method.
+func (m *MockPipelineRecorder) IncCoalescerFlushedEventCounter(collection string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncCoalescerFlushedEventCounter", collection)
+}
+
+// IncCoalescerFlushedEventCounter indicates an expected call of IncCoalescerFlushedEventCounter.
+func (mr *MockPipelineRecorderMockRecorder) IncCoalescerFlushedEventCounter(collection interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncCoalescerFlushedEventCounter", reflect.TypeOf((*MockPipelineRecorder)(nil).IncCoalescerFlushedEventCounter), collection)
+}
+
+// IncDeadLetterCounter mocks base method.
+func (m *MockPipelineRecorder) IncDeadLetterCounter(stage, outcome string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncDeadLetterCounter", stage, outcome)
+}
+
+// IncDeadLetterCounter indicates an expected call of IncDeadLetterCounter.
+func (mr *MockPipelineRecorderMockRecorder) IncDeadLetterCounter(stage, outcome interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncDeadLetterCounter", reflect.TypeOf((*MockPipelineRecorder)(nil).IncDeadLetterCounter), stage, outcome)
+}
+
+// IncTombstoneUntrackedKeyCounter mocks base method.
+func (m *MockPipelineRecorder) IncTombstoneUntrackedKeyCounter(collection string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncTombstoneUntrackedKeyCounter", collection)
+}
+
+// IncTombstoneUntrackedKeyCounter indicates an expected call of IncTombstoneUntrackedKeyCounter.
+func (mr *MockPipelineRecorderMockRecorder) IncTombstoneUntrackedKeyCounter(collection interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncTombstoneUntrackedKeyCounter", reflect.TypeOf((*MockPipelineRecorder)(nil).IncTombstoneUntrackedKeyCounter), collection)
+}
+
+// RegisterOn mocks base method.
+func (m *MockPipelineRecorder) RegisterOn(registry prometheus.Registerer) PipelineRecorder {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterOn", registry)
+	ret0, _ := ret[0].(PipelineRecorder)
+	return ret0
+}
+
+// RegisterOn indicates an expected call of RegisterOn.
+func (mr *MockPipelineRecorderMockRecorder) RegisterOn(registry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterOn", reflect.TypeOf((*MockPipelineRecorder)(nil).RegisterOn), registry)
+}
+
+// SetTombstoneTrackedKeys mocks base method.
+func (m *MockPipelineRecorder) SetTombstoneTrackedKeys(collection string, keys int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetTombstoneTrackedKeys", collection, keys)
+}
+
+// SetTombstoneTrackedKeys indicates an expected call of SetTombstoneTrackedKeys.
+func (mr *MockPipelineRecorderMockRecorder) SetTombstoneTrackedKeys(collection, keys interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTombstoneTrackedKeys", reflect.TypeOf((*MockPipelineRecorder)(nil).SetTombstoneTrackedKeys), collection, keys)
+}
+
+// Unregister mocks base method.
+func (m *MockPipelineRecorder) Unregister(registry prometheus.Registerer) PipelineRecorder {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unregister", registry)
+	ret0, _ := ret[0].(PipelineRecorder)
+	return ret0
+}
+
+// Unregister indicates an expected call of Unregister.
+func (mr *MockPipelineRecorderMockRecorder) Unregister(registry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unregister", reflect.TypeOf((*MockPipelineRecorder)(nil).Unregister), registry)
+}
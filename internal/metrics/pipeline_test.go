@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPipelineRecorder(t *testing.T) {
+	// When
+	recorder := NewPipelineRecorder()
+
+	// Then
+	assert := assert.New(t)
+	assert.IsType(new(pipelineRecorder), recorder)
+	assert.IsType(new(prometheus.CounterVec), recorder.coalescedEventCounter)
+	assert.IsType(new(prometheus.CounterVec), recorder.coalescerFlushedEventCounter)
+	assert.IsType(new(prometheus.CounterVec), recorder.deadLetterCounter)
+	assert.IsType(new(prometheus.GaugeVec), recorder.tombstoneTrackedKeys)
+	assert.IsType(new(prometheus.CounterVec), recorder.tombstoneUntrackedKeyCounter)
+}
+
+func TestPipelineRecorderRegisterOnAndUnregister(t *testing.T) {
+	// Given
+	assert := assert.New(t)
+
+	testRegistry := &prometheusRegistererMock{}
+
+	// When registering metrics
+	recorder := NewPipelineRecorder()
+	recorder.RegisterOn(testRegistry)
+
+	assert.Len(testRegistry.collectors, 5)
+
+	// And unregistering metrics
+	recorder.Unregister(testRegistry)
+
+	// Then
+	assert.Len(testRegistry.collectors, 0)
+}
+
+func TestIncCoalescerCounters(t *testing.T) {
+	// Given
+	recorder := NewPipelineRecorder()
+
+	testRegistry := &prometheusRegistererMock{}
+	recorder.RegisterOn(testRegistry)
+
+	// When
+	recorder.IncCoalescedEventCounter("items")
+	recorder.IncCoalescedEventCounter("items")
+	recorder.IncCoalescerFlushedEventCounter("items")
+
+	// Then
+	assert := assert.New(t)
+
+	assert.Equal(float64(2), testutil.ToFloat64(recorder.coalescedEventCounter))
+	assert.Equal(float64(1), testutil.ToFloat64(recorder.coalescerFlushedEventCounter))
+}
+
+func TestIncDeadLetterCounter(t *testing.T) {
+	// Given
+	recorder := NewPipelineRecorder()
+
+	testRegistry := &prometheusRegistererMock{}
+	recorder.RegisterOn(testRegistry)
+
+	// When
+	recorder.IncDeadLetterCounter("decode", "dlq")
+	recorder.IncDeadLetterCounter("decode", "dlq")
+	recorder.IncDeadLetterCounter("delivery", "retry")
+
+	// Then
+	assert := assert.New(t)
+
+	assert.Equal(float64(2), testutil.ToFloat64(recorder.deadLetterCounter.WithLabelValues("decode", "dlq")))
+	assert.Equal(float64(1), testutil.ToFloat64(recorder.deadLetterCounter.WithLabelValues("delivery", "retry")))
+}
+
+func TestTombstoneKeysMetrics(t *testing.T) {
+	// Given
+	recorder := NewPipelineRecorder()
+
+	testRegistry := &prometheusRegistererMock{}
+	recorder.RegisterOn(testRegistry)
+
+	// When
+	recorder.SetTombstoneTrackedKeys("items", 12)
+	recorder.IncTombstoneUntrackedKeyCounter("items")
+
+	// Then
+	assert := assert.New(t)
+
+	assert.Equal(float64(12), testutil.ToFloat64(recorder.tombstoneTrackedKeys))
+	assert.Equal(float64(1), testutil.ToFloat64(recorder.tombstoneUntrackedKeyCounter))
+}
@@ -0,0 +1,373 @@
+package mongo
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+	"github.com/gol4ng/logger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Coalescer collapses bursts of change events of a same document: events are buffered per document
+// key during a window and only the latest state (or a merged update description) is emitted.
+//
+// Buffered documents are emitted in the order of their last received event, so the emitted events
+// are always a subsequence of the received ones when updates are not merged. The events of
+// multi-document transactions are never coalesced.
+// As events are held back, the checkpoint of an emitted event never goes beyond an event that is
+// still buffered: see ChangeEvent.Checkpoint.
+type Coalescer struct {
+	window       time.Duration
+	maxEvents    int
+	maxKeys      int
+	mergeUpdates bool
+	logger       logger.LoggerInterface
+	recorder     metrics.PipelineRecorder
+}
+
+// CoalescerOption allows to customize the coalescer behavior
+type CoalescerOption func(*Coalescer)
+
+// WithCoalesceMaxEvents flushes a document as soon as the given number of events has been coalesced
+func WithCoalesceMaxEvents(maxEvents int) CoalescerOption {
+	return func(c *Coalescer) {
+		c.maxEvents = maxEvents
+	}
+}
+
+// WithCoalesceMaxKeys bounds the number of buffered documents, the oldest ones being flushed first
+func WithCoalesceMaxKeys(maxKeys int) CoalescerOption {
+	return func(c *Coalescer) {
+		c.maxKeys = maxKeys
+	}
+}
+
+// WithCoalesceMergeUpdates allows to merge the update descriptions of consecutive update events
+// that do not carry the full document
+func WithCoalesceMergeUpdates(enabled bool) CoalescerOption {
+	return func(c *Coalescer) {
+		c.mergeUpdates = enabled
+	}
+}
+
+// WithCoalesceRecorder allows to record the coalesced events
+func WithCoalesceRecorder(recorder metrics.PipelineRecorder) CoalescerOption {
+	return func(c *Coalescer) {
+		c.recorder = recorder
+	}
+}
+
+// NewCoalescer returns a coalescer buffering the events of a document during the given window
+func NewCoalescer(window time.Duration, logger logger.LoggerInterface, options ...CoalescerOption) *Coalescer {
+	coalescer := &Coalescer{
+		window: window,
+		logger: logger,
+	}
+	for _, option := range options {
+		option(coalescer)
+	}
+	return coalescer
+}
+
+// Wrap returns a change event producer emitting the coalesced events of the given producer
+func (c *Coalescer) Wrap(producer ChangeEventProducer) ChangeEventProducer {
+	return func(ctx context.Context) (chan *ChangeEvent, error) {
+		events, err := producer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.Coalesce(events), nil
+	}
+}
+
+// Coalesce returns a channel of the coalesced events, closed once the given channel is closed and
+// all the buffered events have been emitted
+func (c *Coalescer) Coalesce(events chan *ChangeEvent) chan *ChangeEvent {
+	var output = make(chan *ChangeEvent)
+
+	go func() {
+		defer close(output)
+
+		buffer := newCoalesceBuffer(c)
+
+		tick := c.window / 2
+		if tick < time.Millisecond {
+			tick = time.Millisecond
+		}
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					buffer.flushAll(output)
+					return
+				}
+				buffer.add(event, time.Now(), output)
+			case now := <-ticker.C:
+				buffer.flushExpired(now, output)
+			}
+		}
+	}()
+
+	return output
+}
+
+// coalesceEntry holds the pending event of a document
+type coalesceEntry struct {
+	key      string
+	event    *ChangeEvent
+	count    int
+	deadline time.Time
+	// sequence numbers of the first and last received events of the entry
+	firstSeq uint64
+	lastSeq  uint64
+	// resume token of the event received just before the first event of the entry
+	previousToken interface{}
+
+	byLastEvent  *list.Element
+	byFirstEvent *list.Element
+}
+
+type coalesceBuffer struct {
+	*Coalescer
+
+	entries map[string]*coalesceEntry
+	// entries ordered by their last received event (emission order)
+	byLastEvent *list.List
+	// entries ordered by their first received event (deadline order)
+	byFirstEvent *list.List
+
+	seq       uint64
+	lastToken interface{}
+}
+
+func newCoalesceBuffer(c *Coalescer) *coalesceBuffer {
+	return &coalesceBuffer{
+		Coalescer:    c,
+		entries:      map[string]*coalesceEntry{},
+		byLastEvent:  list.New(),
+		byFirstEvent: list.New(),
+	}
+}
+
+func (b *coalesceBuffer) add(event *ChangeEvent, now time.Time, output chan *ChangeEvent) {
+	b.seq++
+	previousToken := b.lastToken
+	b.lastToken = event.ID
+
+	key, err := event.documentID()
+	if err != nil || event.transactionID() != "" {
+		// Events that are not related to a document (drop, rename, ...) act as a barrier, as well as the
+		// events of multi-document transactions that are sent as they are, in order
+		b.flushAll(output)
+		b.emit(event, b.seq, output)
+		return
+	}
+	key = event.namespace() + "/" + key
+
+	if entry, ok := b.entries[key]; ok {
+		if merged, ok := b.coalesce(entry.event, event); ok {
+			b.recordCoalesced(entry.event)
+			entry.event = merged
+			entry.count++
+			entry.lastSeq = b.seq
+			b.byLastEvent.MoveToBack(entry.byLastEvent)
+
+			if b.maxEvents > 0 && entry.count >= b.maxEvents {
+				b.flushUntil(entry, output)
+			}
+			return
+		}
+		b.flushUntil(entry, output)
+	}
+
+	entry := &coalesceEntry{
+		key:           key,
+		event:         event,
+		count:         1,
+		deadline:      now.Add(b.window),
+		firstSeq:      b.seq,
+		lastSeq:       b.seq,
+		previousToken: previousToken,
+	}
+	entry.byLastEvent = b.byLastEvent.PushBack(entry)
+	entry.byFirstEvent = b.byFirstEvent.PushBack(entry)
+	b.entries[key] = entry
+
+	if b.maxEvents > 0 && entry.count >= b.maxEvents {
+		b.flushUntil(entry, output)
+		return
+	}
+
+	// Bound the memory by flushing the oldest documents
+	for b.maxKeys > 0 && len(b.entries) > b.maxKeys {
+		b.flushUntil(b.byLastEvent.Front().Value.(*coalesceEntry), output)
+	}
+}
+
+// Flushes the documents whose window is over
+func (b *coalesceBuffer) flushExpired(now time.Time, output chan *ChangeEvent) {
+	for front := b.byFirstEvent.Front(); front != nil; front = b.byFirstEvent.Front() {
+		entry := front.Value.(*coalesceEntry)
+		if entry.deadline.After(now) {
+			return
+		}
+		b.flushUntil(entry, output)
+	}
+}
+
+func (b *coalesceBuffer) flushAll(output chan *ChangeEvent) {
+	if back := b.byLastEvent.Back(); back != nil {
+		b.flushUntil(back.Value.(*coalesceEntry), output)
+	}
+}
+
+// Flushes the given entry and all the entries whose last event has been received before its one
+func (b *coalesceBuffer) flushUntil(entry *coalesceEntry, output chan *ChangeEvent) {
+	for front := b.byLastEvent.Front(); front != nil; front = b.byLastEvent.Front() {
+		current := front.Value.(*coalesceEntry)
+		b.byLastEvent.Remove(current.byLastEvent)
+		b.byFirstEvent.Remove(current.byFirstEvent)
+		delete(b.entries, current.key)
+
+		b.emit(current.event, current.lastSeq, output)
+		if current == entry {
+			return
+		}
+	}
+}
+
+// Emits the event, with a checkpoint that does not skip the events that are still buffered
+func (b *coalesceBuffer) emit(event *ChangeEvent, lastSeq uint64, output chan *ChangeEvent) {
+	if front := b.byFirstEvent.Front(); front != nil {
+		if pending := front.Value.(*coalesceEntry); pending.firstSeq < lastSeq {
+			event.setCheckpoint(pending.previousToken)
+		}
+	}
+
+	if b.recorder != nil {
+		b.recorder.IncCoalescerFlushedEventCounter(event.collection())
+	}
+	output <- event
+}
+
+func (b *coalesceBuffer) recordCoalesced(event *ChangeEvent) {
+	if b.recorder != nil {
+		b.recorder.IncCoalescedEventCounter(event.collection())
+	}
+}
+
+// Returns the event replacing the pending and received events of a document, if they can be coalesced
+func (b *coalesceBuffer) coalesce(pending *ChangeEvent, received *ChangeEvent) (*ChangeEvent, bool) {
+	// The received event carries the whole document state
+	switch received.Operation {
+	case "insert", "replace", "delete":
+		return received, true
+	case "update":
+		if received.Document != nil {
+			return received, true
+		}
+	default:
+		return nil, false
+	}
+
+	if !b.mergeUpdates || pending.Operation != "update" || pending.Document != nil {
+		return nil, false
+	}
+
+	updates, ok := mergeUpdateDescriptions(pending.Updates, received.Updates)
+	if !ok {
+		return nil, false
+	}
+	b.logger.Debug("Coalescer: Update descriptions merged", logger.String("collection", received.collection()), logger.Any("document_id", received.DocumentKey.ID))
+
+	merged := *received
+	merged.Updates = updates
+	merged.headers = append(append([]kafka.Header{}, pending.headers...), received.headers...)
+	return &merged, true
+}
+
+// Merges two consecutive update descriptions. Descriptions truncating arrays or setting a sub-field
+// of a previously changed field cannot be merged.
+func mergeUpdateDescriptions(previous bson.M, next bson.M) (bson.M, bool) {
+	if previous == nil || next == nil || hasTruncatedArrays(previous) || hasTruncatedArrays(next) {
+		return nil, false
+	}
+
+	previousPaths := updateDescriptionPaths(previous)
+	nextPaths := updateDescriptionPaths(next)
+	for _, nextPath := range nextPaths {
+		for _, previousPath := range previousPaths {
+			if strings.HasPrefix(nextPath, previousPath+".") {
+				return nil, false
+			}
+		}
+	}
+
+	// Changes of the previous description overridden by the next one are discarded
+	overridden := func(path string) bool {
+		for _, nextPath := range nextPaths {
+			if path == nextPath || strings.HasPrefix(path, nextPath+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	updatedFields := bson.M{}
+	if updated, ok := previous["updatedFields"]; ok {
+		for _, field := range documentKeys(updated) {
+			if !overridden(field) {
+				updatedFields[field], _ = documentValue(updated, field)
+			}
+		}
+	}
+	if updated, ok := next["updatedFields"]; ok {
+		for _, field := range documentKeys(updated) {
+			updatedFields[field], _ = documentValue(updated, field)
+		}
+	}
+
+	removedFields := bson.A{}
+	for _, field := range stringValues(previous["removedFields"]) {
+		if !overridden(field) {
+			removedFields = append(removedFields, field)
+		}
+	}
+	for _, field := range stringValues(next["removedFields"]) {
+		removedFields = append(removedFields, field)
+	}
+
+	return bson.M{"updatedFields": updatedFields, "removedFields": removedFields, "truncatedArrays": bson.A{}}, true
+}
+
+func hasTruncatedArrays(updates bson.M) bool {
+	truncated, _ := updates["truncatedArrays"].(bson.A)
+	return len(truncated) > 0
+}
+
+// Returns the paths updated or removed by an update description
+func updateDescriptionPaths(updates bson.M) []string {
+	var paths []string
+	if updated, ok := updates["updatedFields"]; ok {
+		paths = append(paths, documentKeys(updated)...)
+	}
+	return append(paths, stringValues(updates["removedFields"])...)
+}
+
+func stringValues(values interface{}) []string {
+	var result []string
+	array, _ := values.(bson.A)
+	for _, value := range array {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
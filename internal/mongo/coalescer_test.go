@@ -0,0 +1,220 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+	"github.com/gol4ng/logger"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func giveCoalescerEvent(token string, id string, operation string, document bson.M, updates string) *ChangeEvent {
+	event := &ChangeEvent{
+		ID:        bson.D{{Key: "_data", Value: token}},
+		Operation: operation,
+		Namespace: bson.M{"db": "watcher", "coll": "items"},
+		Document:  document,
+	}
+	if id != "" {
+		event.DocumentKey.ID, _ = primitive.ObjectIDFromHex(id)
+	}
+	if updates != "" {
+		if err := bson.UnmarshalExtJSON([]byte(updates), false, &event.Updates); err != nil {
+			panic(err)
+		}
+	}
+	return event
+}
+
+// Sends the events and closes the input channel, returning all the coalesced events
+func coalesceAll(coalescer *Coalescer, events ...*ChangeEvent) []*ChangeEvent {
+	input := make(chan *ChangeEvent, len(events))
+	for _, event := range events {
+		input <- event
+	}
+	close(input)
+
+	var result []*ChangeEvent
+	for event := range coalescer.Coalesce(input) {
+		result = append(result, event)
+	}
+	return result
+}
+
+func tokens(events []*ChangeEvent) (ids []interface{}, checkpoints []interface{}) {
+	for _, event := range events {
+		ids = append(ids, event.ID)
+		checkpoints = append(checkpoints, event.Checkpoint())
+	}
+	return
+}
+
+func token(value string) bson.D {
+	return bson.D{{Key: "_data", Value: value}}
+}
+
+const (
+	documentA = "5ccfdbb519580ee49d50803a"
+	documentB = "5ccfdbb519580ee49d50803b"
+)
+
+func TestCoalescerKeepsLatestStateInOrder(t *testing.T) {
+	// Given
+	coalescer := NewCoalescer(time.Hour, logger.NewNopLogger())
+
+	// When
+	result := coalesceAll(coalescer,
+		giveCoalescerEvent("1", documentA, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("2", documentB, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("3", documentA, "update", bson.M{"v": 2}, `{"updatedFields":{"v":2}}`),
+		giveCoalescerEvent("4", documentA, "replace", bson.M{"v": 3}, ""),
+	)
+
+	// Then
+	ids, checkpoints := tokens(result)
+	assert.Equal(t, []interface{}{token("2"), token("4")}, ids)
+	// B is emitted first while A events (from token 1) are still buffered
+	assert.Equal(t, []interface{}{nil, token("4")}, checkpoints)
+}
+
+func TestCoalescerCheckpointsBeforeBufferedEvents(t *testing.T) {
+	// Given
+	coalescer := NewCoalescer(time.Hour, logger.NewNopLogger())
+
+	// When
+	result := coalesceAll(coalescer,
+		giveCoalescerEvent("1", documentA, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("2", documentB, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("3", documentB, "delete", nil, ""),
+		giveCoalescerEvent("4", documentA, "delete", nil, ""),
+		giveCoalescerEvent("5", documentB, "insert", bson.M{"v": 2}, ""),
+		giveCoalescerEvent("6", "", "drop", nil, ""),
+	)
+
+	// Then
+	ids, checkpoints := tokens(result)
+	assert.Equal(t, []interface{}{token("4"), token("5"), token("6")}, ids)
+	// A is emitted while B events (from token 2) are still buffered
+	assert.Equal(t, []interface{}{token("1"), token("5"), token("6")}, checkpoints)
+}
+
+func TestCoalescerDoesNotReplaceStateByPartialUpdate(t *testing.T) {
+	// Given
+	coalescer := NewCoalescer(time.Hour, logger.NewNopLogger())
+
+	// When
+	result := coalesceAll(coalescer,
+		giveCoalescerEvent("1", documentA, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("2", documentA, "update", nil, `{"updatedFields":{"v":2}}`),
+		giveCoalescerEvent("3", documentA, "update", nil, `{"updatedFields":{"w":1}}`),
+	)
+
+	// Then
+	ids, _ := tokens(result)
+	assert.Equal(t, []interface{}{token("1"), token("2"), token("3")}, ids)
+}
+
+func TestCoalescerMergesUpdateDescriptions(t *testing.T) {
+	// Given
+	coalescer := NewCoalescer(time.Hour, logger.NewNopLogger(), WithCoalesceMergeUpdates(true))
+
+	// When
+	result := coalesceAll(coalescer,
+		giveCoalescerEvent("1", documentA, "update", nil, `{"updatedFields":{"a.b":1,"c":1},"removedFields":["d","e.f"]}`),
+		giveCoalescerEvent("2", documentA, "update", nil, `{"updatedFields":{"a":{"b":2},"d":2},"removedFields":["c"]}`),
+	)
+
+	// Then
+	assert.Len(t, result, 1)
+	assert.Equal(t, token("2"), result[0].ID)
+	assert.Equal(t, bson.M{
+		"updatedFields":   bson.M{"a": bson.M{"b": int32(2)}, "d": int32(2)},
+		"removedFields":   bson.A{"e.f", "c"},
+		"truncatedArrays": bson.A{},
+	}, result[0].Updates)
+}
+
+func TestCoalescerDoesNotMergeConflictingUpdates(t *testing.T) {
+	// Given
+	coalescer := NewCoalescer(time.Hour, logger.NewNopLogger(), WithCoalesceMergeUpdates(true))
+
+	// When
+	result := coalesceAll(coalescer,
+		giveCoalescerEvent("1", documentA, "update", nil, `{"updatedFields":{"a":{"b":1}}}`),
+		giveCoalescerEvent("2", documentA, "update", nil, `{"updatedFields":{"a.b":2}}`),
+		giveCoalescerEvent("3", documentA, "update", nil, `{"updatedFields":{},"truncatedArrays":[{"field":"items","newSize":1}]}`),
+	)
+
+	// Then
+	ids, _ := tokens(result)
+	assert.Equal(t, []interface{}{token("1"), token("2"), token("3")}, ids)
+}
+
+func TestCoalescerMaxEventsAndMaxKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	// Max events
+	result := coalesceAll(NewCoalescer(time.Hour, logger.NewNopLogger(), WithCoalesceMaxEvents(2)),
+		giveCoalescerEvent("1", documentA, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("2", documentA, "replace", bson.M{"v": 2}, ""),
+		giveCoalescerEvent("3", documentA, "replace", bson.M{"v": 3}, ""),
+	)
+	ids, _ := tokens(result)
+	assert.Equal([]interface{}{token("2"), token("3")}, ids)
+
+	// Max keys
+	result = coalesceAll(NewCoalescer(time.Hour, logger.NewNopLogger(), WithCoalesceMaxKeys(1)),
+		giveCoalescerEvent("1", documentA, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("2", documentB, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("3", documentA, "replace", bson.M{"v": 2}, ""),
+	)
+	ids, _ = tokens(result)
+	assert.Equal([]interface{}{token("1"), token("2"), token("3")}, ids)
+}
+
+func TestCoalescerFlushesAfterWindow(t *testing.T) {
+	// Given
+	coalescer := NewCoalescer(20*time.Millisecond, logger.NewNopLogger())
+
+	input := make(chan *ChangeEvent)
+	output := coalescer.Coalesce(input)
+	defer close(input)
+
+	// When
+	input <- giveCoalescerEvent("1", documentA, "insert", bson.M{"v": 1}, "")
+	input <- giveCoalescerEvent("2", documentA, "replace", bson.M{"v": 2}, "")
+
+	// Then
+	select {
+	case event := <-output:
+		assert.Equal(t, token("2"), event.ID)
+	case <-time.After(time.Second):
+		t.Fatal("the coalesced event should have been flushed after the window")
+	}
+}
+
+func TestCoalescerRecordsCoalescedEvents(t *testing.T) {
+	// Given
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := metrics.NewMockPipelineRecorder(ctrl)
+	recorder.EXPECT().IncCoalescedEventCounter("items").Times(2)
+	recorder.EXPECT().IncCoalescerFlushedEventCounter("items").Times(1)
+
+	coalescer := NewCoalescer(time.Hour, logger.NewNopLogger(), WithCoalesceRecorder(recorder))
+
+	// When
+	result := coalesceAll(coalescer,
+		giveCoalescerEvent("1", documentA, "insert", bson.M{"v": 1}, ""),
+		giveCoalescerEvent("2", documentA, "replace", bson.M{"v": 2}, ""),
+		giveCoalescerEvent("3", documentA, "delete", nil, ""),
+	)
+
+	// Then
+	assert.Len(t, result, 1)
+}
@@ -2,34 +2,114 @@ package mongo
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type documentKey struct {
 	ID primitive.ObjectID `bson:"_id"`
+	// Shard key fields of the documents of a sharded collection
+	Fields bson.M `bson:",inline"`
 }
 
 // ChangeEvent document according
 // https://docs.mongodb.com/manual/reference/change-events/#change-stream-output
 type ChangeEvent struct {
-	ID                interface{} `bson:"_id"`
-	Operation         string      `bson:"operationType"`
-	Document          bson.M      `bson:"fullDocument"`
-	Namespace         bson.M      `bson:"ns"`
-	NewCollectionName bson.M      `bson:"to,omitempty"`
-	DocumentKey       documentKey `bson:"documentKey"`
-	Updates           bson.M      `bson:"updateDescription,omitempty"`
-	ClusterTime       time.Time   `bson:"clusterTime"`
-	Transaction       int64       `bson:"txnNumber,omitempty"`
-	SessionID         bson.M      `bson:"lsid,omitempty"`
+	ID                interface{}         `bson:"_id"`
+	Operation         string              `bson:"operationType"`
+	Document          bson.M              `bson:"fullDocument"`
+	Namespace         bson.M              `bson:"ns"`
+	NewCollectionName bson.M              `bson:"to,omitempty"`
+	DocumentKey       documentKey         `bson:"documentKey"`
+	Updates           bson.M              `bson:"updateDescription,omitempty"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+	WallTime          time.Time           `bson:"wallTime,omitempty"`
+	Patch             interface{}         `bson:"patch,omitempty"`
+	Transaction       int64               `bson:"txnNumber,omitempty"`
+	SessionID         bson.M              `bson:"lsid,omitempty"`
+
+	// Headers added while processing the event, sent with its Kafka messages
+	headers []kafka.Header
+
+	// Resume token to checkpoint once the event is delivered, when it differs from the event one
+	// because events received before it are still held back
+	checkpoint    interface{}
+	hasCheckpoint bool
+
+	// Position of the event in its multi-document transaction, set by the TransactionGrouper
+	txn *transactionEvent
+}
+
+// Checkpoint returns the resume token from which the change stream can be resumed without missing
+// any event once this event is delivered. A nil token means that no position is safe yet.
+func (e ChangeEvent) Checkpoint() interface{} {
+	if e.hasCheckpoint {
+		return e.checkpoint
+	}
+	return e.ID
+}
+
+func (e *ChangeEvent) setCheckpoint(token interface{}) {
+	e.checkpoint = token
+	e.hasCheckpoint = true
+}
+
+// ClusterTimeFormat defines how the event cluster time is represented in the payload
+type ClusterTimeFormat string
+
+const (
+	// ClusterTimeFormatDate sends the cluster time as a date, with a second precision
+	ClusterTimeFormatDate ClusterTimeFormat = "date"
+	// ClusterTimeFormatTimestamp sends the full BSON timestamp, keeping the increment that orders
+	// the operations of a same second
+	ClusterTimeFormatTimestamp ClusterTimeFormat = "timestamp"
+)
+
+// ParseClusterTimeFormat returns the cluster time format matching the given name
+func ParseClusterTimeFormat(format string) (ClusterTimeFormat, error) {
+	switch ClusterTimeFormat(format) {
+	case ClusterTimeFormatDate, ClusterTimeFormatTimestamp:
+		return ClusterTimeFormat(format), nil
+	case "":
+		return ClusterTimeFormatDate, nil
+	}
+	return "", fmt.Errorf("unknown cluster time format %q (available: date, timestamp)", format)
 }
 
 // marshall event to an array of bytes
-func (e ChangeEvent) marshal() ([]byte, error) {
-	return bson.MarshalExtJSON(e, true, true)
+func (e ChangeEvent) marshal(format ClusterTimeFormat) ([]byte, error) {
+	if format == ClusterTimeFormatTimestamp {
+		return bson.MarshalExtJSON(e, true, true)
+	}
+
+	raw, err := bson.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	var document bson.D
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	for i := range document {
+		if document[i].Key == "clusterTime" {
+			document[i].Value = e.clusterDate()
+		}
+	}
+	return bson.MarshalExtJSON(document, true, true)
+}
+
+// return the cluster time as the date formerly sent in the payload
+func (e ChangeEvent) clusterDate() time.Time {
+	if e.ClusterTime.IsZero() {
+		return time.Time{}
+	}
+	return time.Unix(int64(e.ClusterTime.T), 0)
 }
 
 // return the document id of the event
@@ -40,3 +120,61 @@ func (e ChangeEvent) documentID() (string, error) {
 	}
 	return id.Hex(), nil
 }
+
+// return the database name of the event namespace
+func (e ChangeEvent) database() string {
+	db, _ := e.Namespace["db"].(string)
+	return db
+}
+
+// return the collection name of the event namespace
+func (e ChangeEvent) collection() string {
+	coll, _ := e.Namespace["coll"].(string)
+	return coll
+}
+
+// return the event namespace as "<db>.<collection>"
+func (e ChangeEvent) namespace() string {
+	return e.database() + "." + e.collection()
+}
+
+// return the value of a (dotted) field path of the full document
+func (e ChangeEvent) documentField(path string) (interface{}, bool) {
+	value, ok := lookupPath(e.Document, strings.Split(path, "."))
+	return value, ok && value != nil
+}
+
+// return the value of a (dotted) field path of the full document, or of the document key when the
+// event has no such full document field, such as the deletes of a sharded collection by shard key
+func (e ChangeEvent) keyField(path string) (interface{}, bool) {
+	if value, ok := e.documentField(path); ok {
+		return value, true
+	}
+	value, ok := lookupPath(e.DocumentKey.Fields, strings.Split(path, "."))
+	return value, ok && value != nil
+}
+
+// FormatOperationTime returns the "<T>,<I>" representation of a cluster timestamp
+func FormatOperationTime(timestamp primitive.Timestamp) string {
+	return strconv.FormatUint(uint64(timestamp.T), 10) + "," + strconv.FormatUint(uint64(timestamp.I), 10)
+}
+
+// ParseOperationTime decodes a "<T>[,<I>]" cluster timestamp, as sent in the cluster time header
+func ParseOperationTime(value string) (primitive.Timestamp, error) {
+	t, i, found := strings.Cut(strings.TrimSpace(value), ",")
+
+	seconds, err := strconv.ParseUint(strings.TrimSpace(t), 10, 32)
+	if err != nil {
+		return primitive.Timestamp{}, fmt.Errorf("invalid operation time %q: %w", value, err)
+	}
+
+	var increment uint64
+	if found {
+		increment, err = strconv.ParseUint(strings.TrimSpace(i), 10, 32)
+		if err != nil {
+			return primitive.Timestamp{}, fmt.Errorf("invalid operation time %q: %w", value, err)
+		}
+	}
+
+	return primitive.Timestamp{T: uint32(seconds), I: uint32(increment)}, nil
+}
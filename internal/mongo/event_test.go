@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -31,3 +32,49 @@ func Test_documentID(t *testing.T) {
 	_, err = event.documentID()
 	assert.Error(t, err)
 }
+
+func TestParseOperationTime(t *testing.T) {
+	assert := assert.New(t)
+
+	timestamp, err := ParseOperationTime("1600000000,3")
+	assert.Nil(err)
+	assert.Equal(primitive.Timestamp{T: 1600000000, I: 3}, timestamp)
+	assert.Equal("1600000000,3", FormatOperationTime(timestamp))
+
+	timestamp, err = ParseOperationTime("1600000000")
+	assert.Nil(err)
+	assert.Equal(primitive.Timestamp{T: 1600000000}, timestamp)
+
+	_, err = ParseOperationTime("1600000000,abc")
+	assert.Error(err)
+
+	_, err = ParseOperationTime("")
+	assert.Error(err)
+}
+
+func TestChangeEventKeepsClusterTimeIncrement(t *testing.T) {
+	event := ChangeEvent{ClusterTime: primitive.Timestamp{T: 1600000000, I: 3}}
+
+	payload, err := event.marshal(ClusterTimeFormatTimestamp)
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `"clusterTime":{"$timestamp":{"t":1600000000,"i":3}}`)
+
+	var decoded ChangeEvent
+	assert.NoError(t, bson.UnmarshalExtJSON(payload, true, &decoded))
+	assert.Equal(t, event.ClusterTime, decoded.ClusterTime)
+}
+
+func TestChangeEventSendsClusterTimeAsDateByDefault(t *testing.T) {
+	event := ChangeEvent{Operation: "insert", ClusterTime: primitive.Timestamp{T: 1600000000, I: 3}}
+
+	format, err := ParseClusterTimeFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, ClusterTimeFormatDate, format)
+
+	payload, err := event.marshal(format)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"_id":null,"operationType":"insert","fullDocument":null,"ns":null,"documentKey":{"_id":{"$oid":"000000000000000000000000"}},"clusterTime":{"$date":{"$numberLong":"1600000000000"}}}`, string(payload))
+
+	_, err = ParseClusterTimeFormat("unknown")
+	assert.Error(t, err)
+}
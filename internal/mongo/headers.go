@@ -0,0 +1,213 @@
+package mongo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Change event metadata that can be sent as Kafka message headers
+const (
+	HeaderOperation   = "operation"
+	HeaderDatabase    = "database"
+	HeaderCollection  = "collection"
+	HeaderDocumentID  = "document-id"
+	HeaderClusterTime = "cluster-time"
+	HeaderResumeToken = "resume-token"
+	HeaderTxnNumber   = "txn-number"
+	HeaderSessionID   = "lsid"
+)
+
+var headerMetadataGetters = map[string]func(event *ChangeEvent) ([]byte, bool){
+	HeaderOperation: func(event *ChangeEvent) ([]byte, bool) {
+		return []byte(event.Operation), event.Operation != ""
+	},
+	HeaderDatabase: func(event *ChangeEvent) ([]byte, bool) {
+		return []byte(event.database()), event.database() != ""
+	},
+	HeaderCollection: func(event *ChangeEvent) ([]byte, bool) {
+		return []byte(event.collection()), event.collection() != ""
+	},
+	HeaderDocumentID: func(event *ChangeEvent) ([]byte, bool) {
+		documentID, err := event.documentID()
+		return []byte(documentID), err == nil
+	},
+	HeaderClusterTime: func(event *ChangeEvent) ([]byte, bool) {
+		if event.ClusterTime.IsZero() {
+			return nil, false
+		}
+		return []byte(FormatOperationTime(event.ClusterTime)), true
+	},
+	HeaderResumeToken: func(event *ChangeEvent) ([]byte, bool) {
+		return headerValue(event.ID)
+	},
+	HeaderTxnNumber: func(event *ChangeEvent) ([]byte, bool) {
+		if event.Transaction == 0 {
+			return nil, false
+		}
+		return []byte(strconv.FormatInt(event.Transaction, 10)), true
+	},
+	HeaderSessionID: func(event *ChangeEvent) ([]byte, bool) {
+		if len(event.SessionID) == 0 {
+			return nil, false
+		}
+		return headerValue(event.SessionID)
+	},
+}
+
+// HeaderMapping associates a source (metadata name or document field) to a Kafka header name
+type HeaderMapping struct {
+	Source string
+	Name   string
+}
+
+// ParseHeaderMappings decodes a comma-separated list of "<source>[=<header name>]" mappings.
+// When no header name is given, the source is used as header name.
+func ParseHeaderMappings(mappings string) []HeaderMapping {
+	var result []HeaderMapping
+	for _, mapping := range strings.Split(mappings, ",") {
+		mapping = strings.TrimSpace(mapping)
+		if mapping == "" {
+			continue
+		}
+
+		source, name, found := strings.Cut(mapping, "=")
+		source = strings.TrimSpace(source)
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			name = source
+		}
+
+		result = append(result, HeaderMapping{Source: source, Name: name})
+	}
+	return result
+}
+
+// ParseStaticHeaders decodes a comma-separated list of "<header name>=<value>" static headers
+func ParseStaticHeaders(headers string) ([]kafka.Header, error) {
+	var result []kafka.Header
+	for _, header := range strings.Split(headers, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(header, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("static header %q should be declared as <name>=<value>", header)
+		}
+
+		result = append(result, kafka.Header{Key: strings.TrimSpace(name), Value: []byte(strings.TrimSpace(value))})
+	}
+	return result, nil
+}
+
+// HeaderBuilder builds the Kafka message headers of a change event
+type HeaderBuilder struct {
+	prefix   string
+	metadata []HeaderMapping
+	fields   []HeaderMapping
+	static   []kafka.Header
+}
+
+// Build returns the headers of the given change event, metadata or fields that are
+// not available on the event are omitted
+func (b *HeaderBuilder) Build(event *ChangeEvent) []kafka.Header {
+	var headers = make([]kafka.Header, 0, len(b.metadata)+len(b.fields)+len(b.static))
+
+	for _, mapping := range b.metadata {
+		if value, ok := headerMetadataGetters[mapping.Source](event); ok {
+			headers = append(headers, kafka.Header{Key: b.prefix + mapping.Name, Value: value})
+		}
+	}
+
+	for _, mapping := range b.fields {
+		field, ok := event.documentField(mapping.Source)
+		if !ok {
+			continue
+		}
+		if value, ok := headerValue(field); ok {
+			headers = append(headers, kafka.Header{Key: b.prefix + mapping.Name, Value: value})
+		}
+	}
+
+	return append(headers, b.static...)
+}
+
+// NewHeaderBuilder returns a header builder prefixing the metadata and document field
+// headers with the given prefix
+func NewHeaderBuilder(prefix string, o ...HeaderOption) (*HeaderBuilder, error) {
+	builder := &HeaderBuilder{
+		prefix: prefix,
+	}
+
+	for _, option := range o {
+		if err := option(builder); err != nil {
+			return nil, err
+		}
+	}
+
+	return builder, nil
+}
+
+type HeaderOption func(*HeaderBuilder) error
+
+// WithMetadataHeaders allows to specify the change event metadata to send as headers
+func WithMetadataHeaders(mappings []HeaderMapping) HeaderOption {
+	return func(b *HeaderBuilder) error {
+		for _, mapping := range mappings {
+			if _, ok := headerMetadataGetters[mapping.Source]; !ok {
+				return fmt.Errorf("unknown change event metadata header %q", mapping.Source)
+			}
+		}
+		b.metadata = append(b.metadata, mappings...)
+		return nil
+	}
+}
+
+// WithDocumentFieldHeaders allows to copy (dotted) full document fields values into headers
+func WithDocumentFieldHeaders(mappings []HeaderMapping) HeaderOption {
+	return func(b *HeaderBuilder) error {
+		b.fields = append(b.fields, mappings...)
+		return nil
+	}
+}
+
+// WithStaticHeaders allows to add headers with a static value (sent as is, without prefix)
+func WithStaticHeaders(headers []kafka.Header) HeaderOption {
+	return func(b *HeaderBuilder) error {
+		b.static = append(b.static, headers...)
+		return nil
+	}
+}
+
+func headerValue(value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case string:
+		return []byte(v), true
+	case []byte:
+		return v, true
+	case primitive.ObjectID:
+		return []byte(v.Hex()), true
+	case primitive.DateTime:
+		return []byte(v.Time().UTC().Format(time.RFC3339Nano)), true
+	case time.Time:
+		return []byte(v.UTC().Format(time.RFC3339Nano)), true
+	case bson.M, bson.D, bson.A, map[string]interface{}:
+		bytes, err := bson.MarshalExtJSON(bson.M{"v": v}, false, false)
+		if err != nil {
+			return nil, false
+		}
+		// Strip the {"v": ...} wrapper used to marshal non-document values
+		return bytes[len(`{"v":`) : len(bytes)-1], true
+	default:
+		return []byte(fmt.Sprint(v)), true
+	}
+}
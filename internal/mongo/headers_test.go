@@ -0,0 +1,90 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseHeaderMappings(t *testing.T) {
+	mappings := ParseHeaderMappings(" operation, collection=coll ,, document-id= ")
+
+	assert.Equal(t, []HeaderMapping{
+		{Source: "operation", Name: "operation"},
+		{Source: "collection", Name: "coll"},
+		{Source: "document-id", Name: "document-id"},
+	}, mappings)
+}
+
+func TestParseStaticHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	headers, err := ParseStaticHeaders("x-env=prod, x-team = core")
+	assert.Nil(err)
+	assert.Equal([]kafka.Header{
+		{Key: "x-env", Value: []byte("prod")},
+		{Key: "x-team", Value: []byte("core")},
+	}, headers)
+
+	_, err = ParseStaticHeaders("x-env")
+	assert.Error(err)
+}
+
+func TestNewHeaderBuilderWhenUnknownMetadata(t *testing.T) {
+	_, err := NewHeaderBuilder("x-", WithMetadataHeaders(ParseHeaderMappings("unknown")))
+
+	assert.EqualError(t, err, `unknown change event metadata header "unknown"`)
+}
+
+func TestHeaderBuilderBuild(t *testing.T) {
+	// Given
+	objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	event := &ChangeEvent{
+		ID:          bson.D{{Key: "_data", Value: "826"}},
+		Operation:   "update",
+		Namespace:   bson.M{"db": "watcher", "coll": "items"},
+		DocumentKey: documentKey{ID: objectID},
+		Document:    bson.M{"tenant": bson.M{"name": "acme"}, "version": int32(3), "owner": objectID},
+		ClusterTime: primitive.Timestamp{T: 1600000000, I: 3},
+		Transaction: 12,
+		SessionID:   bson.M{"uid": "abc"},
+	}
+
+	builder, err := NewHeaderBuilder(
+		"x-mongo-",
+		WithMetadataHeaders(ParseHeaderMappings("operation=op,database,collection,document-id,cluster-time,resume-token,txn-number,lsid")),
+		WithDocumentFieldHeaders(ParseHeaderMappings("tenant.name=tenant,version,owner,missing")),
+		WithStaticHeaders([]kafka.Header{{Key: "x-env", Value: []byte("prod")}}),
+	)
+	assert.Nil(t, err)
+
+	// When
+	headers := builder.Build(event)
+
+	// Then
+	assert.Equal(t, []kafka.Header{
+		{Key: "x-mongo-op", Value: []byte("update")},
+		{Key: "x-mongo-database", Value: []byte("watcher")},
+		{Key: "x-mongo-collection", Value: []byte("items")},
+		{Key: "x-mongo-document-id", Value: []byte("5ccfdbb519580ee49d50803c")},
+		{Key: "x-mongo-cluster-time", Value: []byte("1600000000,3")},
+		{Key: "x-mongo-resume-token", Value: []byte(`{"_data":"826"}`)},
+		{Key: "x-mongo-txn-number", Value: []byte("12")},
+		{Key: "x-mongo-lsid", Value: []byte(`{"uid":"abc"}`)},
+		{Key: "x-mongo-tenant", Value: []byte("acme")},
+		{Key: "x-mongo-version", Value: []byte("3")},
+		{Key: "x-mongo-owner", Value: []byte("5ccfdbb519580ee49d50803c")},
+		{Key: "x-env", Value: []byte("prod")},
+	}, headers)
+}
+
+func TestHeaderBuilderBuildOmitsMissingMetadata(t *testing.T) {
+	builder, _ := NewHeaderBuilder("x-mongo-", WithMetadataHeaders(ParseHeaderMappings("cluster-time,resume-token,txn-number,lsid")))
+
+	headers := builder.Build(&ChangeEvent{})
+
+	assert.Len(t, headers, 0)
+}
@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+)
+
+// Available Kafka message partition sources
+const (
+	PartitionSourceKey       = "key"
+	PartitionSourceField     = "field"
+	PartitionSourceFieldHash = "field-hash"
+)
+
+// PartitionSource sets the partition of the messages of a change event. Messages without partition,
+// or without partition key, are partitioned from their key by the producer partitioner.
+type PartitionSource func(event *ChangeEvent, message *kafka.Message) error
+
+// ParsePartitionSource returns the partition source matching the given name, the field is used by
+// the "field" source, holding the partition, and by the "field-hash" source, hashed to the partition
+func ParsePartitionSource(source string, field string) (PartitionSource, error) {
+	switch source {
+	case PartitionSourceKey, "":
+		return nil, nil
+	case PartitionSourceField, PartitionSourceFieldHash:
+		if field == "" {
+			return nil, fmt.Errorf("a document field should be specified with the %q partition source", source)
+		}
+	default:
+		return nil, fmt.Errorf("unknown partition source %q (available: key, field, field-hash)", source)
+	}
+
+	if source == PartitionSourceField {
+		return func(event *ChangeEvent, message *kafka.Message) error {
+			value, ok := event.keyField(field)
+			if !ok {
+				return nil
+			}
+			partition, ok := partitionValue(value)
+			if !ok {
+				return fmt.Errorf("document field %q is not a valid partition: %v", field, value)
+			}
+			message.Partition = &partition
+			return nil
+		}, nil
+	}
+
+	return func(event *ChangeEvent, message *kafka.Message) error {
+		value, ok := event.keyField(field)
+		if !ok {
+			return nil
+		}
+		message.PartitionKey, _ = headerValue(value)
+		return nil
+	}, nil
+}
+
+func partitionValue(value interface{}) (int32, bool) {
+	var partition float64
+	switch v := value.(type) {
+	case int32:
+		partition = float64(v)
+	case int64:
+		partition = float64(v)
+	case int:
+		partition = float64(v)
+	case float64:
+		partition = v
+	default:
+		return 0, false
+	}
+
+	if partition < 0 || partition > math.MaxInt32 || partition != math.Trunc(partition) {
+		return 0, false
+	}
+	return int32(partition), true
+}
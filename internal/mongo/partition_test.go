@@ -0,0 +1,95 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParsePartitionSource(t *testing.T) {
+	assert := assert.New(t)
+
+	source, err := ParsePartitionSource("key", "")
+	assert.Nil(err)
+	assert.Nil(source)
+
+	_, err = ParsePartitionSource("field", "")
+	assert.Error(err)
+
+	_, err = ParsePartitionSource("field-hash", "")
+	assert.Error(err)
+
+	_, err = ParsePartitionSource("unknown", "shard")
+	assert.Error(err)
+}
+
+func TestPartitionSourcesFallBackToDocumentKey(t *testing.T) {
+	// Given a delete of a sharded collection, without full document
+	event := &ChangeEvent{
+		Operation:   "delete",
+		DocumentKey: documentKey{ID: primitive.NewObjectID(), Fields: bson.M{"shard": int32(3)}},
+	}
+
+	source, err := ParsePartitionSource(PartitionSourceField, "shard")
+	assert.NoError(t, err)
+
+	// When
+	message := &kafka.Message{}
+	err = source(event, message)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), *message.Partition)
+}
+
+func TestPartitionSources(t *testing.T) {
+	userID := primitive.NewObjectID()
+	event := &ChangeEvent{
+		Document: bson.M{
+			"shard":    int32(3),
+			"big":      int64(7),
+			"float":    2.0,
+			"negative": int32(-1),
+			"name":     "shard",
+			"user":     bson.M{"id": userID},
+		},
+	}
+
+	partition := func(partition int32) *int32 { return &partition }
+
+	testCases := []struct {
+		source   string
+		field    string
+		expected *kafka.Message
+		err      bool
+	}{
+		{source: PartitionSourceField, field: "shard", expected: &kafka.Message{Partition: partition(3)}},
+		{source: PartitionSourceField, field: "big", expected: &kafka.Message{Partition: partition(7)}},
+		{source: PartitionSourceField, field: "float", expected: &kafka.Message{Partition: partition(2)}},
+		{source: PartitionSourceField, field: "missing", expected: &kafka.Message{}},
+		{source: PartitionSourceField, field: "negative", err: true},
+		{source: PartitionSourceField, field: "name", err: true},
+		{source: PartitionSourceFieldHash, field: "name", expected: &kafka.Message{PartitionKey: []byte("shard")}},
+		{source: PartitionSourceFieldHash, field: "user.id", expected: &kafka.Message{PartitionKey: []byte(userID.Hex())}},
+		{source: PartitionSourceFieldHash, field: "missing", expected: &kafka.Message{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.source+testCase.field, func(t *testing.T) {
+			source, err := ParsePartitionSource(testCase.source, testCase.field)
+			assert.Nil(t, err)
+
+			message := &kafka.Message{}
+			err = source(event, message)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.expected, message)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UpdateFormat defines how document changes are represented in the payload
+type UpdateFormat string
+
+const (
+	// UpdateFormatMongo keeps the MongoDB updateDescription
+	UpdateFormatMongo UpdateFormat = "mongo"
+	// UpdateFormatJSONPatch represents changes as a RFC 6902 JSON Patch document
+	UpdateFormatJSONPatch UpdateFormat = "json-patch"
+	// UpdateFormatMergePatch represents changes as a RFC 7396 JSON Merge Patch
+	UpdateFormatMergePatch UpdateFormat = "merge-patch"
+)
+
+var (
+	errPatchNeedsFullDocument = errors.New("the full document is needed to convert nested or array changes")
+	errMergePatchNullValue    = errors.New("a null value cannot be set with a JSON Merge Patch, where it means a removal")
+)
+
+// ParseUpdateFormat returns the update format matching the given name
+func ParseUpdateFormat(format string) (UpdateFormat, error) {
+	switch UpdateFormat(format) {
+	case UpdateFormatMongo, UpdateFormatJSONPatch, UpdateFormatMergePatch:
+		return UpdateFormat(format), nil
+	case "":
+		return UpdateFormatMongo, nil
+	}
+	return "", fmt.Errorf("unknown update format %q (available: mongo, json-patch, merge-patch)", format)
+}
+
+// Converts the event changes into the given format: update descriptions are replaced by a patch
+// and inserted/replaced documents are expressed as a full document replacement.
+// When the patch cannot be computed, the event is left untouched and an error is returned.
+func (e *ChangeEvent) applyUpdateFormat(format UpdateFormat) error {
+	if format == UpdateFormatMongo || format == "" {
+		return nil
+	}
+
+	switch e.Operation {
+	case "insert", "replace":
+		if e.Document == nil {
+			return nil
+		}
+		if format == UpdateFormatJSONPatch {
+			e.Patch = bson.A{jsonPatchOperation("replace", "", e.Document, true)}
+		} else {
+			e.Patch = e.Document
+		}
+	case "update":
+		if e.Updates == nil {
+			return nil
+		}
+		changes, err := e.documentChanges()
+		if err != nil {
+			return err
+		}
+		if format == UpdateFormatJSONPatch {
+			patch, err := changes.jsonPatch(e.Document)
+			if err != nil {
+				return err
+			}
+			e.Patch = patch
+		} else {
+			patch, err := changes.mergePatch()
+			if err != nil {
+				return err
+			}
+			e.Patch = patch
+		}
+		e.Updates = nil
+	}
+
+	return nil
+}
+
+// documentChange is a set (or removal when removed is true) of the value at the given path
+type documentChange struct {
+	path    []string
+	value   interface{}
+	removed bool
+	// the path goes through an array element and the full document is not known
+	ambiguous bool
+}
+
+type documentChanges []documentChange
+
+// Returns the changes described by the update description. Changes going through arrays
+// are collapsed to a replacement of the whole (top-most) array when the full document is known.
+func (e *ChangeEvent) documentChanges() (documentChanges, error) {
+	var changes documentChanges
+	var collapsed = map[string]bool{}
+
+	addChange := func(path []string, value interface{}, removed bool) {
+		if e.Document != nil {
+			if arrayPath, ok := topMostArrayPath(e.Document, path); ok {
+				key := strings.Join(arrayPath, ".")
+				if !collapsed[key] {
+					collapsed[key] = true
+					arrayValue, _ := lookupPath(e.Document, arrayPath)
+					changes = append(changes, documentChange{path: arrayPath, value: arrayValue})
+				}
+				return
+			}
+		}
+		changes = append(changes, documentChange{path: path, value: value, removed: removed, ambiguous: e.Document == nil && hasNumericComponent(path)})
+	}
+
+	if truncated, ok := e.Updates["truncatedArrays"].(bson.A); ok && len(truncated) > 0 {
+		if e.Document == nil {
+			return nil, errPatchNeedsFullDocument
+		}
+		for _, truncation := range truncated {
+			field, _ := documentValue(truncation, "field")
+			if path, ok := field.(string); ok {
+				addChange(strings.Split(path, "."), nil, false)
+			}
+		}
+	}
+
+	if removed, ok := e.Updates["removedFields"].(bson.A); ok {
+		for _, field := range removed {
+			if path, ok := field.(string); ok {
+				addChange(strings.Split(path, "."), nil, true)
+			}
+		}
+	}
+
+	if updated, ok := e.Updates["updatedFields"]; ok {
+		for _, field := range documentKeys(updated) {
+			value, _ := documentValue(updated, field)
+			addChange(strings.Split(field, "."), value, false)
+		}
+	}
+
+	return changes, nil
+}
+
+// Returns a RFC 6902 JSON Patch. Top-level members are set with the "add" operation that also
+// replaces existing members. As "add" fails when the parent of the target does not exist, while
+// MongoDB creates the missing parents, a nested member is set by replacing its whole top-level
+// member with its value in the full document. Nested changes cannot be converted without it.
+func (c documentChanges) jsonPatch(document bson.M) (bson.A, error) {
+	var patch = make(bson.A, 0, len(c))
+	var replaced = map[string]bool{}
+	for _, change := range c {
+		switch {
+		case change.removed:
+			patch = append(patch, jsonPatchOperation("remove", jsonPointer(change.path), nil, false))
+		case len(change.path) == 1:
+			patch = append(patch, jsonPatchOperation("add", jsonPointer(change.path), change.value, true))
+		case document == nil:
+			return nil, errPatchNeedsFullDocument
+		default:
+			member := change.path[0]
+			if replaced[member] {
+				continue
+			}
+			replaced[member] = true
+			value, _ := documentValue(document, member)
+			patch = append(patch, jsonPatchOperation("add", jsonPointer(change.path[:1]), value, true))
+		}
+	}
+	return patch, nil
+}
+
+// Returns a RFC 7396 JSON Merge Patch, array changes can only be expressed as a whole array replacement.
+// Null values cannot be set as they mean a removal.
+func (c documentChanges) mergePatch() (bson.M, error) {
+	var patch = bson.M{}
+	for _, change := range c {
+		if change.ambiguous {
+			return nil, errPatchNeedsFullDocument
+		}
+		if !change.removed && hasNullMember(change.value) {
+			return nil, errMergePatchNullValue
+		}
+
+		current := patch
+		for _, component := range change.path[:len(change.path)-1] {
+			next, ok := current[component].(bson.M)
+			if !ok {
+				next = bson.M{}
+				current[component] = next
+			}
+			current = next
+		}
+
+		last := change.path[len(change.path)-1]
+		if change.removed {
+			current[last] = nil
+		} else {
+			current[last] = change.value
+		}
+	}
+	return patch, nil
+}
+
+func jsonPatchOperation(op string, path string, value interface{}, withValue bool) bson.D {
+	operation := bson.D{{Key: "op", Value: op}, {Key: "path", Value: path}}
+	if withValue {
+		operation = append(operation, bson.E{Key: "value", Value: value})
+	}
+	return operation
+}
+
+// Returns the RFC 6901 JSON Pointer of a path
+func jsonPointer(path []string) string {
+	var pointer strings.Builder
+	for _, component := range path {
+		pointer.WriteString("/")
+		pointer.WriteString(strings.ReplaceAll(strings.ReplaceAll(component, "~", "~0"), "/", "~1"))
+	}
+	return pointer.String()
+}
+
+// Returns the path of the first array the given path goes through (or targets) in the document
+func topMostArrayPath(document interface{}, path []string) ([]string, bool) {
+	var current = document
+	for index, component := range path {
+		if isArray(current) {
+			return path[:index], true
+		}
+		value, ok := documentValue(current, component)
+		if !ok {
+			return nil, false
+		}
+		current = value
+	}
+	return path, isArray(current)
+}
+
+// Tells whether the value is null or is a document holding a null member, array elements being
+// left aside as arrays are replaced as a whole
+func hasNullMember(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	switch value.(type) {
+	case bson.M, map[string]interface{}, bson.D:
+		for _, key := range documentKeys(value) {
+			if member, _ := documentValue(value, key); hasNullMember(member) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasNumericComponent(path []string) bool {
+	for _, component := range path {
+		if _, err := strconv.Atoi(component); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isArray(value interface{}) bool {
+	switch value.(type) {
+	case bson.A, []interface{}:
+		return true
+	}
+	return false
+}
+
+// Returns the value at the given path, numeric components being array indexes for arrays
+func lookupPath(document interface{}, path []string) (interface{}, bool) {
+	var value = document
+	for _, component := range path {
+		var ok bool
+		if value, ok = documentValue(value, component); !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Returns the value of a document key or array index
+func documentValue(container interface{}, key string) (interface{}, bool) {
+	switch document := container.(type) {
+	case bson.M:
+		value, ok := document[key]
+		return value, ok
+	case map[string]interface{}:
+		value, ok := document[key]
+		return value, ok
+	case bson.D:
+		for _, element := range document {
+			if element.Key == key {
+				return element.Value, true
+			}
+		}
+	case bson.A:
+		return arrayValue(document, key)
+	case []interface{}:
+		return arrayValue(document, key)
+	}
+	return nil, false
+}
+
+func arrayValue(array []interface{}, key string) (interface{}, bool) {
+	index, err := strconv.Atoi(key)
+	if err != nil || index < 0 || index >= len(array) {
+		return nil, false
+	}
+	return array[index], true
+}
+
+// Returns the keys of a document, in document order when it is ordered
+func documentKeys(container interface{}) []string {
+	var keys []string
+	switch document := container.(type) {
+	case bson.D:
+		for _, element := range document {
+			keys = append(keys, element.Key)
+		}
+	case bson.M:
+		for key := range document {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	case map[string]interface{}:
+		for key := range document {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	return keys
+}
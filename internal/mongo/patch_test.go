@@ -0,0 +1,183 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func givePatchEvent(updates string, document bson.M) *ChangeEvent {
+	var updateDescription bson.M
+	if err := bson.UnmarshalExtJSON([]byte(updates), false, &updateDescription); err != nil {
+		panic(err)
+	}
+
+	return &ChangeEvent{
+		Operation: "update",
+		Updates:   updateDescription,
+		Document:  document,
+	}
+}
+
+func marshalPatch(t *testing.T, event *ChangeEvent) string {
+	payload, err := bson.MarshalExtJSON(bson.M{"patch": event.Patch}, false, false)
+	assert.NoError(t, err)
+	return string(payload)
+}
+
+func TestParseUpdateFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	format, err := ParseUpdateFormat("")
+	assert.Nil(err)
+	assert.Equal(UpdateFormatMongo, format)
+
+	format, err = ParseUpdateFormat("merge-patch")
+	assert.Nil(err)
+	assert.Equal(UpdateFormatMergePatch, format)
+
+	_, err = ParseUpdateFormat("unknown")
+	assert.Error(err)
+}
+
+func TestApplyUpdateFormatJSONPatch(t *testing.T) {
+	// Given
+	event := givePatchEvent(`{"updatedFields":{"title":"new","a/b":null,"c~":1},"removedFields":["old.field"]}`, nil)
+
+	// When
+	err := event.applyUpdateFormat(UpdateFormatJSONPatch)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Nil(t, event.Updates)
+	assert.Equal(t, `{"patch":[{"op":"remove","path":"/old/field"},{"op":"add","path":"/a~1b","value":null},{"op":"add","path":"/c~0","value":1},{"op":"add","path":"/title","value":"new"}]}`, marshalPatch(t, event))
+}
+
+func TestApplyUpdateFormatJSONPatchWithNestedFields(t *testing.T) {
+	// Given the parents of a nested field may not exist before the update
+	document := bson.M{"title": "new", "meta": bson.D{{Key: "author", Value: bson.M{"name": "jane"}}, {Key: "tags", Value: 1}}}
+	event := givePatchEvent(`{"updatedFields":{"meta.tags":1,"meta.author.name":"jane"},"removedFields":["meta.old"]}`, document)
+
+	// When
+	err := event.applyUpdateFormat(UpdateFormatJSONPatch)
+
+	// Then the whole top-level member is set
+	assert.Nil(t, err)
+	assert.Equal(t, `{"patch":[{"op":"remove","path":"/meta/old"},{"op":"add","path":"/meta","value":{"author":{"name":"jane"},"tags":1}}]}`, marshalPatch(t, event))
+}
+
+func TestApplyUpdateFormatJSONPatchWithArrays(t *testing.T) {
+	// Given
+	document := bson.M{"items": bson.A{"a", bson.M{"x": 1}}, "counters": bson.M{"2": 5}}
+	event := givePatchEvent(`{"updatedFields":{"items.1.x":1,"counters.2":5},"removedFields":[],"truncatedArrays":[{"field":"items","newSize":2}]}`, document)
+
+	// When
+	err := event.applyUpdateFormat(UpdateFormatJSONPatch)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, `{"patch":[{"op":"add","path":"/items","value":["a",{"x":1}]},{"op":"add","path":"/counters","value":{"2":5}}]}`, marshalPatch(t, event))
+}
+
+func TestApplyUpdateFormatJSONPatchWithoutFullDocument(t *testing.T) {
+	testCases := map[string]string{
+		// "add" would insert at the array index while MongoDB replaces the element
+		"array element": `{"updatedFields":{"items.3":"d"}}`,
+		// "add" would fail when the parents do not exist while MongoDB creates them
+		"nested field": `{"updatedFields":{"a.b.c":"d"}}`,
+	}
+
+	for name, updates := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			event := givePatchEvent(updates, nil)
+
+			// When
+			err := event.applyUpdateFormat(UpdateFormatJSONPatch)
+
+			// Then
+			assert.Equal(t, errPatchNeedsFullDocument, err)
+			assert.NotNil(t, event.Updates)
+			assert.Nil(t, event.Patch)
+		})
+	}
+}
+
+func TestApplyUpdateFormatWhenTruncatedWithoutFullDocument(t *testing.T) {
+	// Given
+	event := givePatchEvent(`{"updatedFields":{},"truncatedArrays":[{"field":"items","newSize":2}]}`, nil)
+
+	// When
+	err := event.applyUpdateFormat(UpdateFormatJSONPatch)
+
+	// Then
+	assert.Equal(t, errPatchNeedsFullDocument, err)
+	assert.NotNil(t, event.Updates)
+	assert.Nil(t, event.Patch)
+}
+
+func TestApplyUpdateFormatMergePatch(t *testing.T) {
+	// Given
+	document := bson.M{"title": "new", "meta": bson.M{"tags": bson.A{"a", "b"}}}
+	event := givePatchEvent(`{"updatedFields":{"title":"new","meta.tags.1":"b"},"removedFields":["meta.old"]}`, document)
+
+	// When
+	err := event.applyUpdateFormat(UpdateFormatMergePatch)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"title": "new", "meta": bson.M{"old": nil, "tags": bson.A{"a", "b"}}}, event.Patch)
+}
+
+func TestApplyUpdateFormatMergePatchWithoutFullDocument(t *testing.T) {
+	// Given
+	event := givePatchEvent(`{"updatedFields":{"tags.1":"b"}}`, nil)
+
+	// When
+	err := event.applyUpdateFormat(UpdateFormatMergePatch)
+
+	// Then
+	assert.Equal(t, errPatchNeedsFullDocument, err)
+	assert.NotNil(t, event.Updates)
+}
+
+func TestApplyUpdateFormatMergePatchWithNullValue(t *testing.T) {
+	testCases := map[string]string{
+		"null field":  `{"updatedFields":{"title":null}}`,
+		"null member": `{"updatedFields":{"meta":{"author":null}}}`,
+	}
+
+	for name, updates := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			event := givePatchEvent(updates, nil)
+
+			// When
+			err := event.applyUpdateFormat(UpdateFormatMergePatch)
+
+			// Then
+			assert.Equal(t, errMergePatchNullValue, err)
+			assert.NotNil(t, event.Updates)
+			assert.Nil(t, event.Patch)
+		})
+	}
+
+	// Null array elements are kept as arrays are replaced as a whole
+	event := givePatchEvent(`{"updatedFields":{"tags":["a",null]}}`, nil)
+	assert.Nil(t, event.applyUpdateFormat(UpdateFormatMergePatch))
+}
+
+func TestApplyUpdateFormatFullDocumentReplacement(t *testing.T) {
+	assert := assert.New(t)
+
+	// JSON Patch
+	event := &ChangeEvent{Operation: "insert", Document: bson.M{"title": "replayed"}}
+	assert.Nil(event.applyUpdateFormat(UpdateFormatJSONPatch))
+	assert.Equal(`{"patch":[{"op":"replace","path":"","value":{"title":"replayed"}}]}`, marshalPatch(t, event))
+
+	// JSON Merge Patch
+	event = &ChangeEvent{Operation: "replace", Document: bson.M{"title": "replaced"}}
+	assert.Nil(event.applyUpdateFormat(UpdateFormatMergePatch))
+	assert.Equal(`{"patch":{"title":"replaced"}}`, marshalPatch(t, event))
+}
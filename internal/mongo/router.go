@@ -0,0 +1,241 @@
+package mongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"text/template"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultRoutingRuleName is the rule name used in metrics when an event does not match any routing rule
+const DefaultRoutingRuleName = "default"
+
+// RoutingRule describes the Kafka topics a matching change event has to be sent to.
+// All the filled criteria (operations, namespaces and field) have to match.
+type RoutingRule struct {
+	Name       string   `json:"name"`
+	Operations []string `json:"operations"`
+	Namespaces []string `json:"namespaces"`
+	Field      string   `json:"field"`
+	Values     []string `json:"values"`
+	Topics     []string `json:"topics"`
+	Template   string   `json:"template"`
+
+	template *template.Template
+}
+
+type routingTemplateData struct {
+	Operation  string
+	Database   string
+	Collection string
+	DocumentID string
+	Document   bson.M
+}
+
+// ParseRoutingRules decodes a JSON array of routing rules and compiles their topic templates
+func ParseRoutingRules(rules string) ([]*RoutingRule, error) {
+	var routingRules []*RoutingRule
+	if rules == "" {
+		return routingRules, nil
+	}
+
+	if err := json.Unmarshal([]byte(rules), &routingRules); err != nil {
+		return nil, err
+	}
+
+	for index, rule := range routingRules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", index)
+		}
+
+		if len(rule.Topics) == 0 && rule.Template == "" {
+			return nil, fmt.Errorf("routing rule %q should define at least one topic or a template", rule.Name)
+		}
+
+		for _, namespace := range rule.Namespaces {
+			if _, err := path.Match(namespace, ""); err != nil {
+				return nil, fmt.Errorf("routing rule %q has an invalid namespace pattern %q: %w", rule.Name, namespace, err)
+			}
+		}
+
+		if rule.Template != "" {
+			tmpl, err := template.New(rule.Name).Option("missingkey=error").Parse(rule.Template)
+			if err != nil {
+				return nil, fmt.Errorf("routing rule %q has an invalid template: %w", rule.Name, err)
+			}
+			rule.template = tmpl
+		}
+	}
+
+	return routingRules, nil
+}
+
+func (r *RoutingRule) matches(event *ChangeEvent) bool {
+	if len(r.Operations) > 0 && !contains(r.Operations, event.Operation) {
+		return false
+	}
+
+	if len(r.Namespaces) > 0 {
+		namespace := event.namespace()
+		matched := false
+		for _, pattern := range r.Namespaces {
+			if ok, _ := path.Match(pattern, namespace); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if r.Field != "" {
+		value, ok := event.documentField(r.Field)
+		if !ok {
+			return false
+		}
+		if len(r.Values) > 0 && !contains(r.Values, fmt.Sprint(value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *RoutingRule) topics(event *ChangeEvent) ([]string, error) {
+	topics := append([]string{}, r.Topics...)
+
+	if r.template != nil {
+		documentID, _ := event.documentID()
+		data := routingTemplateData{
+			Operation:  event.Operation,
+			Database:   event.database(),
+			Collection: event.collection(),
+			DocumentID: documentID,
+			Document:   event.Document,
+		}
+
+		var topic bytes.Buffer
+		if err := r.template.Execute(&topic, data); err != nil {
+			return nil, fmt.Errorf("routing rule %q: unable to render topic template: %w", r.Name, err)
+		}
+		topics = append(topics, topic.String())
+	}
+
+	return unique(topics), nil
+}
+
+// Returns the topics of the rule as recorded in the metrics: the rendered template topics are recorded
+// as the template itself, so that the label values stay bounded
+func (r *RoutingRule) topicLabels() []string {
+	labels := append([]string{}, r.Topics...)
+	if r.Template != "" {
+		labels = append(labels, r.Template)
+	}
+	return unique(labels)
+}
+
+// Router resolves the Kafka topics a change event has to be sent to
+type Router struct {
+	defaultTopic  string
+	rules         []*RoutingRule
+	dropUnmatched bool
+	recorder      metrics.KafkaRecorder
+}
+
+// Route returns the topics of the first rule matching the event, the default topic
+// when no rule matches or no topic at all when unmatched events are dropped
+func (r *Router) Route(event *ChangeEvent) ([]string, error) {
+	for _, rule := range r.rules {
+		if !rule.matches(event) {
+			continue
+		}
+
+		topics, err := rule.topics(event)
+		if err != nil {
+			return nil, err
+		}
+
+		r.record(rule.Name, rule.topicLabels()...)
+		return topics, nil
+	}
+
+	if r.dropUnmatched || r.defaultTopic == "" {
+		r.record(DefaultRoutingRuleName, "")
+		return nil, nil
+	}
+
+	r.record(DefaultRoutingRuleName, r.defaultTopic)
+	return []string{r.defaultTopic}, nil
+}
+
+func (r *Router) record(rule string, topics ...string) {
+	if r.recorder == nil {
+		return
+	}
+
+	for _, topic := range topics {
+		r.recorder.IncKafkaRoutingDecisionCounter(rule, topic)
+	}
+}
+
+// NewRouter returns a router sending events to the given default topic unless
+// some routing rules are specified
+func NewRouter(defaultTopic string, o ...RouterOption) *Router {
+	router := &Router{
+		defaultTopic: defaultTopic,
+	}
+
+	for _, option := range o {
+		option(router)
+	}
+
+	return router
+}
+
+type RouterOption func(*Router)
+
+// WithRoutingRules allows to specify the rules evaluated (in order) to route events
+func WithRoutingRules(rules []*RoutingRule) RouterOption {
+	return func(r *Router) {
+		r.rules = rules
+	}
+}
+
+// WithDropUnmatched allows to drop the events that does not match any routing rule
+// instead of sending them to the default topic
+func WithDropUnmatched(drop bool) RouterOption {
+	return func(r *Router) {
+		r.dropUnmatched = drop
+	}
+}
+
+// WithRoutingRecorder allows to record routing decisions as metrics
+func WithRoutingRecorder(recorder metrics.KafkaRecorder) RouterOption {
+	return func(r *Router) {
+		r.recorder = recorder
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func unique(values []string) []string {
+	var result = make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" && !contains(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func giveRoutingEvent(operation string, document bson.M) *ChangeEvent {
+	objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	return &ChangeEvent{
+		Operation:   operation,
+		Namespace:   bson.M{"db": "watcher", "coll": "items"},
+		DocumentKey: documentKey{ID: objectID},
+		Document:    document,
+	}
+}
+
+func TestParseRoutingRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := ParseRoutingRules("")
+	assert.Nil(err)
+	assert.Len(rules, 0)
+
+	rules, err = ParseRoutingRules(`[{"operations":["delete"],"topics":["deletes"]},{"name":"tpl","template":"items-{{.Collection}}"}]`)
+	assert.Nil(err)
+	assert.Len(rules, 2)
+	assert.Equal("rule-0", rules[0].Name)
+	assert.Equal("tpl", rules[1].Name)
+
+	_, err = ParseRoutingRules(`[{"name":"empty"}]`)
+	assert.EqualError(err, `routing rule "empty" should define at least one topic or a template`)
+
+	_, err = ParseRoutingRules(`[{"name":"invalid","template":"{{.Collection"}]`)
+	assert.Error(err)
+
+	_, err = ParseRoutingRules(`[{"name":"invalid","namespaces":["["],"topics":["t"]}]`)
+	assert.Error(err)
+
+	_, err = ParseRoutingRules(`{`)
+	assert.Error(err)
+}
+
+func TestRouterRoute(t *testing.T) {
+	rules, err := ParseRoutingRules(`[
+		{"name":"deletes","operations":["delete"],"topics":["deletes","audit"]},
+		{"name":"others","namespaces":["other.*"],"topics":["others"]},
+		{"name":"tenants","field":"tenant.name","values":["acme"],"topics":["audit"],"template":"{{.Collection}}-{{.Document.tenant.name}}"}
+	]`)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		name     string
+		event    *ChangeEvent
+		expected []string
+	}{
+		{
+			name:     "operation",
+			event:    giveRoutingEvent("delete", nil),
+			expected: []string{"deletes", "audit"},
+		},
+		{
+			name:     "field value and template",
+			event:    giveRoutingEvent("insert", bson.M{"tenant": bson.M{"name": "acme"}}),
+			expected: []string{"audit", "items-acme"},
+		},
+		{
+			name:     "field value mismatch",
+			event:    giveRoutingEvent("insert", bson.M{"tenant": bson.M{"name": "other"}}),
+			expected: []string{"default-topic"},
+		},
+		{
+			name:     "no rule matching",
+			event:    giveRoutingEvent("insert", nil),
+			expected: []string{"default-topic"},
+		},
+	}
+
+	router := NewRouter("default-topic", WithRoutingRules(rules))
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			topics, err := router.Route(testCase.event)
+
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.expected, topics)
+		})
+	}
+}
+
+func TestRouterRouteWhenNamespaceMatches(t *testing.T) {
+	rules, _ := ParseRoutingRules(`[{"name":"others","namespaces":["other.*"],"topics":["others"]}]`)
+	router := NewRouter("default-topic", WithRoutingRules(rules))
+
+	event := giveRoutingEvent("insert", nil)
+	event.Namespace = bson.M{"db": "other", "coll": "items"}
+
+	topics, err := router.Route(event)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"others"}, topics)
+}
+
+func TestRouterRouteWhenUnmatchedDropped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := metrics.NewMockKafkaRecorder(ctrl)
+	recorder.EXPECT().IncKafkaRoutingDecisionCounter(DefaultRoutingRuleName, "")
+
+	router := NewRouter("default-topic", WithDropUnmatched(true), WithRoutingRecorder(recorder))
+
+	topics, err := router.Route(giveRoutingEvent("insert", nil))
+
+	assert.Nil(t, err)
+	assert.Len(t, topics, 0)
+}
+
+func TestRouterRouteWhenTemplateError(t *testing.T) {
+	rules, _ := ParseRoutingRules(`[{"name":"tenants","template":"items-{{.Document.tenant}}"}]`)
+	router := NewRouter("default-topic", WithRoutingRules(rules))
+
+	_, err := router.Route(giveRoutingEvent("insert", bson.M{}))
+
+	assert.Error(t, err)
+}
+
+func TestRouterRouteRecordsDecisions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := metrics.NewMockKafkaRecorder(ctrl)
+	recorder.EXPECT().IncKafkaRoutingDecisionCounter("deletes", "deletes")
+	recorder.EXPECT().IncKafkaRoutingDecisionCounter("deletes", "audit")
+	recorder.EXPECT().IncKafkaRoutingDecisionCounter(DefaultRoutingRuleName, "default-topic")
+
+	rules, _ := ParseRoutingRules(`[{"name":"deletes","operations":["delete"],"topics":["deletes","audit"]}]`)
+	router := NewRouter("default-topic", WithRoutingRules(rules), WithRoutingRecorder(recorder))
+
+	router.Route(giveRoutingEvent("delete", nil))
+	router.Route(giveRoutingEvent("insert", nil))
+}
+
+func TestRouterRouteRecordsTemplateDecisions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := metrics.NewMockKafkaRecorder(ctrl)
+	recorder.EXPECT().IncKafkaRoutingDecisionCounter("tenants", "{{.Database}}-events").Times(2)
+
+	rules, _ := ParseRoutingRules(`[{"name":"tenants","template":"{{.Database}}-events"}]`)
+	router := NewRouter("default-topic", WithRoutingRules(rules), WithRoutingRecorder(recorder))
+
+	first := giveRoutingEvent("insert", nil)
+	first.Namespace = bson.M{"db": "acme", "coll": "items"}
+	second := giveRoutingEvent("insert", nil)
+	second.Namespace = bson.M{"db": "globex", "coll": "items"}
+
+	topics, err := router.Route(first)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme-events"}, topics)
+
+	topics, err = router.Route(second)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"globex-events"}, topics)
+}
@@ -0,0 +1,74 @@
+package mongo
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Available Kafka message timestamp sources
+const (
+	TimestampSourceProducer    = "producer"
+	TimestampSourceClusterTime = "cluster-time"
+	TimestampSourceWallTime    = "wall-time"
+	TimestampSourceField       = "field"
+)
+
+// TimestampSource returns the Kafka message timestamp of a change event.
+// A zero time lets the Kafka producer set the timestamp.
+type TimestampSource func(event *ChangeEvent) time.Time
+
+// ParseTimestampSource returns the timestamp source matching the given name,
+// the field is only used by the "field" source
+func ParseTimestampSource(source string, field string) (TimestampSource, error) {
+	switch source {
+	case TimestampSourceProducer, "":
+		return nil, nil
+	case TimestampSourceClusterTime:
+		return func(event *ChangeEvent) time.Time {
+			if event.ClusterTime.IsZero() {
+				return time.Time{}
+			}
+			return time.Unix(int64(event.ClusterTime.T), 0)
+		}, nil
+	case TimestampSourceWallTime:
+		return func(event *ChangeEvent) time.Time {
+			return event.WallTime
+		}, nil
+	case TimestampSourceField:
+		if field == "" {
+			return nil, fmt.Errorf("a document field should be specified with the %q timestamp source", source)
+		}
+		return func(event *ChangeEvent) time.Time {
+			value, _ := event.documentField(field)
+			return timeValue(value)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown timestamp source %q (available: producer, cluster-time, wall-time, field)", source)
+}
+
+func timeValue(value interface{}) time.Time {
+	switch v := value.(type) {
+	case primitive.DateTime:
+		return v.Time()
+	case time.Time:
+		return v
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0)
+	// Numbers are considered as milliseconds since epoch, whatever type they are decoded as
+	case int64:
+		return time.UnixMilli(v)
+	case int32:
+		return time.UnixMilli(int64(v))
+	case int:
+		return time.UnixMilli(int64(v))
+	case float64:
+		return time.UnixMilli(int64(v))
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,65 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseTimestampSource(t *testing.T) {
+	assert := assert.New(t)
+
+	source, err := ParseTimestampSource("producer", "")
+	assert.Nil(err)
+	assert.Nil(source)
+
+	_, err = ParseTimestampSource("field", "")
+	assert.Error(err)
+
+	_, err = ParseTimestampSource("unknown", "")
+	assert.Error(err)
+}
+
+func TestTimestampSources(t *testing.T) {
+	clusterTime := time.Unix(1600000000, 0)
+	wallTime := time.Unix(1600000001, 0)
+	updatedAt := time.UnixMilli(1600000002123)
+
+	event := &ChangeEvent{
+		ClusterTime: primitive.Timestamp{T: uint32(clusterTime.Unix()), I: 2},
+		WallTime:    wallTime,
+		Document: bson.M{
+			"updatedAt": primitive.NewDateTimeFromTime(updatedAt),
+			"meta":      bson.M{"ts": int64(1600000003000), "date": "2020-09-13T12:26:44Z"},
+			"numbers":   bson.M{"int32": int32(1600000), "int": 1600000004000, "double": 1600000005000.0},
+		},
+	}
+
+	testCases := []struct {
+		source   string
+		field    string
+		expected time.Time
+	}{
+		{source: TimestampSourceClusterTime, expected: clusterTime},
+		{source: TimestampSourceWallTime, expected: wallTime},
+		{source: TimestampSourceField, field: "updatedAt", expected: updatedAt},
+		{source: TimestampSourceField, field: "meta.ts", expected: time.UnixMilli(1600000003000)},
+		{source: TimestampSourceField, field: "numbers.int32", expected: time.UnixMilli(1600000)},
+		{source: TimestampSourceField, field: "numbers.int", expected: time.UnixMilli(1600000004000)},
+		{source: TimestampSourceField, field: "numbers.double", expected: time.UnixMilli(1600000005000)},
+		{source: TimestampSourceField, field: "meta.date", expected: time.Date(2020, 9, 13, 12, 26, 44, 0, time.UTC)},
+		{source: TimestampSourceField, field: "missing", expected: time.Time{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.source+testCase.field, func(t *testing.T) {
+			source, err := ParseTimestampSource(testCase.source, testCase.field)
+
+			assert.Nil(t, err)
+			assert.True(t, testCase.expected.Equal(source(event)))
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package mongo
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Transaction headers names, added to the events of multi-document transactions
+const (
+	HeaderTransactionID    = "txn-id"
+	HeaderTransactionSeq   = "txn-seq"
+	HeaderTransactionTotal = "txn-total"
+)
+
+// Transaction marker statuses, following the Debezium transaction metadata format
+const (
+	TransactionStatusBegin = "BEGIN"
+	TransactionStatusEnd   = "END"
+)
+
+// transaction gathers the events of a multi-document transaction
+type transaction struct {
+	id          string
+	clusterTime primitive.Timestamp
+	eventCount  int
+	// event count per namespace, in the order of their first event
+	collections []*transactionCollection
+}
+
+type transactionCollection struct {
+	DataCollection string `json:"data_collection"`
+	EventCount     int    `json:"event_count"`
+}
+
+func (t *transaction) add(event *ChangeEvent) {
+	t.eventCount++
+	for _, collection := range t.collections {
+		if collection.DataCollection == event.namespace() {
+			collection.EventCount++
+			return
+		}
+	}
+	t.collections = append(t.collections, &transactionCollection{DataCollection: event.namespace(), EventCount: 1})
+}
+
+// transactionEvent locates an event in its transaction
+type transactionEvent struct {
+	transaction *transaction
+	seq         int
+	last        bool
+}
+
+// Returns the "<lsid id>:<txnNumber>" identifier of the transaction of the event, or an empty string
+// when the event is not part of a multi-document transaction
+func (e ChangeEvent) transactionID() string {
+	if e.Transaction == 0 || len(e.SessionID) == 0 {
+		return ""
+	}
+
+	var session string
+	switch id := e.SessionID["id"].(type) {
+	case primitive.Binary:
+		session = formatUUID(id.Data)
+	default:
+		bytes, _ := headerValue(e.SessionID)
+		session = string(bytes)
+	}
+	return session + ":" + strconv.FormatInt(e.Transaction, 10)
+}
+
+func formatUUID(data []byte) string {
+	if len(data) != 16 {
+		return hex.EncodeToString(data)
+	}
+	encoded := hex.EncodeToString(data)
+	return encoded[0:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:]
+}
+
+// TransactionGrouper detects the boundaries of multi-document transactions, whose events share the same
+// session and transaction number and are contiguous in the change stream.
+// The events of a transaction are held back until its end is known (an event of another transaction or
+// no event during the max wait duration) and annotated with the transaction id, sequence number and
+// total count headers.
+type TransactionGrouper struct {
+	maxWait      time.Duration
+	maxEvents    int
+	headerPrefix string
+	logger       logger.LoggerInterface
+}
+
+// TransactionOption allows to customize the transaction grouper behavior
+type TransactionOption func(*TransactionGrouper)
+
+// WithTransactionMaxWait allows to specify the duration without event after which a transaction
+// is considered as complete
+func WithTransactionMaxWait(maxWait time.Duration) TransactionOption {
+	return func(g *TransactionGrouper) {
+		if maxWait > 0 {
+			g.maxWait = maxWait
+		}
+	}
+}
+
+// WithTransactionMaxEvents bounds the number of events held back per transaction. When it is reached,
+// the held events are sent without the total count header.
+func WithTransactionMaxEvents(maxEvents int) TransactionOption {
+	return func(g *TransactionGrouper) {
+		g.maxEvents = maxEvents
+	}
+}
+
+// NewTransactionGrouper returns a transaction grouper, header names being prefixed by the given prefix
+func NewTransactionGrouper(headerPrefix string, logger logger.LoggerInterface, options ...TransactionOption) *TransactionGrouper {
+	grouper := &TransactionGrouper{
+		maxWait:      time.Second,
+		headerPrefix: headerPrefix,
+		logger:       logger,
+	}
+	for _, option := range options {
+		option(grouper)
+	}
+	return grouper
+}
+
+// Wrap returns a change event producer emitting the grouped events of the given producer
+func (g *TransactionGrouper) Wrap(producer ChangeEventProducer) ChangeEventProducer {
+	return func(ctx context.Context) (chan *ChangeEvent, error) {
+		events, err := producer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return g.Group(events), nil
+	}
+}
+
+// Group returns a channel of the annotated events, closed once the given channel is closed
+func (g *TransactionGrouper) Group(events chan *ChangeEvent) chan *ChangeEvent {
+	var output = make(chan *ChangeEvent)
+
+	go func() {
+		defer close(output)
+
+		var current *transaction
+		var pending []*ChangeEvent
+		var complete = true
+
+		// Sends the pending events, the latest one is kept unless the transaction is over
+		// so that the last event of the transaction can always be flagged
+		flush := func(over bool) {
+			if len(pending) == 0 {
+				return
+			}
+			count := len(pending)
+			if !over {
+				count--
+			}
+			for _, event := range pending[:count] {
+				event.txn.last = over && event == pending[len(pending)-1]
+				g.annotate(event, complete && over)
+				output <- event
+			}
+			pending = append(pending[:0], pending[count:]...)
+			if over {
+				current = nil
+				complete = true
+			}
+		}
+
+		timer := time.NewTimer(g.maxWait)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					flush(true)
+					return
+				}
+				timer.Stop()
+
+				id := event.transactionID()
+				if current != nil && current.id != id {
+					flush(true)
+				}
+				if id == "" {
+					output <- event
+					continue
+				}
+
+				if current == nil {
+					current = &transaction{id: id, clusterTime: event.ClusterTime}
+				}
+				current.add(event)
+				event.txn = &transactionEvent{transaction: current, seq: current.eventCount}
+				pending = append(pending, event)
+
+				if g.maxEvents > 0 && len(pending) > g.maxEvents {
+					g.logger.Warning("Transaction grouper: Too many events in transaction, sending them without total count", logger.String("transaction_id", id), logger.Int64("max_events", int64(g.maxEvents)))
+					complete = false
+					flush(false)
+				}
+				timer.Reset(g.maxWait)
+			case <-timer.C:
+				flush(true)
+			}
+		}
+	}()
+
+	return output
+}
+
+// Adds the transaction headers to the event, the total count is only known when the whole
+// transaction has been held back
+func (g *TransactionGrouper) annotate(event *ChangeEvent, withTotal bool) {
+	headers := []kafka.Header{
+		{Key: g.headerPrefix + HeaderTransactionID, Value: []byte(event.txn.transaction.id)},
+		{Key: g.headerPrefix + HeaderTransactionSeq, Value: []byte(strconv.Itoa(event.txn.seq))},
+	}
+	if withTotal {
+		headers = append(headers, kafka.Header{Key: g.headerPrefix + HeaderTransactionTotal, Value: []byte(strconv.Itoa(event.txn.transaction.eventCount))})
+	}
+	event.headers = append(event.headers, headers...)
+}
+
+// transactionMarker is a Debezium transaction metadata message
+type transactionMarker struct {
+	Status          string                   `json:"status"`
+	ID              string                   `json:"id"`
+	EventCount      *int                     `json:"event_count"`
+	DataCollections []*transactionCollection `json:"data_collections"`
+	Timestamp       int64                    `json:"ts_ms"`
+}
+
+// Returns the BEGIN (before the first event) or END (after the last event) marker messages of the
+// transaction of the event, if any
+func transactionMarkers(event *ChangeEvent, topic string) (begin *kafka.Message, end *kafka.Message, err error) {
+	if event.txn == nil || topic == "" {
+		return nil, nil, nil
+	}
+	txn := event.txn.transaction
+
+	key, err := json.Marshal(bson.M{"id": txn.id})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	marker := transactionMarker{ID: txn.id, Timestamp: int64(txn.clusterTime.T) * 1000}
+
+	if event.txn.seq == 1 {
+		marker.Status = TransactionStatusBegin
+		value, err := json.Marshal(marker)
+		if err != nil {
+			return nil, nil, err
+		}
+		begin = &kafka.Message{Topic: topic, Key: key, Value: value}
+	}
+
+	if event.txn.last {
+		marker.Status = TransactionStatusEnd
+		marker.EventCount = &txn.eventCount
+		marker.DataCollections = txn.collections
+		value, err := json.Marshal(marker)
+		if err != nil {
+			return nil, nil, err
+		}
+		end = &kafka.Message{Topic: topic, Key: key, Value: value}
+	}
+
+	return begin, end, nil
+}
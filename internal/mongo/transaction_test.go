@@ -0,0 +1,210 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var sessionUUID = primitive.Binary{Subtype: 4, Data: []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}}
+
+func giveTransactionEvent(collection string, txnNumber int64) *ChangeEvent {
+	objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	event := &ChangeEvent{
+		Operation:   "insert",
+		Namespace:   bson.M{"db": "watcher", "coll": collection},
+		DocumentKey: documentKey{ID: objectID},
+		ClusterTime: primitive.Timestamp{T: 1600000000, I: 1},
+	}
+	if txnNumber != 0 {
+		event.Transaction = txnNumber
+		event.SessionID = bson.M{"id": sessionUUID, "uid": primitive.Binary{Data: []byte{1}}}
+	}
+	return event
+}
+
+func groupAll(grouper *TransactionGrouper, events ...*ChangeEvent) []*ChangeEvent {
+	input := make(chan *ChangeEvent, len(events))
+	for _, event := range events {
+		input <- event
+	}
+	close(input)
+
+	var result []*ChangeEvent
+	for event := range grouper.Group(input) {
+		result = append(result, event)
+	}
+	return result
+}
+
+func TestChangeEventTransactionID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", giveTransactionEvent("items", 0).transactionID())
+	assert.Equal("12345678-9abc-def0-1234-56789abcdef0:3", giveTransactionEvent("items", 3).transactionID())
+}
+
+func TestTransactionGrouperAnnotatesEvents(t *testing.T) {
+	// Given
+	grouper := NewTransactionGrouper("x-mongo-", logger.NewNopLogger())
+
+	// When
+	result := groupAll(grouper,
+		giveTransactionEvent("items", 0),
+		giveTransactionEvent("items", 1),
+		giveTransactionEvent("orders", 1),
+		giveTransactionEvent("items", 2),
+	)
+
+	// Then
+	assert := assert.New(t)
+	assert.Len(result, 4)
+
+	assert.Nil(result[0].txn)
+	assert.Len(result[0].headers, 0)
+
+	assert.Equal([]kafka.Header{
+		{Key: "x-mongo-txn-id", Value: []byte("12345678-9abc-def0-1234-56789abcdef0:1")},
+		{Key: "x-mongo-txn-seq", Value: []byte("1")},
+		{Key: "x-mongo-txn-total", Value: []byte("2")},
+	}, result[1].headers)
+	assert.False(result[1].txn.last)
+
+	assert.Equal([]kafka.Header{
+		{Key: "x-mongo-txn-id", Value: []byte("12345678-9abc-def0-1234-56789abcdef0:1")},
+		{Key: "x-mongo-txn-seq", Value: []byte("2")},
+		{Key: "x-mongo-txn-total", Value: []byte("2")},
+	}, result[2].headers)
+	assert.True(result[2].txn.last)
+
+	assert.Equal(1, result[3].txn.seq)
+	assert.True(result[3].txn.last)
+}
+
+func TestTransactionGrouperMaxEvents(t *testing.T) {
+	// Given
+	grouper := NewTransactionGrouper("x-", logger.NewNopLogger(), WithTransactionMaxEvents(1))
+
+	// When
+	result := groupAll(grouper,
+		giveTransactionEvent("items", 1),
+		giveTransactionEvent("items", 1),
+		giveTransactionEvent("items", 1),
+	)
+
+	// Then
+	assert := assert.New(t)
+	assert.Len(result, 3)
+	for index, event := range result {
+		assert.Len(event.headers, 2, "the total count is unknown")
+		assert.Equal(index+1, event.txn.seq)
+	}
+	assert.True(result[2].txn.last)
+	assert.Equal(3, result[2].txn.transaction.eventCount)
+}
+
+func TestTransactionGrouperFlushesAfterMaxWait(t *testing.T) {
+	// Given
+	grouper := NewTransactionGrouper("x-", logger.NewNopLogger(), WithTransactionMaxWait(10*time.Millisecond))
+
+	input := make(chan *ChangeEvent)
+	output := grouper.Group(input)
+	defer close(input)
+
+	// When
+	input <- giveTransactionEvent("items", 1)
+
+	// Then
+	select {
+	case event := <-output:
+		assert.True(t, event.txn.last)
+	case <-time.After(time.Second):
+		t.Fatal("the transaction should have been considered as complete")
+	}
+}
+
+func TestTransactionGrouperWithCoalescer(t *testing.T) {
+	// Given
+	grouper := NewTransactionGrouper("x-", logger.NewNopLogger())
+	coalescer := NewCoalescer(time.Hour, logger.NewNopLogger())
+
+	first := giveTransactionEvent("items", 1)
+	first.ID = token("1")
+	second := giveTransactionEvent("items", 1)
+	second.ID = token("2")
+	second.Operation = "replace"
+	// A later event of the same document, out of the transaction
+	third := giveTransactionEvent("items", 0)
+	third.ID = token("3")
+	third.Operation = "replace"
+
+	input := make(chan *ChangeEvent, 3)
+	input <- first
+	input <- second
+	input <- third
+	close(input)
+
+	// When
+	var result []*ChangeEvent
+	for event := range coalescer.Coalesce(grouper.Group(input)) {
+		result = append(result, event)
+	}
+
+	// Then the transaction events are neither coalesced together nor with the later event
+	assert := assert.New(t)
+	assert.Len(result, 3)
+	assert.Equal([]*ChangeEvent{first, second, third}, result)
+
+	assert.Equal(1, result[0].txn.seq)
+	assert.False(result[0].txn.last)
+	assert.Equal(2, result[1].txn.seq)
+	assert.True(result[1].txn.last)
+	assert.Equal([]kafka.Header{
+		{Key: "x-txn-id", Value: []byte("12345678-9abc-def0-1234-56789abcdef0:1")},
+		{Key: "x-txn-seq", Value: []byte("2")},
+		{Key: "x-txn-total", Value: []byte("2")},
+	}, result[1].headers)
+	assert.Nil(result[2].txn)
+}
+
+func TestTransformEmitsTransactionMarkers(t *testing.T) {
+	// Given
+	grouper := NewTransactionGrouper("x-", logger.NewNopLogger())
+	input := make(chan *ChangeEvent, 2)
+	input <- giveTransactionEvent("items", 1)
+	input <- giveTransactionEvent("orders", 1)
+	close(input)
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-topic", logger.NewNopLogger(), WithTransactionTopic("my-topic.transaction"))
+
+	// When
+	var messages []*kafka.Message
+	for message := range transformer.Transform(grouper.Group(input)) {
+		messages = append(messages, message)
+	}
+
+	// Then
+	assert := assert.New(t)
+	assert.Len(messages, 4)
+
+	assert.Equal("my-topic.transaction", messages[0].Topic)
+	assert.Equal(`{"id":"12345678-9abc-def0-1234-56789abcdef0:1"}`, string(messages[0].Key))
+	assert.Equal(`{"status":"BEGIN","id":"12345678-9abc-def0-1234-56789abcdef0:1","event_count":null,"data_collections":null,"ts_ms":1600000000000}`, string(messages[0].Value))
+	assert.Nil(messages[0].Checkpoint)
+
+	assert.Equal("my-topic", messages[1].Topic)
+	assert.Equal("my-topic", messages[2].Topic)
+
+	assert.Equal("my-topic.transaction", messages[3].Topic)
+	for _, message := range messages {
+		assert.Equal("12345678-9abc-def0-1234-56789abcdef0:1", message.Transaction)
+	}
+	assert.False(messages[2].TransactionEnd)
+	assert.True(messages[3].TransactionEnd)
+	assert.Equal(`{"status":"END","id":"12345678-9abc-def0-1234-56789abcdef0:1","event_count":2,"data_collections":[{"data_collection":"watcher.items","event_count":1},{"data_collection":"watcher.orders","event_count":1}],"ts_ms":1600000000000}`, string(messages[3].Value))
+}
@@ -1,48 +1,532 @@
 package mongo
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
 	"github.com/gol4ng/logger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultTombstoneKeysLimit is the default number of document keys remembered for the collection drop tombstones
+const DefaultTombstoneKeysLimit = 1000000
+
+// DeletePolicy defines the messages sent to Kafka for delete (and drop) events
+type DeletePolicy string
+
+const (
+	// DeletePolicyEvent sends the delete event payload
+	DeletePolicyEvent DeletePolicy = "event"
+	// DeletePolicyTombstone sends a null-value message with the document key
+	DeletePolicyTombstone DeletePolicy = "tombstone"
+	// DeletePolicyBoth sends the delete event payload followed by a tombstone
+	DeletePolicyBoth DeletePolicy = "both"
 )
 
+// ParseDeletePolicy returns the delete policy matching the given name
+func ParseDeletePolicy(policy string) (DeletePolicy, error) {
+	switch DeletePolicy(policy) {
+	case DeletePolicyEvent, DeletePolicyTombstone, DeletePolicyBoth:
+		return DeletePolicy(policy), nil
+	case "":
+		return DeletePolicyEvent, nil
+	}
+	return "", fmt.Errorf("unknown delete policy %q (available: event, tombstone, both)", policy)
+}
+
+func (p DeletePolicy) sendsEvent() bool {
+	return p != DeletePolicyTombstone
+}
+
+func (p DeletePolicy) sendsTombstone() bool {
+	return p == DeletePolicyTombstone || p == DeletePolicyBoth
+}
+
 // ChangeEventKafkaMessageTransformer transforms mongodb change events into a format that will be used by the kafka client
 type ChangeEventKafkaMessageTransformer struct {
-	topic  string
-	logger logger.LoggerInterface
+	router       *Router
+	headers      *HeaderBuilder
+	deletePolicy DeletePolicy
+	timestamp    TimestampSource
+	partition    PartitionSource
+	updateFormat UpdateFormat
+	clusterTime  ClusterTimeFormat
+	logger       logger.LoggerInterface
+
+	// Topic of the transaction BEGIN/END marker messages, markers are not sent when empty
+	transactionTopic string
+
+	// Applies the transform stage dead letter policy, failures are logged when nil
+	deadLetters *kafka.DeadLetterHandler
+
+	// Document keys sent so far, used to tombstone them on a collection drop
+	keys     *tombstoneKeys
+	recorder metrics.PipelineRecorder
 }
 
 func (t *ChangeEventKafkaMessageTransformer) Transform(changeEvents chan *ChangeEvent) chan *kafka.Message {
 	var messageChan = make(chan *kafka.Message, len(changeEvents))
 	go func() {
 		defer close(messageChan)
+		var halted bool
 		for event := range changeEvents {
-			documentID, err := event.documentID()
-			if err != nil {
-				t.logger.Error("Mongo transformer: Unable to extract document id from event", logger.Error("error", err))
+			if halted {
+				// The events still sent by the producer while it stops are dropped
 				continue
 			}
 
-			jsonBytes, err := event.marshal()
-			if err != nil {
-				t.logger.Error("Mongo transformer: Unable to unmarshal change event to json", logger.Error("error", err))
+			messages, proceed := t.transform(event)
+			if !proceed {
+				halted = true
 				continue
 			}
 
-			t.logger.Info("Mongo transformer: Retrieve event", logger.String("document_id", documentID), logger.ByteString("event", jsonBytes))
+			begin, end, err := transactionMarkers(event, t.transactionTopic)
+			if err != nil {
+				t.logger.Error("Mongo transformer: Unable to build transaction markers", logger.Error("error", err))
+			}
+
+			// The checkpoint is only carried by the messages sent after the event ones
+			checkpoint, _ := headerValue(event.Checkpoint())
+			for _, message := range messages {
+				message.Checkpoint = checkpoint
+			}
+			if begin != nil {
+				messages = append([]*kafka.Message{begin}, messages...)
+			}
+			if end != nil {
+				end.Checkpoint = checkpoint
+				messages = append(messages, end)
+			}
+			if len(messages) == 0 && event.txn == nil && checkpoint != nil {
+				// The event is dropped by the router or skipped, its position is still checkpointed
+				messages = append(messages, &kafka.Message{Checkpoint: checkpoint})
+			}
+
+			for _, message := range messages {
+				message.Event = event
+			}
+
+			if event.txn != nil {
+				for _, message := range messages {
+					message.Transaction = event.txn.transaction.id
+				}
+				if event.txn.last && len(messages) > 0 {
+					messages[len(messages)-1].TransactionEnd = true
+				}
+			}
 
-			messageChan <- &kafka.Message{
-				Topic: t.topic,
-				Key:   []byte(documentID),
-				Value: jsonBytes,
+			for _, message := range messages {
+				messageChan <- message
 			}
 		}
 	}()
 	return messageChan
 }
 
-func NewChangeEventKafkaMessageTransformer(topic string, logger logger.LoggerInterface) *ChangeEventKafkaMessageTransformer {
-	return &ChangeEventKafkaMessageTransformer{
-		topic:  topic,
-		logger: logger,
+// Returns the messages of the event, transformation failures are handled by the dead letter handler
+// when there is one. False is returned when the stream has to stop.
+func (t *ChangeEventKafkaMessageTransformer) transform(event *ChangeEvent) ([]*kafka.Message, bool) {
+	for attempt := 1; ; attempt++ {
+		messages, err := t.messages(event)
+		if err == nil {
+			return messages, true
+		}
+		if t.deadLetters == nil {
+			t.logger.Error("Mongo transformer: Unable to transform change event", logger.Error("error", err))
+			return nil, true
+		}
+
+		letter := &kafka.DeadLetter{Stage: kafka.DeadLetterStageTransform, Err: err, Attempts: attempt, Headers: event.headers}
+		if documentID, err := event.documentID(); err == nil {
+			letter.Key = []byte(documentID)
+		}
+		if value, err := bson.MarshalExtJSON(event, true, false); err == nil {
+			letter.Value = value
+		}
+
+		switch t.deadLetters.Handle(letter) {
+		case kafka.DeadLetterHalt:
+			return nil, false
+		case kafka.DeadLetterContinue:
+			return nil, true
+		}
+	}
+}
+
+func (t *ChangeEventKafkaMessageTransformer) messages(event *ChangeEvent) ([]*kafka.Message, error) {
+	if event.Operation == "drop" && t.deletePolicy.sendsTombstone() {
+		return t.dropTombstones(event)
+	}
+
+	documentID, err := event.documentID()
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract document id from event: %w", err)
+	}
+
+	topics, err := t.router.Route(event)
+	if err != nil {
+		return nil, fmt.Errorf("unable to route change event %s: %w", documentID, err)
+	}
+	if len(topics) == 0 {
+		t.logger.Debug("Mongo transformer: Change event does not match any routing rule, dropping it", logger.String("document_id", documentID))
+		return nil, nil
+	}
+
+	isDelete := event.Operation == "delete"
+
+	if err := event.applyUpdateFormat(t.updateFormat); err != nil {
+		t.logger.Warning("Mongo transformer: Unable to convert change event updates, keeping MongoDB update description", logger.String("document_id", documentID), logger.String("format", string(t.updateFormat)), logger.Error("error", err))
+	}
+
+	var jsonBytes []byte
+	if !isDelete || t.deletePolicy.sendsEvent() {
+		jsonBytes, err = event.marshal(t.clusterTime)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal change event %s to json: %w", documentID, err)
+		}
+	}
+
+	t.logger.Info("Mongo transformer: Retrieve event", logger.String("document_id", documentID), logger.ByteString("event", jsonBytes))
+
+	headers := t.buildHeaders(event)
+
+	var messages = make([]*kafka.Message, 0, 2*len(topics))
+	for _, topic := range topics {
+		if jsonBytes != nil {
+			messages = append(messages, newMessage(topic, documentID, jsonBytes, headers))
+		}
+		if isDelete && t.deletePolicy.sendsTombstone() {
+			messages = append(messages, newMessage(topic, documentID, nil, headers))
+		}
+	}
+
+	if t.timestamp != nil {
+		timestamp := t.timestamp(event)
+		for _, message := range messages {
+			message.Timestamp = timestamp
+		}
+	}
+
+	if t.partition != nil {
+		for _, message := range messages {
+			if err := t.partition(event, message); err != nil {
+				return nil, fmt.Errorf("unable to partition change event %s: %w", documentID, err)
+			}
+			if message.Partition == nil && message.PartitionKey == nil {
+				// The event has no partition field, the key keeps the partition of its previous messages
+				t.keys.partition(event.namespace(), message.Topic, documentID).apply(message)
+			}
+		}
+	}
+
+	t.trackKey(event, documentID, messages, isDelete)
+
+	return messages, nil
+}
+
+// Returns the messages of a collection drop: the drop event itself with the "both" delete policy, keyed by
+// the namespace, followed by a tombstone for each document key of the collection sent so far, on the
+// topics the key was sent to
+func (t *ChangeEventKafkaMessageTransformer) dropTombstones(event *ChangeEvent) ([]*kafka.Message, error) {
+	headers := t.buildHeaders(event)
+
+	var messages []*kafka.Message
+	if t.deletePolicy.sendsEvent() {
+		topics, err := t.router.Route(event)
+		if err != nil {
+			return nil, fmt.Errorf("unable to route drop event: %w", err)
+		}
+		jsonBytes, err := event.marshal(t.clusterTime)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal drop event to json: %w", err)
+		}
+		for _, topic := range topics {
+			messages = append(messages, newMessage(topic, event.namespace(), jsonBytes, headers))
+		}
+		if t.timestamp != nil {
+			timestamp := t.timestamp(event)
+			for _, message := range messages {
+				message.Timestamp = timestamp
+			}
+		}
+	}
+
+	t.logger.Info("Mongo transformer: Collection dropped, sending tombstones", logger.Int64("keys", int64(t.keys.count(event.namespace()))), logger.String("collection", event.collection()))
+
+	keys := t.keys.drop(event.namespace())
+	if t.recorder != nil {
+		t.recorder.SetTombstoneTrackedKeys(event.collection(), 0)
+	}
+
+	topics := make([]string, 0, len(keys))
+	for topic := range keys {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		documentIDs := make([]string, 0, len(keys[topic]))
+		for documentID := range keys[topic] {
+			documentIDs = append(documentIDs, documentID)
+		}
+		sort.Strings(documentIDs)
+
+		for _, documentID := range documentIDs {
+			message := newMessage(topic, documentID, nil, headers)
+			keys[topic][documentID].apply(message)
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// Tracks the key of the messages along with their partition, so that their tombstones are sent to the
+// same partition
+func (t *ChangeEventKafkaMessageTransformer) trackKey(event *ChangeEvent, documentID string, messages []*kafka.Message, deleted bool) {
+	if !t.deletePolicy.sendsTombstone() {
+		return
+	}
+
+	namespace := event.namespace()
+	for _, message := range messages {
+		if deleted {
+			t.keys.remove(namespace, message.Topic, documentID)
+			continue
+		}
+		if !t.keys.add(namespace, message.Topic, documentID, keyPartition{partition: message.Partition, partitionKey: message.PartitionKey}) {
+			if t.recorder != nil {
+				t.recorder.IncTombstoneUntrackedKeyCounter(event.collection())
+			}
+			if !t.keys.warned {
+				t.keys.warned = true
+				t.logger.Warning("Mongo transformer: Tracked document keys limit reached, the new keys will not be tombstoned on a collection drop", logger.Int64("limit", int64(t.keys.limit)))
+			}
+		}
+	}
+
+	if t.recorder != nil {
+		t.recorder.SetTombstoneTrackedKeys(event.collection(), t.keys.count(namespace))
+	}
+}
+
+// keyPartition is the partition the messages of a key were sent to, both fields are nil when the
+// producer partitioner chose it from the key
+type keyPartition struct {
+	partition    *int32
+	partitionKey []byte
+}
+
+// Sets the partition of the message, unless it was chosen from the key
+func (p keyPartition) apply(message *kafka.Message) {
+	if p.partition != nil || p.partitionKey != nil {
+		message.Partition = p.partition
+		message.PartitionKey = p.partitionKey
+	}
+}
+
+// tombstoneKeys stores the document keys sent to each topic per namespace, along with their partition,
+// bounded by a limit on the total number of keys (0 meaning no limit). The keys are kept in memory only,
+// they are lost on restart.
+type tombstoneKeys struct {
+	namespaces map[string]map[string]map[string]keyPartition
+	size       int
+	limit      int
+	warned     bool
+}
+
+func newTombstoneKeys(limit int) *tombstoneKeys {
+	return &tombstoneKeys{namespaces: map[string]map[string]map[string]keyPartition{}, limit: limit}
+}
+
+// Adds the key of the topic, false is returned when the key cannot be added because the limit is reached
+func (k *tombstoneKeys) add(namespace, topic, documentID string, partition keyPartition) bool {
+	topics, ok := k.namespaces[namespace]
+	if !ok {
+		topics = map[string]map[string]keyPartition{}
+		k.namespaces[namespace] = topics
+	}
+	keys, ok := topics[topic]
+	if !ok {
+		keys = map[string]keyPartition{}
+		topics[topic] = keys
+	}
+
+	if _, ok := keys[documentID]; ok {
+		keys[documentID] = partition
+		return true
+	}
+	if k.limit > 0 && k.size >= k.limit {
+		return false
+	}
+	keys[documentID] = partition
+	k.size++
+	return true
+}
+
+func (k *tombstoneKeys) remove(namespace, topic, documentID string) {
+	keys := k.namespaces[namespace][topic]
+	if _, ok := keys[documentID]; ok {
+		delete(keys, documentID)
+		k.size--
+	}
+}
+
+// Returns the partition of the key of the topic, a zero value when the key is not tracked
+func (k *tombstoneKeys) partition(namespace, topic, documentID string) keyPartition {
+	return k.namespaces[namespace][topic][documentID]
+}
+
+// Returns the number of keys of the namespace
+func (k *tombstoneKeys) count(namespace string) int {
+	var count int
+	for _, keys := range k.namespaces[namespace] {
+		count += len(keys)
+	}
+	return count
+}
+
+// Removes and returns the keys of the namespace by topic
+func (k *tombstoneKeys) drop(namespace string) map[string]map[string]keyPartition {
+	topics := k.namespaces[namespace]
+	delete(k.namespaces, namespace)
+	for _, keys := range topics {
+		k.size -= len(keys)
+	}
+	// The limit may be reached again later on
+	k.warned = false
+	return topics
+}
+
+func (t *ChangeEventKafkaMessageTransformer) buildHeaders(event *ChangeEvent) []kafka.Header {
+	var headers []kafka.Header
+	if t.headers != nil {
+		headers = t.headers.Build(event)
+	}
+	return append(headers, event.headers...)
+}
+
+func newMessage(topic string, documentID string, value []byte, headers []kafka.Header) *kafka.Message {
+	return &kafka.Message{
+		Headers: append([]kafka.Header(nil), headers...),
+		Topic:   topic,
+		Key:     []byte(documentID),
+		Value:   value,
+	}
+}
+
+func NewChangeEventKafkaMessageTransformer(topic string, logger logger.LoggerInterface, o ...TransformerOption) *ChangeEventKafkaMessageTransformer {
+	transformer := &ChangeEventKafkaMessageTransformer{
+		router:       NewRouter(topic),
+		deletePolicy: DeletePolicyEvent,
+		updateFormat: UpdateFormatMongo,
+		clusterTime:  ClusterTimeFormatDate,
+		logger:       logger,
+		keys:         newTombstoneKeys(DefaultTombstoneKeysLimit),
+	}
+
+	for _, option := range o {
+		option(transformer)
+	}
+
+	return transformer
+}
+
+type TransformerOption func(*ChangeEventKafkaMessageTransformer)
+
+// WithRouter allows to specify the router that resolves the topics of each change event
+func WithRouter(router *Router) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		if router != nil {
+			t.router = router
+		}
+	}
+}
+
+// WithHeaderBuilder allows to add headers built from the change event to each message
+func WithHeaderBuilder(headers *HeaderBuilder) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		t.headers = headers
+	}
+}
+
+// WithDeletePolicy allows to send tombstones (null-value messages) for deleted documents,
+// either instead of or after the delete event. When tombstones are enabled, a collection drop
+// sends a tombstone for every document key of the collection sent so far, on the topics it was sent to.
+func WithDeletePolicy(policy DeletePolicy) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		if policy != "" {
+			t.deletePolicy = policy
+		}
+	}
+}
+
+// WithTombstoneKeysLimit allows to bound the number of document keys remembered for the collection drop
+// tombstones, the keys sent once the limit is reached are not tombstoned (0 meaning no limit)
+func WithTombstoneKeysLimit(limit int) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		t.keys.limit = limit
+	}
+}
+
+// WithTransformerRecorder allows to record the metrics of the document keys remembered for the
+// collection drop tombstones
+func WithTransformerRecorder(recorder metrics.PipelineRecorder) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		t.recorder = recorder
+	}
+}
+
+// WithTimestampSource allows to set the Kafka messages timestamp from the change event
+// instead of letting the producer set it
+func WithTimestampSource(source TimestampSource) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		t.timestamp = source
+	}
+}
+
+// WithPartitionSource allows to set the partition of the Kafka messages from the change event instead
+// of letting the producer partitioner choose it from the message key
+func WithPartitionSource(source PartitionSource) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		t.partition = source
+	}
+}
+
+// WithUpdateFormat allows to represent the document changes as a JSON Patch or a JSON Merge Patch
+func WithUpdateFormat(format UpdateFormat) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		if format != "" {
+			t.updateFormat = format
+		}
+	}
+}
+
+// WithClusterTimeFormat allows to send the cluster time as a full BSON timestamp instead of a date
+func WithClusterTimeFormat(format ClusterTimeFormat) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		if format != "" {
+			t.clusterTime = format
+		}
+	}
+}
+
+// WithTransactionTopic allows to send BEGIN and END marker messages around the events of
+// multi-document transactions, following the Debezium transaction metadata format.
+// Transactions have to be detected by a TransactionGrouper.
+func WithTransactionTopic(topic string) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		t.transactionTopic = topic
+	}
+}
+
+// WithTransformDeadLetters allows to apply the transform stage dead letter policy to the change events
+// that cannot be transformed into messages, they are logged and skipped otherwise
+func WithTransformDeadLetters(handler *kafka.DeadLetterHandler) TransformerOption {
+	return func(t *ChangeEventKafkaMessageTransformer) {
+		t.deadLetters = handler
 	}
 }
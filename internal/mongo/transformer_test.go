@@ -3,7 +3,10 @@ package mongo
 import (
 	"testing"
 
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
 	"github.com/gol4ng/logger"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -88,3 +91,297 @@ func TestTransformChangeEventToKafkaMessageWhenDocumentIDError(t *testing.T) {
 	expectedValue := []byte(`{"_id":null,"operationType":"","fullDocument":{"hello":"this-is-my-second-test-event"},"ns":null,"documentKey":{"_id":{"$oid":"5ccfdbb519580ee49d50803d"}},"clusterTime":{"$date":{"$numberLong":"-62135596800000"}}}`)
 	assert.Equal(expectedValue, message.Value)
 }
+
+func TestTransformChangeEventToKafkaMessageWhenRoutedToSeveralTopics(t *testing.T) {
+	// Given
+	events := make(chan *ChangeEvent)
+	go func() {
+		defer close(events)
+		objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+		events <- &ChangeEvent{
+			Operation:   "delete",
+			DocumentKey: documentKey{ID: objectID},
+		}
+	}()
+
+	rules, _ := ParseRoutingRules(`[{"operations":["delete"],"topics":["deletes","audit"]}]`)
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(), WithRouter(NewRouter("my-test-topic", WithRoutingRules(rules))))
+
+	// When
+	messages := transformer.Transform(events)
+
+	// Then
+	assert := assert.New(t)
+
+	var topics []string
+	for message := range messages {
+		assert.Equal([]byte(`5ccfdbb519580ee49d50803c`), message.Key)
+		topics = append(topics, message.Topic)
+	}
+	assert.Equal([]string{"deletes", "audit"}, topics)
+}
+
+func TestParseDeletePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParseDeletePolicy("")
+	assert.Nil(err)
+	assert.Equal(DeletePolicyEvent, policy)
+
+	policy, err = ParseDeletePolicy("both")
+	assert.Nil(err)
+	assert.Equal(DeletePolicyBoth, policy)
+
+	_, err = ParseDeletePolicy("unknown")
+	assert.Error(err)
+}
+
+func TestTransformChangeEventToKafkaMessageWithDeletePolicy(t *testing.T) {
+	objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	deleteEvent := &ChangeEvent{
+		Operation:   "delete",
+		DocumentKey: documentKey{ID: objectID},
+	}
+
+	testCases := []struct {
+		policy   DeletePolicy
+		expected [][]byte
+	}{
+		{policy: DeletePolicyEvent, expected: [][]byte{[]byte(`{"_id":null,"operationType":"delete","fullDocument":null,"ns":null,"documentKey":{"_id":{"$oid":"5ccfdbb519580ee49d50803c"}},"clusterTime":{"$date":{"$numberLong":"-62135596800000"}}}`)}},
+		{policy: DeletePolicyTombstone, expected: [][]byte{nil}},
+		{policy: DeletePolicyBoth, expected: [][]byte{[]byte(`{"_id":null,"operationType":"delete","fullDocument":null,"ns":null,"documentKey":{"_id":{"$oid":"5ccfdbb519580ee49d50803c"}},"clusterTime":{"$date":{"$numberLong":"-62135596800000"}}}`), nil}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(string(testCase.policy), func(t *testing.T) {
+			transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(), WithDeletePolicy(testCase.policy))
+
+			messages, err := transformer.messages(deleteEvent)
+			assert.NoError(t, err)
+
+			var values [][]byte
+			for _, message := range messages {
+				assert.Equal(t, []byte(`5ccfdbb519580ee49d50803c`), message.Key)
+				values = append(values, message.Value)
+			}
+			assert.Equal(t, testCase.expected, values)
+		})
+	}
+}
+
+func TestTransformChangeEventToKafkaMessageWhenDropWithTombstones(t *testing.T) {
+	// Given
+	firstID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	secondID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803d")
+	otherID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803e")
+
+	items := bson.M{"db": "shop", "coll": "items"}
+	orders := bson.M{"db": "shop", "coll": "orders"}
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(), WithDeletePolicy(DeletePolicyTombstone))
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: firstID}})
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: secondID}})
+	transformer.messages(&ChangeEvent{Operation: "delete", Namespace: items, DocumentKey: documentKey{ID: secondID}})
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: orders, DocumentKey: documentKey{ID: otherID}})
+
+	// When
+	messages, err := transformer.messages(&ChangeEvent{Operation: "drop", Namespace: items})
+
+	// Then
+	assert := assert.New(t)
+	assert.NoError(err)
+	assert.Len(messages, 1)
+	assert.Equal("my-test-topic", messages[0].Topic)
+	assert.Equal([]byte(`5ccfdbb519580ee49d50803c`), messages[0].Key)
+	assert.Nil(messages[0].Value)
+
+	messages, _ = transformer.messages(&ChangeEvent{Operation: "drop", Namespace: items})
+	assert.Len(messages, 0)
+
+	// The keys of the other collections are kept
+	messages, _ = transformer.messages(&ChangeEvent{Operation: "drop", Namespace: orders})
+	assert.Len(messages, 1)
+	assert.Equal([]byte(`5ccfdbb519580ee49d50803e`), messages[0].Key)
+}
+
+func TestTransformChangeEventToKafkaMessageWhenDropTombstonesRoutedKeys(t *testing.T) {
+	// Given
+	firstID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	secondID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803d")
+	items := bson.M{"db": "shop", "coll": "items"}
+
+	rules, err := ParseRoutingRules(`[{"field":"kind","values":["book"],"topics":["books"]},{"operations":["drop"],"topics":["drops"]}]`)
+	assert.NoError(t, err)
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(),
+		WithDeletePolicy(DeletePolicyBoth),
+		WithRouter(NewRouter("my-test-topic", WithRoutingRules(rules))),
+	)
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: firstID}, Document: bson.M{"kind": "book"}})
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: secondID}, Document: bson.M{"kind": "pen"}})
+
+	// When
+	messages, err := transformer.messages(&ChangeEvent{Operation: "drop", Namespace: items})
+
+	// Then the drop event comes first, then the tombstones on the topics the keys were sent to
+	assert := assert.New(t)
+	assert.NoError(err)
+	assert.Len(messages, 3)
+
+	assert.Equal("drops", messages[0].Topic)
+	assert.Equal([]byte("shop.items"), messages[0].Key)
+	assert.Contains(string(messages[0].Value), `"operationType":"drop"`)
+
+	assert.Equal("books", messages[1].Topic)
+	assert.Equal([]byte(`5ccfdbb519580ee49d50803c`), messages[1].Key)
+	assert.Nil(messages[1].Value)
+
+	assert.Equal("my-test-topic", messages[2].Topic)
+	assert.Equal([]byte(`5ccfdbb519580ee49d50803d`), messages[2].Key)
+	assert.Nil(messages[2].Value)
+}
+
+func TestTransformChangeEventToKafkaMessageWhenTombstonesPartitionedByField(t *testing.T) {
+	// Given
+	objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	items := bson.M{"db": "shop", "coll": "items"}
+
+	source, err := ParsePartitionSource(PartitionSourceField, "shard")
+	assert.NoError(t, err)
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(),
+		WithDeletePolicy(DeletePolicyBoth),
+		WithPartitionSource(source),
+	)
+
+	// When - Then
+	assert := assert.New(t)
+	messages, err := transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: objectID}, Document: bson.M{"shard": int32(3)}})
+	assert.NoError(err)
+	assert.Equal(int32(3), *messages[0].Partition)
+
+	// The update has no full document, it keeps the partition of the key
+	messages, err = transformer.messages(&ChangeEvent{Operation: "update", Namespace: items, DocumentKey: documentKey{ID: objectID}})
+	assert.NoError(err)
+	assert.Equal(int32(3), *messages[0].Partition)
+
+	messages, err = transformer.messages(&ChangeEvent{Operation: "drop", Namespace: items})
+	assert.NoError(err)
+	assert.Len(messages, 2)
+	assert.Nil(messages[0].Partition, "the drop event is keyed by the namespace")
+	assert.Nil(messages[1].Value)
+	assert.Equal(int32(3), *messages[1].Partition, "the tombstone is sent to the partition of the key")
+
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: objectID}, Document: bson.M{"shard": int32(5)}})
+	messages, err = transformer.messages(&ChangeEvent{Operation: "delete", Namespace: items, DocumentKey: documentKey{ID: objectID}})
+	assert.NoError(err)
+	assert.Len(messages, 2)
+	for _, message := range messages {
+		assert.Equal(int32(5), *message.Partition)
+	}
+}
+
+func TestTransformChangeEventToKafkaMessageWhenTombstoneKeysLimitReached(t *testing.T) {
+	// Given
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	firstID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+	secondID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803d")
+	items := bson.M{"db": "shop", "coll": "items"}
+
+	recorder := metrics.NewMockPipelineRecorder(ctrl)
+	recorder.EXPECT().SetTombstoneTrackedKeys("items", 1).Times(2)
+	recorder.EXPECT().IncTombstoneUntrackedKeyCounter("items")
+	recorder.EXPECT().SetTombstoneTrackedKeys("items", 0)
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(),
+		WithDeletePolicy(DeletePolicyTombstone),
+		WithTombstoneKeysLimit(1),
+		WithTransformerRecorder(recorder),
+	)
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: firstID}})
+	transformer.messages(&ChangeEvent{Operation: "insert", Namespace: items, DocumentKey: documentKey{ID: secondID}})
+
+	// When
+	messages, err := transformer.messages(&ChangeEvent{Operation: "drop", Namespace: items})
+
+	// Then
+	assert := assert.New(t)
+	assert.NoError(err)
+	assert.Len(messages, 1)
+	assert.Equal([]byte(`5ccfdbb519580ee49d50803c`), messages[0].Key)
+}
+
+func TestTransformChangeEventSetsMessageCheckpoint(t *testing.T) {
+	// Given
+	objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+
+	held := &ChangeEvent{ID: bson.D{{Key: "_data", Value: "2"}}, DocumentKey: documentKey{ID: objectID}}
+	held.setCheckpoint(bson.D{{Key: "_data", Value: "1"}})
+
+	events := make(chan *ChangeEvent, 2)
+	events <- &ChangeEvent{ID: bson.D{{Key: "_data", Value: "1"}}, DocumentKey: documentKey{ID: objectID}}
+	events <- held
+	close(events)
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger())
+
+	// When
+	messages := transformer.Transform(events)
+
+	// Then
+	assert.Equal(t, []byte(`{"_data":"1"}`), (<-messages).Checkpoint)
+	assert.Equal(t, []byte(`{"_data":"1"}`), (<-messages).Checkpoint)
+}
+
+func TestTransformChangeEventMarksCheckpointOfDroppedEvents(t *testing.T) {
+	// Given
+	objectID, _ := primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803c")
+
+	events := make(chan *ChangeEvent, 1)
+	events <- &ChangeEvent{ID: bson.D{{Key: "_data", Value: "1"}}, Operation: "insert", DocumentKey: documentKey{ID: objectID}}
+	close(events)
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(),
+		WithRouter(NewRouter("my-test-topic", WithDropUnmatched(true))),
+	)
+
+	// When
+	messages := transformer.Transform(events)
+
+	// Then
+	marker := <-messages
+	assert.Equal(t, "", marker.Topic, "no message is produced")
+	assert.Equal(t, []byte(`{"_data":"1"}`), marker.Checkpoint)
+	_, ok := <-messages
+	assert.False(t, ok)
+}
+
+func TestTransformChangeEventToKafkaMessageWhenHaltedByDeadLetterPolicy(t *testing.T) {
+	// Given
+	events := make(chan *ChangeEvent, 2)
+	objectID, _ := primitive.ObjectIDFromHex("incorrect-document-id")
+	events <- &ChangeEvent{DocumentKey: documentKey{ID: objectID}}
+	objectID, _ = primitive.ObjectIDFromHex("5ccfdbb519580ee49d50803d")
+	events <- &ChangeEvent{DocumentKey: documentKey{ID: objectID}}
+	close(events)
+
+	var haltErr error
+	handler := kafka.NewDeadLetterHandler(map[string]kafka.DeadLetterPolicy{
+		kafka.DeadLetterStageTransform: {Action: kafka.DeadLetterActionHalt},
+	}, logger.NewNopLogger(), kafka.WithHaltFunc(func(err error) { haltErr = err }))
+
+	transformer := NewChangeEventKafkaMessageTransformer("my-test-topic", logger.NewNopLogger(), WithTransformDeadLetters(handler))
+
+	// When
+	var messages []*kafka.Message
+	for message := range transformer.Transform(events) {
+		messages = append(messages, message)
+	}
+
+	// Then
+	assert := assert.New(t)
+	assert.Len(messages, 0, "the events following the failing one are not sent")
+	assert.ErrorContains(haltErr, "transform stage failed: unable to extract document id from event")
+}
@@ -0,0 +1,144 @@
+package mongo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UpdateFilterRule decides whether an update event has to be sent according to its changed fields.
+// Changed paths matching an ignore pattern are not considered, the update is dropped when no other
+// path changed or, when watch patterns are specified, when none of them changed.
+// Patterns are dotted paths where "*" matches any path component, a pattern also matches the changes
+// of its sub-fields.
+type UpdateFilterRule struct {
+	Name   string   `json:"name"`
+	Ignore []string `json:"ignore"`
+	Watch  []string `json:"watch"`
+	Header string   `json:"header"`
+}
+
+// ParseUpdateFilterRules decodes a JSON array of update filter rules
+func ParseUpdateFilterRules(rules string) ([]*UpdateFilterRule, error) {
+	var filterRules []*UpdateFilterRule
+	if rules == "" {
+		return filterRules, nil
+	}
+
+	if err := json.Unmarshal([]byte(rules), &filterRules); err != nil {
+		return nil, err
+	}
+
+	for index, rule := range filterRules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", index)
+		}
+	}
+
+	return filterRules, nil
+}
+
+// Returns the changed paths that are relevant for the rule (not ignored and watched if needed)
+func (r *UpdateFilterRule) match(changedPaths []string) []string {
+	var matched []string
+	for _, changed := range changedPaths {
+		if matchesAnyPath(r.Ignore, changed, false) {
+			continue
+		}
+		// A watched field also changed when one of its parents has been set
+		if len(r.Watch) > 0 && !matchesAnyPath(r.Watch, changed, true) {
+			continue
+		}
+		matched = append(matched, changed)
+	}
+	return matched
+}
+
+// UpdateFilter evaluates update filter rules on update events, before their update description
+// may be removed
+type UpdateFilter struct {
+	rules        []*UpdateFilterRule
+	headerPrefix string
+}
+
+// Accept returns whether the event has to be sent. All the rules have to accept an update event,
+// events of other operations are always accepted.
+// The rules headers listing their matched paths are added to the event.
+func (f *UpdateFilter) Accept(event *ChangeEvent) bool {
+	if event.Operation != "update" || len(f.rules) == 0 {
+		return true
+	}
+
+	changedPaths := event.changedPaths()
+
+	var headers []kafka.Header
+	for _, rule := range f.rules {
+		matched := rule.match(changedPaths)
+		if len(matched) == 0 {
+			return false
+		}
+		if rule.Header != "" {
+			headers = append(headers, kafka.Header{Key: f.headerPrefix + rule.Header, Value: []byte(strings.Join(matched, ","))})
+		}
+	}
+
+	event.headers = append(event.headers, headers...)
+	return true
+}
+
+// NewUpdateFilter returns an update filter, rule header names being prefixed by the given prefix
+func NewUpdateFilter(rules []*UpdateFilterRule, headerPrefix string) *UpdateFilter {
+	return &UpdateFilter{
+		rules:        rules,
+		headerPrefix: headerPrefix,
+	}
+}
+
+// Returns the sorted list of the fields updated, removed or truncated by an update event
+func (e ChangeEvent) changedPaths() []string {
+	var paths []string
+
+	if updated, ok := e.Updates["updatedFields"]; ok {
+		paths = append(paths, documentKeys(updated)...)
+	}
+
+	for _, key := range []string{"removedFields", "truncatedArrays"} {
+		fields, _ := e.Updates[key].(bson.A)
+		for _, field := range fields {
+			if path, ok := field.(string); ok {
+				paths = append(paths, path)
+			} else if path, ok := documentValue(field, "field"); ok {
+				paths = append(paths, fmt.Sprint(path))
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+func matchesAnyPath(patterns []string, path string, matchParents bool) bool {
+	for _, pattern := range patterns {
+		if matchesPath(strings.Split(pattern, "."), strings.Split(path, "."), matchParents) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the path is the pattern or one of its sub-fields (or one of its parents if matchParents is true)
+func matchesPath(pattern []string, path []string, matchParents bool) bool {
+	for index, component := range pattern {
+		if index >= len(path) {
+			return matchParents
+		}
+		if component != "*" && component != path[index] {
+			return false
+		}
+	}
+	return true
+}
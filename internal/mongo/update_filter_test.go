@@ -0,0 +1,116 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseUpdateFilterRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := ParseUpdateFilterRules(`[{"ignore":["updatedAt"]},{"name":"price","watch":["price"],"header":"price-changes"}]`)
+	assert.Nil(err)
+	assert.Len(rules, 2)
+	assert.Equal("rule-0", rules[0].Name)
+	assert.Equal("price", rules[1].Name)
+
+	_, err = ParseUpdateFilterRules(`[`)
+	assert.Error(err)
+}
+
+func TestUpdateFilterAccept(t *testing.T) {
+	rules, _ := ParseUpdateFilterRules(`[{"ignore":["updatedAt","counters.*"]},{"watch":["price","stock.qty"],"header":"changes"}]`)
+	filter := NewUpdateFilter(rules, "x-mongo-")
+
+	testCases := []struct {
+		name     string
+		updates  string
+		accepted bool
+		header   string
+	}{
+		{name: "no-op update", updates: `{"updatedFields":{},"removedFields":[]}`, accepted: false},
+		{name: "only ignored fields", updates: `{"updatedFields":{"updatedAt":1,"counters.views":2}}`, accepted: false},
+		{name: "not watched field", updates: `{"updatedFields":{"updatedAt":1,"title":"new"}}`, accepted: false},
+		{name: "watched field", updates: `{"updatedFields":{"updatedAt":1,"price":10}}`, accepted: true, header: "price"},
+		{name: "watched parent field", updates: `{"updatedFields":{"stock":{"qty":2}},"removedFields":["price"]}`, accepted: true, header: "price,stock"},
+		{name: "watched truncated array", updates: `{"updatedFields":{},"truncatedArrays":[{"field":"stock.qty","newSize":1}]}`, accepted: true, header: "stock.qty"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			event := givePatchEvent(testCase.updates, nil)
+
+			assert.Equal(t, testCase.accepted, filter.Accept(event))
+			if testCase.header != "" {
+				assert.Equal(t, []kafka.Header{{Key: "x-mongo-changes", Value: []byte(testCase.header)}}, event.headers)
+			}
+		})
+	}
+}
+
+func TestUpdateFilterAcceptOtherOperations(t *testing.T) {
+	rules, _ := ParseUpdateFilterRules(`[{"watch":["price"]}]`)
+	filter := NewUpdateFilter(rules, "")
+
+	assert.True(t, filter.Accept(&ChangeEvent{Operation: "insert"}))
+}
+
+func TestWatchProduceWithUpdateFilterAndIgnoredUpdateDescription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mongoCollection := NewMockCollectionAdapter(ctrl)
+	mongoCursor := NewMockStreamCursor(ctrl)
+
+	mongoCollection.EXPECT().Watch(ctx, bson.A{}, gomock.Any()).Return(mongoCursor, nil)
+	mongoCollection.EXPECT().Name().Return("coll").AnyTimes()
+
+	updates := []string{
+		`{"updatedFields":{"updatedAt":1}}`,
+		`{"updatedFields":{"updatedAt":1,"title":"new"}}`,
+	}
+
+	mongoCursor.EXPECT().ID().Return(int64(1234)).AnyTimes()
+	mongoCursor.EXPECT().Err().Return(nil).AnyTimes()
+	mongoCursor.EXPECT().Close(gomock.Any()).Return(nil).AnyTimes()
+	mongoCursor.EXPECT().ResumeToken().Return(bson.Raw{}).AnyTimes()
+	mongoCursor.EXPECT().Next(ctx).Return(true).Times(2)
+	mongoCursor.EXPECT().Next(ctx).Return(false).AnyTimes()
+	for _, update := range updates {
+		update := update
+		mongoCursor.EXPECT().Decode(gomock.Any()).DoAndReturn(func(val interface{}) error {
+			*val.(*ChangeEvent) = *givePatchEvent(update, nil)
+			return nil
+		})
+	}
+
+	rules, _ := ParseUpdateFilterRules(`[{"ignore":["updatedAt"],"header":"changes"}]`)
+	watcher := NewWatchProducer(mongoCollection, logger.NewNopLogger(), "")
+
+	// When
+	events, err := watcher.GetProducer(
+		WithIgnoreUpdateDescription(true),
+		WithUpdateFilter(NewUpdateFilter(rules, "x-")),
+		WithMaxRetries(0),
+	)(ctx)
+
+	// Then
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	event := <-events
+	assert.Nil(event.Updates)
+	assert.Equal([]kafka.Header{{Key: "x-changes", Value: []byte("title")}}, event.headers)
+
+	_, ok := <-events
+	assert.False(ok)
+}
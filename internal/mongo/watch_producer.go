@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
 	"github.com/gol4ng/logger"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -42,23 +43,34 @@ func (w *WatchProducer) GetProducer(o ...WatchOption) ChangeEventProducer {
 
 		go func() {
 			defer close(events)
+			if config.observer != nil {
+				defer config.observer.Stopped()
+			}
 			for {
-				select {
-				case <-ctx.Done():
-					w.logger.Info("Context canceled")
-					cursor.Close(ctx)
+				// The events are only closed once the cursor stopped sending them, the cursor stops
+				// as soon as the context is canceled
+				end := <-w.sendEvents(ctx, cursor, events, config)
+				cursor.Close(context.Background())
+				if ctx.Err() != nil {
+					w.logger.Info("Mongo client: Change stream stopped", logger.String("collection", w.collection.Name()))
 					return
-				case startAfter := <-w.sendEvents(ctx, cursor, events, config.ignoreUpdateDescription):
-					w.logger.Info("Mongo client : Retry to watch collection", logger.String("collection", w.collection.Name()), logger.Any("start_after", startAfter))
-					cursor.Close(ctx)
-					if config.maxRetries == 0 {
-						return
-					}
-					cursor, err = w.watch(ctx, pipeline, config, nil, startAfter)
+				}
+				if end.paused {
+					cursor, err = w.reopen(ctx, pipeline, config, end.resumeToken)
 					if err != nil {
-						w.logger.Error("Mongo client : An error has occured while retrying to watch collection", logger.String("collection", w.collection.Name()), logger.Error("error", err))
 						return
 					}
+					continue
+				}
+				startAfter := end.resumeToken
+				w.logger.Info("Mongo client : Retry to watch collection", logger.String("collection", w.collection.Name()), logger.Any("start_after", startAfter))
+				if config.maxRetries == 0 {
+					return
+				}
+				cursor, err = w.watch(ctx, pipeline, config, nil, startAfter)
+				if err != nil {
+					w.logger.Error("Mongo client : An error has occured while retrying to watch collection", logger.String("collection", w.collection.Name()), logger.Error("error", err))
+					return
 				}
 			}
 		}()
@@ -103,12 +115,61 @@ func (w *WatchProducer) watch(ctx context.Context, pipeline bson.A, config *Watc
 	return
 }
 
-func (w *WatchProducer) sendEvents(ctx context.Context, cursor StreamCursor, events chan *ChangeEvent, ignoreUpdateDescription bool) <-chan bson.Raw {
-	resumeToken := make(chan bson.Raw, 1)
+// Waits for the stream to be resumed once the cursor has been closed because of the backpressure, and
+// reopens it after the last delivered event, or after the last sent one when none has been delivered yet
+func (w *WatchProducer) reopen(ctx context.Context, pipeline bson.A, config *WatchConfig, resumeToken bson.Raw) (StreamCursor, error) {
+	w.logger.Warning("Mongo client: Change stream paused, cursor closed until the outstanding messages are delivered", logger.String("collection", w.collection.Name()))
+	if !config.flowControl.Wait(ctx, 0) {
+		return nil, ctx.Err()
+	}
+
+	var resumeAfter bson.M
+	if delivered := config.deliveredCheckpoint(); len(delivered) > 0 {
+		if err := bson.UnmarshalExtJSON(delivered, false, &resumeAfter); err != nil {
+			w.logger.Error("Mongo client: Unable to read the delivered checkpoint", logger.ByteString("checkpoint", delivered), logger.Error("error", err))
+			return nil, err
+		}
+		resumeToken = nil
+	}
+	w.logger.Info("Mongo client: Change stream resumed", logger.String("collection", w.collection.Name()), logger.Any("resume_after", resumeAfter), logger.Any("start_after", resumeToken))
+
+	cursor, err := w.watch(ctx, pipeline, config, resumeAfter, resumeToken)
+	if err != nil {
+		w.logger.Error("Mongo client : An error has occured while reopening the change stream", logger.String("collection", w.collection.Name()), logger.Error("error", err))
+	}
+	return cursor, err
+}
+
+// cursorEnd tells why a cursor stopped sending events
+type cursorEnd struct {
+	resumeToken bson.Raw
+	// The cursor has been left because the stream stayed paused longer than the pause timeout
+	paused bool
+}
+
+func (w *WatchProducer) sendEvents(ctx context.Context, cursor StreamCursor, events chan *ChangeEvent, config *WatchConfig) <-chan cursorEnd {
+	end := make(chan cursorEnd, 1)
 
 	go func() {
-		defer close(resumeToken)
-		for cursor.Next(ctx) {
+		defer close(end)
+		if config.observer != nil {
+			config.observer.CursorOpened()
+		}
+		// The observer is told about the closed cursor before the stream can be stopped
+		stop := func(cursorEnd cursorEnd) {
+			if config.observer != nil {
+				config.observer.CursorClosed()
+			}
+			end <- cursorEnd
+		}
+		for {
+			if config.flowControl != nil && !config.flowControl.Wait(ctx, config.pauseTimeout) {
+				stop(cursorEnd{resumeToken: cursor.ResumeToken(), paused: ctx.Err() == nil})
+				return
+			}
+			if !w.next(ctx, cursor, config.observer) {
+				break
+			}
 			if cursor.ID() == 0 {
 				w.logger.Error("Mongo client: Cursor has been closed")
 				break
@@ -117,20 +178,74 @@ func (w *WatchProducer) sendEvents(ctx context.Context, cursor StreamCursor, eve
 				w.logger.Error("Mongo client: Failed to watch collection", logger.Error("error", err))
 				break
 			}
-			event := &ChangeEvent{}
-			if err := cursor.Decode(event); err != nil {
-				w.logger.Error("Mongo client: Unable to decode change event value from cursor", logger.Error("error", err))
+			event, proceed := w.decode(cursor, config.deadLetters)
+			if !proceed {
+				break
+			}
+			if event == nil {
+				continue
+			}
+			if config.updateFilter != nil && !config.updateFilter.Accept(event) {
+				w.logger.Debug("Mongo client: Update event filtered out by its changed fields", logger.Any("document_id", event.DocumentKey.ID))
 				continue
 			}
-			if ignoreUpdateDescription {
+			if config.ignoreUpdateDescription {
 				event.Updates = nil
 			}
 			events <- event
 		}
-		resumeToken <- cursor.ResumeToken()
+		stop(cursorEnd{resumeToken: cursor.ResumeToken()})
 	}()
 
-	return resumeToken
+	return end
+}
+
+// Moves the cursor to the next event like cursor.Next does. With an observer, the cursor is polled so
+// that the observer is also told about the resume token of the empty batches of an idle collection.
+func (w *WatchProducer) next(ctx context.Context, cursor StreamCursor, observer StreamObserver) bool {
+	if observer == nil {
+		return cursor.Next(ctx)
+	}
+
+	for {
+		if cursor.TryNext(ctx) {
+			observer.Advanced(cursor.ResumeToken())
+			return true
+		}
+		if cursor.Err() != nil || cursor.ID() == 0 || ctx.Err() != nil {
+			return false
+		}
+		observer.Advanced(cursor.ResumeToken())
+	}
+}
+
+// Decodes the current event of the cursor, decoding failures are handled by the dead letter handler
+// when there is one. A nil event is returned when the event is skipped, false when the stream has to stop.
+func (w *WatchProducer) decode(cursor StreamCursor, deadLetters *kafka.DeadLetterHandler) (*ChangeEvent, bool) {
+	for attempt := 1; ; attempt++ {
+		event := &ChangeEvent{}
+		err := cursor.Decode(event)
+		if err == nil {
+			return event, true
+		}
+		if deadLetters == nil {
+			w.logger.Error("Mongo client: Unable to decode change event value from cursor", logger.Error("error", err))
+			return nil, true
+		}
+
+		letter := &kafka.DeadLetter{Stage: kafka.DeadLetterStageDecode, Err: err, Attempts: attempt}
+		var raw bson.Raw
+		if cursor.Decode(&raw) == nil {
+			letter.Value = []byte(raw.String())
+		}
+
+		switch deadLetters.Handle(letter) {
+		case kafka.DeadLetterHalt:
+			return nil, false
+		case kafka.DeadLetterContinue:
+			return nil, true
+		}
+	}
 }
 
 func NewWatchProducer(adapter CollectionAdapter, logger logger.LoggerInterface, customPipeline string) *WatchProducer {
@@ -152,6 +267,30 @@ type WatchConfig struct {
 	startAtOperationTime    *primitive.Timestamp
 	maxRetries              int32
 	retryDelay              time.Duration
+	updateFilter            *UpdateFilter
+	deadLetters             *kafka.DeadLetterHandler
+	flowControl             FlowControl
+	pauseTimeout            time.Duration
+	deliveredCheckpoint     func() []byte
+	observer                StreamObserver
+}
+
+// StreamObserver is told about the state of the change stream, in order to monitor its health
+type StreamObserver interface {
+	// CursorOpened is called when a cursor starts being read, CursorClosed once it is left
+	CursorOpened()
+	CursorClosed()
+	// Advanced is called with the resume token of the cursor after each event and each empty batch
+	Advanced(resumeToken bson.Raw)
+	// Stopped is called once the stream stopped for good
+	Stopped()
+}
+
+// FlowControl tells the change stream to stop pulling events while the downstream stages are saturated
+type FlowControl interface {
+	// Wait blocks while the stream is paused, it returns false when the stream is still paused once the
+	// timeout elapsed or when the context is done. A zero timeout waits until the stream is resumed.
+	Wait(ctx context.Context, timeout time.Duration) bool
 }
 
 func (o *WatchConfig) apply(options ...WatchOption) {
@@ -211,6 +350,40 @@ func WithResumeAfter(resumeAfter []byte) WatchOption {
 	}
 }
 
+// WithUpdateFilter allows to filter update events according to their changed fields,
+// evaluated before the update description may be ignored
+func WithUpdateFilter(filter *UpdateFilter) WatchOption {
+	return func(w *WatchConfig) {
+		w.updateFilter = filter
+	}
+}
+
+// WithFlowControl allows to stop pulling events from the cursor while the flow control pauses the stream.
+// The cursor is closed when the stream stays paused longer than the pause timeout, and reopened after the
+// checkpoint returned by deliveredCheckpoint once the stream is resumed.
+func WithFlowControl(flowControl FlowControl, pauseTimeout time.Duration, deliveredCheckpoint func() []byte) WatchOption {
+	return func(w *WatchConfig) {
+		w.flowControl = flowControl
+		w.pauseTimeout = pauseTimeout
+		w.deliveredCheckpoint = deliveredCheckpoint
+	}
+}
+
+// WithStreamObserver allows to monitor the state and the progress of the change stream
+func WithStreamObserver(observer StreamObserver) WatchOption {
+	return func(w *WatchConfig) {
+		w.observer = observer
+	}
+}
+
+// WithDecodeDeadLetters allows to apply the decode stage dead letter policy to the change events
+// that cannot be decoded, they are logged and skipped otherwise
+func WithDecodeDeadLetters(handler *kafka.DeadLetterHandler) WatchOption {
+	return func(w *WatchConfig) {
+		w.deadLetters = handler
+	}
+}
+
 func WithIgnoreUpdateDescription(ignore bool) WatchOption {
 	return func(w *WatchConfig) {
 		w.ignoreUpdateDescription = ignore
@@ -3,9 +3,13 @@ package mongo
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
 	"github.com/gol4ng/logger"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -200,3 +204,247 @@ func TestWatchProduceWhenCustomPipeline(t *testing.T) {
 	assert.Equal(cap(events), 0)
 	assert.Equal(len(events), 0)
 }
+
+func TestWatchProduceWithDecodeDeadLetters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	mongoCollection := NewMockCollectionAdapter(ctrl)
+	mongoCursor := NewMockStreamCursor(ctrl)
+
+	mongoCollection.EXPECT().Watch(ctx, bson.A{}, gomock.Any()).Return(mongoCursor, nil)
+	mongoCollection.EXPECT().Name().Return("coll").AnyTimes()
+
+	raw, _ := bson.Marshal(bson.M{"operationType": 42})
+
+	mongoCursor.EXPECT().ID().Return(int64(1234)).AnyTimes()
+	mongoCursor.EXPECT().Err().Return(nil).AnyTimes()
+	mongoCursor.EXPECT().Close(gomock.Any()).Return(nil).AnyTimes()
+	mongoCursor.EXPECT().ResumeToken().Return(bson.Raw{}).AnyTimes()
+	mongoCursor.EXPECT().Next(ctx).Return(true).Times(1)
+	mongoCursor.EXPECT().Next(ctx).Return(false).AnyTimes()
+	mongoCursor.EXPECT().Decode(gomock.Any()).DoAndReturn(func(val interface{}) error {
+		if document, ok := val.(*bson.Raw); ok {
+			*document = raw
+			return nil
+		}
+		return errors.New("decode error")
+	}).Times(4)
+
+	file := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	handler := kafka.NewDeadLetterHandler(map[string]kafka.DeadLetterPolicy{
+		kafka.DeadLetterStageDecode: {Action: kafka.DeadLetterActionRetry, Retries: 1},
+	}, logger.NewNopLogger(), kafka.WithDeadLetterQueue(kafka.NewDeadLetterQueue(nil, "", file, time.Second)))
+
+	watcher := NewWatchProducer(mongoCollection, logger.NewNopLogger(), "")
+
+	// When
+	events, err := watcher.GetProducer(
+		WithDecodeDeadLetters(handler),
+		WithMaxRetries(0),
+	)(ctx)
+
+	// Then
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	_, ok := <-events
+	assert.False(ok, "the event cannot be decoded")
+
+	content, err := os.ReadFile(file)
+	assert.NoError(err)
+	assert.Contains(string(content), `"stage":"decode"`)
+	assert.Contains(string(content), `"attempts":2`)
+	assert.Contains(string(content), `"value":"{\"operationType\": {\"$numberInt\":\"42\"}}"`)
+}
+
+func TestWatchProduceStopsSendingWhenContextCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mongoCollection := NewMockCollectionAdapter(ctrl)
+	mongoCursor := NewMockStreamCursor(ctrl)
+
+	mongoCollection.EXPECT().Watch(ctx, bson.A{}, gomock.Any()).Return(mongoCursor, nil)
+	mongoCollection.EXPECT().Name().Return("coll").AnyTimes()
+
+	mongoCursor.EXPECT().ID().Return(int64(1234)).AnyTimes()
+	mongoCursor.EXPECT().Err().Return(nil).AnyTimes()
+	mongoCursor.EXPECT().Decode(gomock.Any()).Return(nil).AnyTimes()
+	mongoCursor.EXPECT().ResumeToken().Return(bson.Raw{}).AnyTimes()
+	mongoCursor.EXPECT().Next(ctx).DoAndReturn(func(ctx context.Context) bool {
+		return ctx.Err() == nil
+	}).AnyTimes()
+	mongoCursor.EXPECT().Close(gomock.Any()).Return(nil)
+
+	watcher := NewWatchProducer(mongoCollection, logger.NewNopLogger(), "")
+
+	events, err := watcher.GetProducer(WithMaxRetries(3))(ctx)
+	assert.Nil(t, err)
+
+	// When
+	<-events
+	cancel()
+
+	// Then the event read before the cancellation is still sent, and the events closed afterwards
+	for range events {
+	}
+}
+
+type flowControlMock struct {
+	paused []bool
+}
+
+func (f *flowControlMock) Wait(ctx context.Context, timeout time.Duration) bool {
+	if timeout == 0 || len(f.paused) == 0 {
+		return ctx.Err() == nil
+	}
+	paused := f.paused[0]
+	f.paused = f.paused[1:]
+	return !paused
+}
+
+func TestWatchProduceReopensCursorAfterPause(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mongoCollection := NewMockCollectionAdapter(ctrl)
+	pausedCursor := NewMockStreamCursor(ctrl)
+	mongoCursor := NewMockStreamCursor(ctrl)
+
+	var reopenOptions *options.ChangeStreamOptions
+	gomock.InOrder(
+		mongoCollection.EXPECT().Watch(ctx, bson.A{}, gomock.Any()).Return(pausedCursor, nil),
+		mongoCollection.EXPECT().Watch(ctx, bson.A{}, gomock.Any()).DoAndReturn(func(_ context.Context, _ interface{}, opts ...*options.ChangeStreamOptions) (StreamCursor, error) {
+			reopenOptions = opts[0]
+			return mongoCursor, nil
+		}),
+	)
+	mongoCollection.EXPECT().Name().Return("coll").AnyTimes()
+
+	// The stream is paused before the first event is pulled
+	pausedCursor.EXPECT().ResumeToken().Return(bson.Raw{})
+	pausedCursor.EXPECT().Close(gomock.Any()).Return(nil)
+
+	mongoCursor.EXPECT().ID().Return(int64(1234)).AnyTimes()
+	mongoCursor.EXPECT().Err().Return(nil).AnyTimes()
+	mongoCursor.EXPECT().Decode(gomock.Any()).Return(nil).AnyTimes()
+	mongoCursor.EXPECT().ResumeToken().Return(bson.Raw{}).AnyTimes()
+	mongoCursor.EXPECT().Next(ctx).DoAndReturn(func(ctx context.Context) bool {
+		return ctx.Err() == nil
+	}).AnyTimes()
+	mongoCursor.EXPECT().Close(gomock.Any()).Return(nil)
+
+	watcher := NewWatchProducer(mongoCollection, logger.NewNopLogger(), "")
+
+	// When
+	events, err := watcher.GetProducer(
+		WithFlowControl(&flowControlMock{paused: []bool{true}}, time.Second, func() []byte {
+			return []byte(`{"_data":"delivered"}`)
+		}),
+	)(ctx)
+	assert.Nil(t, err)
+
+	// Then
+	<-events
+	cancel()
+	for range events {
+	}
+
+	assert.Equal(t, bson.M{"_data": "delivered"}, reopenOptions.ResumeAfter)
+	assert.Nil(t, reopenOptions.StartAfter)
+}
+
+type streamObserverMock struct {
+	mutex                   sync.Mutex
+	opened, closed, stopped int
+	tokens                  []bson.Raw
+	// Whether the cursor was closed when the stream stopped
+	closedBeforeStop bool
+}
+
+func (o *streamObserverMock) CursorOpened() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.opened++
+}
+
+func (o *streamObserverMock) CursorClosed() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.closed++
+}
+
+func (o *streamObserverMock) Advanced(resumeToken bson.Raw) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.tokens = append(o.tokens, resumeToken)
+}
+
+func (o *streamObserverMock) Stopped() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.stopped++
+	o.closedBeforeStop = o.closed == o.opened
+}
+
+func TestWatchProduceNotifiesStreamObserver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	mongoCollection := NewMockCollectionAdapter(ctrl)
+	mongoCursor := NewMockStreamCursor(ctrl)
+
+	mongoCollection.EXPECT().Watch(ctx, bson.A{}, gomock.Any()).Return(mongoCursor, nil)
+	mongoCollection.EXPECT().Name().Return("coll").AnyTimes()
+
+	idleToken := bson.Raw(`idle`)
+	eventToken := bson.Raw(`event`)
+	gomock.InOrder(
+		// An empty batch of an idle collection, then an event and the end of the stream
+		mongoCursor.EXPECT().TryNext(ctx).Return(false),
+		mongoCursor.EXPECT().ResumeToken().Return(idleToken),
+		mongoCursor.EXPECT().TryNext(ctx).Return(true),
+		mongoCursor.EXPECT().ResumeToken().Return(eventToken),
+		mongoCursor.EXPECT().TryNext(ctx).Return(false),
+	)
+	gomock.InOrder(
+		mongoCursor.EXPECT().ID().Return(int64(1234)).Times(2),
+		mongoCursor.EXPECT().ID().Return(int64(0)),
+	)
+	mongoCursor.EXPECT().Err().Return(nil).AnyTimes()
+	mongoCursor.EXPECT().Decode(gomock.Any()).Return(nil)
+	mongoCursor.EXPECT().ResumeToken().Return(eventToken).AnyTimes()
+	mongoCursor.EXPECT().Close(gomock.Any()).Return(nil)
+
+	observer := &streamObserverMock{}
+	watcher := NewWatchProducer(mongoCollection, logger.NewNopLogger(), "")
+
+	// When
+	events, err := watcher.GetProducer(WithStreamObserver(observer), WithMaxRetries(0))(ctx)
+	assert.Nil(t, err)
+
+	// Then
+	var count int
+	for range events {
+		count++
+	}
+
+	assert.Equal(t, 1, count)
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+	assert.Equal(t, 1, observer.opened)
+	assert.Equal(t, 1, observer.closed)
+	assert.Equal(t, 1, observer.stopped)
+	assert.True(t, observer.closedBeforeStop, "the cursor is closed before the stream stops")
+	assert.Equal(t, []bson.Raw{idleToken, eventToken}, observer.tokens)
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+)
+
+// Returns the backpressure pausing the change stream while the outstanding messages exceed the byte
+// budget, nil when there is no budget
+func (container *Container) getBackpressure() *kafka.Backpressure {
+	if container.Cfg.BackpressureMaxBytes <= 0 {
+		return nil
+	}
+
+	if container.backpressure == nil {
+		if container.Cfg.Kafka.TransactionalID != "" {
+			panic(errors.New("the backpressure cannot be used when KAFKA_TRANSACTIONAL_ID is set"))
+		}
+
+		container.backpressure = kafka.NewBackpressure(
+			container.Cfg.BackpressureMaxBytes,
+			container.Cfg.BackpressureResumeRatio,
+			container.GetLogger(),
+		)
+	}
+
+	return container.backpressure
+}
+
+// Returns the backpressure middleware, nil when there is no byte budget. It has to be subscribed after
+// the dead letter middleware.
+func (container *Container) getKafkaBackpressureMiddleware() kafka.Middleware {
+	backpressure := container.getBackpressure()
+	if backpressure == nil {
+		return nil
+	}
+	container.dispatcher.Subscribe(backpressure.Subscriber())
+
+	return backpressure
+}
@@ -6,10 +6,13 @@ import (
 	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/etf1/kafka-mongo-watcher/config"
 	"github.com/etf1/kafka-mongo-watcher/internal/debug"
+	"github.com/etf1/kafka-mongo-watcher/internal/health"
 	"github.com/etf1/kafka-mongo-watcher/internal/http"
 	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
 	"github.com/etf1/kafka-mongo-watcher/internal/metrics"
 	"github.com/etf1/kafka-mongo-watcher/internal/mongo"
+	"github.com/etf1/kafka-mongo-watcher/internal/sink"
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription"
 	"github.com/gol4ng/logger"
 	mongodriver "go.mongodb.org/mongo-driver/mongo"
 	"go.opentelemetry.io/otel/trace"
@@ -18,12 +21,17 @@ import (
 // Container stores all the application services references
 type Container struct {
 	baseContext context.Context
+	halt        context.CancelCauseFunc
 	Cfg         *config.Base
 
 	debugger *debug.Debugger
 	logger   logger.LoggerInterface
 
-	httpServer *http.Server
+	httpServer    *http.Server
+	streamMonitor *health.StreamMonitor
+
+	subscriptionBroadcaster *subscription.Broadcaster
+	grpcServer              *subscription.Server
 
 	mongoDB         *mongodriver.Database
 	mongoCollection mongo.CollectionAdapter
@@ -31,11 +39,26 @@ type Container struct {
 	replayProducer                       *mongo.ReplayProducer
 	watchProducer                        *mongo.WatchProducer
 	changeEventTransformerToKafkaMessage *mongo.ChangeEventKafkaMessageTransformer
+	router                               *mongo.Router
+	headerBuilder                        *mongo.HeaderBuilder
+	coalescer                            *mongo.Coalescer
+	transactionGrouper                   *mongo.TransactionGrouper
+
+	kafkaProducer        *kafkaconfluent.Producer
+	kafkaMirrorProducers []*kafkaMirrorProducer
+	kafkaRecorder        metrics.KafkaRecorder
+
+	pipelineRecorder metrics.PipelineRecorder
 
-	kafkaProducer *kafkaconfluent.Producer
-	kafkaRecorder metrics.KafkaRecorder
+	deadLetterHandler *kafka.DeadLetterHandler
+	deadLetterQueue   *kafka.DeadLetterQueue
+	backpressure      *kafka.Backpressure
 
-	kafkaClient kafka.Client
+	topicProvisioner *kafka.TopicProvisioner
+
+	sink              sink.Sink
+	dispatcher        *kafka.Dispatcher
+	checkpointTracker *kafka.CheckpointTracker
 
 	tracerProvider trace.TracerProvider
 }
@@ -43,8 +66,24 @@ type Container struct {
 // NewContainer returns a dependency injection container that allows
 // to retrieve services
 func NewContainer(ctx context.Context, cfg *config.Base) *Container {
+	ctx, halt := context.WithCancelCause(ctx)
 	return &Container{
 		Cfg:         cfg,
 		baseContext: ctx,
+		halt:        halt,
+	}
+}
+
+// Context returns the context of the stream, canceled when the stream is halted by a dead letter policy.
+// The cause of the halt is available with context.Cause.
+func (container *Container) Context() context.Context {
+	return container.baseContext
+}
+
+// GetPipelineName returns the name identifying the watched stream, "<database>.<collection>" by default
+func (container *Container) GetPipelineName() string {
+	if container.Cfg.PipelineName != "" {
+		return container.Cfg.PipelineName
 	}
+	return container.Cfg.MongoDB.DatabaseName + "." + container.Cfg.MongoDB.CollectionName
 }
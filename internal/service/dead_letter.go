@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+)
+
+func (container *Container) getDeadLetterHandler() *kafka.DeadLetterHandler {
+	if container.deadLetterHandler == nil {
+		policies := container.getDeadLetterPolicies()
+
+		options := []kafka.DeadLetterOption{
+			kafka.WithHaltFunc(container.halt),
+			kafka.WithDeadLetterRecorder(container.GetPipelineRecorder()),
+			kafka.WithRetryBackoff(container.Cfg.DeadLetterRetryBackoff, container.Cfg.DeadLetterRetryMaxBackoff),
+		}
+		if container.Cfg.DeadLetterTopic != "" || container.Cfg.DeadLetterFile != "" {
+			options = append(options, kafka.WithDeadLetterQueue(container.getDeadLetterQueue()))
+		}
+
+		container.deadLetterHandler = kafka.NewDeadLetterHandler(policies, container.GetLogger(), options...)
+	}
+
+	return container.deadLetterHandler
+}
+
+func (container *Container) getDeadLetterPolicies() map[string]kafka.DeadLetterPolicy {
+	policies, err := kafka.ParseDeadLetterPolicies(container.Cfg.DeadLetterPolicies)
+	if err != nil {
+		panic(err)
+	}
+	return policies
+}
+
+func (container *Container) getDeadLetterQueue() *kafka.DeadLetterQueue {
+	if container.deadLetterQueue == nil {
+		var producer kafka.KafkaProducer
+		if container.Cfg.DeadLetterTopic != "" {
+			producer = container.getDeadLetterProducer()
+		}
+
+		container.deadLetterQueue = kafka.NewDeadLetterQueue(
+			producer,
+			container.Cfg.DeadLetterTopic,
+			container.Cfg.DeadLetterFile,
+			container.Cfg.DeadLetterTimeout,
+		)
+	}
+
+	return container.deadLetterQueue
+}
+
+// Returns a dedicated producer, so that dead letters are sent outside of the data transactions
+func (container *Container) getDeadLetterProducer() *kafkaconfluent.Producer {
+	producer, err := kafkaconfluent.NewProducer(container.getKafkaConfigMap(kafkaconfluent.ConfigMap{
+		"message.max.bytes": container.Cfg.Kafka.MessageMaxBytes,
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	// Delivery reports are sent to the dead letter queue, only errors remain
+	go func() {
+		for event := range producer.Events() {
+			if err, ok := event.(kafkaconfluent.Error); ok {
+				container.GetLogger().Warning("Dead letter producer error", logger.Error("error", err))
+			}
+		}
+	}()
+
+	return producer
+}
+
+// Returns the middleware applying the delivery stage dead letter policy, nil when there is no such
+// policy: failed deliveries are only counted by the metrics then
+func (container *Container) getKafkaDeadLetterMiddleware(producer kafka.KafkaProducer) kafka.Middleware {
+	if _, ok := container.getDeadLetterPolicies()[kafka.DeadLetterStageDelivery]; !ok {
+		return nil
+	}
+	if container.Cfg.Kafka.TransactionalID != "" {
+		panic(errors.New("the delivery dead letter policy cannot be used when KAFKA_TRANSACTIONAL_ID is set"))
+	}
+
+	var partitions *kafka.PartitionCounter
+	if producer != nil {
+		partitions = container.getKafkaPartitionCounter(container.GetKafkaProducer())
+	}
+
+	deadLetterMiddleware := kafka.NewDeadLetterMiddleware(producer, partitions, container.getDeadLetterHandler())
+	container.dispatcher.Subscribe(deadLetterMiddleware.Subscriber())
+
+	return deadLetterMiddleware
+}
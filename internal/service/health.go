@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/health"
+	"github.com/etf1/kafka-mongo-watcher/internal/http/handler"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// GetStreamMonitor returns the monitor of the change stream, a stream is stalled once its resume token
+// did not advance within HEALTH_STALL_THRESHOLD
+func (container *Container) GetStreamMonitor() *health.StreamMonitor {
+	if container.streamMonitor == nil {
+		var options []health.StreamOption
+		if backpressure := container.getBackpressure(); backpressure != nil {
+			options = append(options, health.WithPauseState(backpressure))
+		}
+
+		container.streamMonitor = health.NewStreamMonitor(container.Cfg.HttpServer.HealthStallThreshold, options...)
+	}
+
+	return container.streamMonitor
+}
+
+// Returns the readiness check pinging the primary of the MongoDB server
+func (container *Container) getMongoCheck() handler.Check {
+	client := container.GetMongoConnection().Client()
+	timeout := container.Cfg.HttpServer.HealthCheckTimeout
+	return func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		if err := client.Ping(ctx, readpref.Primary()); err != nil {
+			return nil, fmt.Errorf("unable to ping MongoDB: %w", err)
+		}
+		return nil, nil
+	}
+}
+
+// Returns the readiness check retrieving the brokers of the Kafka cluster from the producer
+func (container *Container) getKafkaCheck(provider kafka.MetadataProvider) handler.Check {
+	timeout := container.Cfg.HttpServer.HealthCheckTimeout
+	return func(_ context.Context) (interface{}, error) {
+		metadata, err := provider.GetMetadata(nil, false, int(timeout.Milliseconds()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve the Kafka brokers: %w", err)
+		}
+		return map[string]int{"brokers": len(metadata.Brokers)}, nil
+	}
+}
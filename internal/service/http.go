@@ -2,10 +2,35 @@ package service
 
 import (
 	"github.com/etf1/kafka-mongo-watcher/internal/http"
+	"github.com/etf1/kafka-mongo-watcher/internal/http/handler"
+	"github.com/etf1/kafka-mongo-watcher/internal/sink"
 )
 
 func (container *Container) GetHttpServer() *http.Server {
 	if container.httpServer == nil {
+		readinessChecks := map[string]handler.Check{
+			"mongo": container.getMongoCheck(),
+		}
+		livenessChecks := map[string]handler.Check{}
+
+		if container.Cfg.Sink.Sink == sink.Kafka {
+			if container.Cfg.Kafka.Mirrors == "" {
+				readinessChecks["kafka"] = container.getKafkaCheck(container.GetKafkaProducer())
+			}
+			// The mirrors produce to their own clusters
+			for _, mirror := range container.getKafkaMirrorProducers() {
+				readinessChecks["kafka-"+mirror.config.Name] = container.getKafkaCheck(mirror.producer)
+			}
+		}
+		// The replay reads the collection once, without change stream
+		if !container.Cfg.Replay {
+			readinessChecks["stream"] = container.GetStreamMonitor().Running
+			livenessChecks["stream"] = container.GetStreamMonitor().Progressing
+		}
+		if container.GetTopicProvisioner() != nil {
+			readinessChecks["topics"] = container.getTopicsCheck()
+		}
+
 		container.httpServer = http.NewServer(
 			container.GetLogger(),
 			container.GetDebugger(),
@@ -14,6 +39,8 @@ func (container *Container) GetHttpServer() *http.Server {
 			container.Cfg.HttpServer.WriteTimeout,
 			container.Cfg.HttpServer.IdleTimeout,
 			container.Cfg.PprofEnabled,
+			readinessChecks,
+			livenessChecks,
 		)
 	}
 
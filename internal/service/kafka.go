@@ -1,19 +1,100 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
 	"github.com/etf1/opentelemetry-go-contrib/instrumentation/github.com/confluentinc/confluent-kafka-go/otelconfluent"
 	"github.com/gol4ng/logger"
 )
 
+// Returns the configuration of the producers of KAFKA_BOOTSTRAP_SERVERS: the given properties, the
+// default producer properties, the security properties and the KAFKA_CONFIG_<property> ones
+func (container *Container) getKafkaConfigMap(properties kafkaconfluent.ConfigMap) *kafkaconfluent.ConfigMap {
+	configMap := kafka.DefaultProducerConfig()
+	for property, value := range properties {
+		configMap[property] = value
+	}
+
+	return container.getKafkaConsumerConfigMap(configMap)
+}
+
+// Returns the configuration of the consumers of KAFKA_BOOTSTRAP_SERVERS: the given properties, the
+// security properties and the KAFKA_CONFIG_<property> ones
+func (container *Container) getKafkaConsumerConfigMap(properties kafkaconfluent.ConfigMap) *kafkaconfluent.ConfigMap {
+	configMap := kafkaconfluent.ConfigMap{"bootstrap.servers": container.Cfg.Kafka.BootstrapServers}
+	for property, value := range properties {
+		configMap[property] = value
+	}
+
+	security, err := container.getKafkaSecurityConfig().ConfigMap()
+	if err != nil {
+		panic(err)
+	}
+	for property, value := range security {
+		configMap[property] = value
+	}
+
+	for property, value := range container.Cfg.Kafka.Properties {
+		if _, ok := security[property]; ok {
+			panic(fmt.Errorf("the %q Kafka property is set by both a KAFKA_CONFIG_ variable and the security options", property))
+		}
+		configMap[property] = value
+	}
+
+	return &configMap
+}
+
+func (container *Container) getKafkaSecurityConfig() *kafka.SecurityConfig {
+	cfg := container.Cfg.Kafka
+
+	sslKeyPassword, err := kafka.ReadSecret("KAFKA_SSL_KEY_PASSWORD", cfg.SSLKeyPassword, cfg.SSLKeyPasswordFile)
+	if err != nil {
+		panic(err)
+	}
+	saslPassword, err := kafka.ReadSecret("KAFKA_SASL_PASSWORD", cfg.SASLPassword, cfg.SASLPasswordFile)
+	if err != nil {
+		panic(err)
+	}
+	clientSecret, err := kafka.ReadSecret("KAFKA_SASL_OAUTHBEARER_CLIENT_SECRET", cfg.SASLOAuthBearerClientSecret, cfg.SASLOAuthBearerClientSecretFile)
+	if err != nil {
+		panic(err)
+	}
+
+	return &kafka.SecurityConfig{
+		Protocol:                    cfg.SecurityProtocol,
+		SSLCALocation:               cfg.SSLCALocation,
+		SSLCertificateLocation:      cfg.SSLCertificateLocation,
+		SSLKeyLocation:              cfg.SSLKeyLocation,
+		SSLKeyPassword:              sslKeyPassword,
+		SASLMechanism:               cfg.SASLMechanism,
+		SASLUsername:                cfg.SASLUsername,
+		SASLPassword:                saslPassword,
+		OAuthBearerClientID:         cfg.SASLOAuthBearerClientID,
+		OAuthBearerClientSecret:     clientSecret,
+		OAuthBearerTokenEndpointURL: cfg.SASLOAuthBearerTokenEndpointURL,
+		OAuthBearerScope:            cfg.SASLOAuthBearerScope,
+	}
+}
+
 func (container *Container) GetKafkaProducer() *kafkaconfluent.Producer {
 	if container.kafkaProducer == nil {
-		producer, err := kafkaconfluent.NewProducer(&kafkaconfluent.ConfigMap{
-			"bootstrap.servers":       container.Cfg.Kafka.BootstrapServers,
+		configMap := container.getKafkaConfigMap(kafkaconfluent.ConfigMap{
 			"go.produce.channel.size": container.Cfg.Kafka.ProduceChannelSize,
 			"message.max.bytes":       container.Cfg.Kafka.MessageMaxBytes,
 		})
+		if partitioner := container.getKafkaPartitioner(); partitioner != "" {
+			configMap.SetKey("partitioner", partitioner)
+		}
+		if container.Cfg.Kafka.TransactionalID != "" {
+			configMap.SetKey("transactional.id", container.Cfg.Kafka.TransactionalID)
+			configMap.SetKey("transaction.timeout.ms", int(container.Cfg.Kafka.TransactionTimeout.Milliseconds()))
+		}
+
+		producer, err := kafkaconfluent.NewProducer(configMap)
 		if err != nil {
 			panic(err)
 		}
@@ -27,36 +108,195 @@ func (container *Container) GetKafkaProducer() *kafkaconfluent.Producer {
 	return container.kafkaProducer
 }
 
-func (container *Container) GetKafkaClient() kafka.Client {
-	if container.kafkaClient == nil {
-		if container.Cfg.Kafka.WithDecorators {
-			container.kafkaClient = container.decorateKafkaClientWithMetrics(
-				container.decorateKafkaClientWithLogger(
-					container.decorateKafkaClientWithTracer(
-						container.decorateKafkaClientWithDebugger(
-							container.getKafkaBaseClient(),
-						),
-					),
-				),
-			)
-		} else {
-			container.kafkaClient = container.getKafkaBaseClient()
-		}
+// Returns the partitioner of the messages without explicit partition, empty for the producer default
+func (container *Container) getKafkaPartitioner() string {
+	partitioner, err := kafka.ParsePartitioner(container.Cfg.Kafka.Partitioner)
+	if err != nil {
+		panic(err)
 	}
-
-	return container.kafkaClient
+	return partitioner
 }
 
-func (container *Container) getKafkaBaseClient() kafka.Client {
-	originalKafkaProducer := container.GetKafkaProducer()
-	var kafkaProducer kafka.KafkaProducer = originalKafkaProducer
+// Returns the counter of the topic partitions known by the producer
+func (container *Container) getKafkaPartitionCounter(producer kafka.MetadataProvider) *kafka.PartitionCounter {
+	return kafka.NewPartitionCounter(producer, container.Cfg.Kafka.PartitionMetadataTimeout, container.Cfg.Kafka.PartitionMetadataTTL)
+}
 
+// Returns the producer, decorated with OpenTelemetry when enabled
+func (container *Container) decorateKafkaProducer(producer *kafkaconfluent.Producer) kafka.TransactionalKafkaProducer {
 	if container.Cfg.OtelCollectorEndpoint != "" && container.Cfg.Kafka.WithDecorators {
 		// In case OpenTelemetry endpoint is enabled, decorate the Kafka producer.
-		kafkaProducer = container.decorateKafkaClientWithOpenTelemetry(originalKafkaProducer)
+		return container.decorateKafkaClientWithOpenTelemetry(producer)
+	}
+
+	return producer
+}
+
+func (container *Container) getKafkaBaseClient(kafkaProducer kafka.TransactionalKafkaProducer) kafka.Client {
+	if container.Cfg.Kafka.TransactionalID != "" {
+		options := []kafka.TransactionalOption{
+			kafka.WithTransactionBatchSize(container.Cfg.Kafka.TransactionBatchSize),
+			kafka.WithTransactionBatchTimeout(container.Cfg.Kafka.TransactionBatchTimeout),
+			kafka.WithTransactionOperationTimeout(container.Cfg.Kafka.TransactionOperationTimeout),
+			kafka.WithTransactionTimeout(container.Cfg.Kafka.TransactionTimeout),
+			kafka.WithTransactionHaltFunc(container.halt),
+			kafka.WithTransactionPartitionCounter(container.getKafkaPartitionCounter(container.GetKafkaProducer())),
+		}
+		if container.Cfg.Kafka.CheckpointTopic != "" {
+			options = append(options, kafka.WithCheckpointTopic(container.Cfg.Kafka.CheckpointTopic, container.GetPipelineName()))
+		}
+		if container.Cfg.CheckpointFile != "" {
+			// The checkpoint tracker is not fed by the transactions, the file would never be written
+			panic(errors.New("CHECKPOINT_FILE cannot be used when KAFKA_TRANSACTIONAL_ID is set, use KAFKA_CHECKPOINT_TOPIC"))
+		}
+		return kafka.NewTransactionalClient(kafkaProducer, container.GetLogger(), options...)
+	}
+
+	if container.Cfg.Kafka.CheckpointTopic != "" {
+		panic(errors.New("checkpoints can only be stored in Kafka when KAFKA_TRANSACTIONAL_ID is set"))
+	}
+
+	return kafka.NewClient(
+		kafkaProducer,
+		kafka.WithFlushTimeout(container.Cfg.Kafka.FlushTimeout),
+		kafka.WithPartitionCounter(container.getKafkaPartitionCounter(container.GetKafkaProducer())),
+	)
+}
+
+// Returns the client mirroring the messages to the Kafka clusters of KAFKA_MIRRORS
+func (container *Container) getKafkaMirrorClient() kafka.Client {
+	if container.Cfg.Kafka.TransactionalID != "" || container.Cfg.Kafka.CheckpointTopic != "" {
+		panic(errors.New("KAFKA_MIRRORS cannot be used when KAFKA_TRANSACTIONAL_ID or KAFKA_CHECKPOINT_TOPIC is set"))
+	}
+	if _, ok := container.getDeadLetterPolicies()[kafka.DeadLetterStageDelivery]; ok {
+		panic(errors.New("the delivery dead letter policy cannot be used when KAFKA_MIRRORS is set"))
+	}
+
+	destinations := make([]*kafka.MirrorDestination, 0, len(container.getKafkaMirrorProducers()))
+	for _, mirror := range container.getKafkaMirrorProducers() {
+		config, producer := mirror.config, mirror.producer
+		destinationClient := kafka.NewClient(
+			container.decorateKafkaProducer(producer),
+			kafka.WithFlushTimeout(container.Cfg.Kafka.FlushTimeout),
+			kafka.WithPartitionCounter(container.getKafkaPartitionCounter(producer)),
+		)
+		destinations = append(destinations, &kafka.MirrorDestination{
+			Name:       config.Name,
+			Client:     destinationClient,
+			Topics:     config.Topics,
+			BestEffort: config.BestEffort,
+		})
+	}
+
+	client, err := kafka.NewMirrorClient(destinations, container.GetLogger(), kafka.WithMirrorHaltFunc(container.halt))
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// A producer of a KAFKA_MIRRORS destination
+type kafkaMirrorProducer struct {
+	config   *kafka.MirrorConfig
+	producer *kafkaconfluent.Producer
+}
+
+// Returns the producers of the KAFKA_MIRRORS destinations, in order
+func (container *Container) getKafkaMirrorProducers() []*kafkaMirrorProducer {
+	if container.kafkaMirrorProducers == nil {
+		configs, err := kafka.ParseMirrorConfigs(container.Cfg.Kafka.Mirrors)
+		if err != nil {
+			panic(err)
+		}
+
+		container.kafkaMirrorProducers = make([]*kafkaMirrorProducer, 0, len(configs))
+		for _, config := range configs {
+			base := kafka.DefaultProducerConfig()
+			base["go.produce.channel.size"] = container.Cfg.Kafka.ProduceChannelSize
+			base["message.max.bytes"] = container.Cfg.Kafka.MessageMaxBytes
+			if partitioner := container.getKafkaPartitioner(); partitioner != "" {
+				base["partitioner"] = partitioner
+			}
+
+			configMap, err := config.ConfigMap(base)
+			if err != nil {
+				panic(err)
+			}
+
+			producer, err := kafkaconfluent.NewProducer(configMap)
+			if err != nil {
+				panic(err)
+			}
+			container.GetLogger().Info("Connected to kafka mirror producer", logger.String("mirror", config.Name), logger.Any("bootstrap-servers", config.Config["bootstrap.servers"]), logger.Bool("best_effort", config.BestEffort))
+
+			container.kafkaMirrorProducers = append(container.kafkaMirrorProducers, &kafkaMirrorProducer{config: config, producer: producer})
+		}
+	}
+
+	return container.kafkaMirrorProducers
+}
+
+// GetCheckpointTracker returns the tracker of the latest checkpoint whose messages have all been delivered
+func (container *Container) GetCheckpointTracker() *kafka.CheckpointTracker {
+	if container.checkpointTracker == nil {
+		container.checkpointTracker = kafka.NewCheckpointTracker()
 	}
 
-	return kafka.NewClient(kafkaProducer)
+	return container.checkpointTracker
+}
+
+// PersistCheckpoint writes the last delivered checkpoint to the checkpoint file, when there is one
+func (container *Container) PersistCheckpoint() error {
+	checkpoint := container.GetCheckpointTracker().Checkpoint()
+	if container.Cfg.CheckpointFile == "" || checkpoint == nil {
+		return nil
+	}
+
+	if err := kafka.WriteCheckpointFile(container.Cfg.CheckpointFile, checkpoint); err != nil {
+		return err
+	}
+	container.GetLogger().Info("Checkpoint persisted", logger.String("file", container.Cfg.CheckpointFile), logger.ByteString("checkpoint", checkpoint))
+
+	return nil
+}
+
+// Returns the checkpoint stored in the checkpoint file, nil when there is none
+func (container *Container) getFileCheckpoint() []byte {
+	checkpoint, err := kafka.ReadCheckpointFile(container.Cfg.CheckpointFile)
+	if err != nil {
+		panic(err)
+	}
+
+	container.GetLogger().Info("Read checkpoint from file", logger.String("file", container.Cfg.CheckpointFile), logger.ByteString("checkpoint", checkpoint))
+
+	return checkpoint
+}
+
+// Returns the last checkpoint stored in the Kafka checkpoint topic for the pipeline, nil when there is none
+func (container *Container) getKafkaCheckpoint() []byte {
+	consumer, err := kafkaconfluent.NewConsumer(container.getKafkaConsumerConfigMap(kafkaconfluent.ConfigMap{
+		"group.id":             container.GetPipelineName() + "-checkpoint",
+		"isolation.level":      "read_committed",
+		"enable.partition.eof": true,
+		"enable.auto.commit":   false,
+	}))
+	if err != nil {
+		panic(err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(container.baseContext, container.Cfg.Kafka.CheckpointReadTimeout)
+	defer cancel()
+
+	checkpoint, err := kafka.NewCheckpointReader(consumer, container.Cfg.Kafka.CheckpointTopic).Read(ctx, container.GetPipelineName())
+	if err != nil {
+		panic(err)
+	}
+
+	container.GetLogger().Info("Read checkpoint from Kafka", logger.String("topic", container.Cfg.Kafka.CheckpointTopic), logger.String("pipeline", container.GetPipelineName()), logger.ByteString("checkpoint", checkpoint))
+
+	return checkpoint
 }
 
 func (container *Container) decorateKafkaClientWithOpenTelemetry(producer *kafkaconfluent.Producer) *otelconfluent.Producer {
@@ -67,25 +307,22 @@ func (container *Container) decorateKafkaClientWithOpenTelemetry(producer *kafka
 	)
 }
 
-func (container *Container) decorateKafkaClientWithDebugger(client kafka.Client) kafka.Client {
+func (container *Container) subscribeKafkaDebugger() {
 	if container.Cfg.HttpServer.DebugEnabled {
-		client = kafka.NewClientDebugger(client, container.GetDebugger().Add)
+		container.dispatcher.Subscribe(kafka.NewDebuggerSubscriber(container.GetDebugger().Add))
 	}
-
-	return client
 }
 
-func (container *Container) decorateKafkaClientWithLogger(client kafka.Client) kafka.Client {
-	return kafka.NewClientLogger(client, container.GetLogger())
-}
+func (container *Container) getKafkaLoggerMiddleware() kafka.Middleware {
+	loggerMiddleware := kafka.NewLoggerMiddleware(container.GetLogger())
+	container.dispatcher.Subscribe(loggerMiddleware.Subscriber())
 
-func (container *Container) decorateKafkaClientWithTracer(client kafka.Client) kafka.Client {
-	return kafka.NewClientTracer(client, kafka.AddTracingHeader)
+	return loggerMiddleware
 }
 
-func (container *Container) decorateKafkaClientWithMetrics(client kafka.Client) kafka.Client {
-	clientMetric := kafka.NewClientMetric(client, container.GetKafkaRecorder())
-	go clientMetric.Record()
+func (container *Container) getKafkaMetricMiddleware() kafka.Middleware {
+	metricMiddleware := kafka.NewMetricMiddleware(container.GetKafkaRecorder())
+	container.dispatcher.Subscribe(metricMiddleware.Subscriber())
 
-	return clientMetric
+	return metricMiddleware
 }
@@ -16,3 +16,11 @@ func (container *Container) GetKafkaRecorder() metrics.KafkaRecorder {
 
 	return container.kafkaRecorder
 }
+
+func (container *Container) GetPipelineRecorder() metrics.PipelineRecorder {
+	if container.pipelineRecorder == nil {
+		container.pipelineRecorder = metrics.NewPipelineRecorder().RegisterOn(container.GetMetricsRegistry())
+	}
+
+	return container.pipelineRecorder
+}
@@ -14,23 +14,134 @@ import (
 )
 
 func (container *Container) GetChangeEventProducer() mongo.ChangeEventProducer {
+	var producer mongo.ChangeEventProducer
 	if container.Cfg.Replay {
-		return container.getReplayProducer().Produce
+		producer = container.getReplayProducer().Produce
 	} else {
-		return container.getWatchProducer().GetProducer(container.getWatchOptions()...)
+		producer = container.getWatchProducer().GetProducer(container.getWatchOptions()...)
 	}
+
+	// Transactions are detected on the change stream order, before the coalescer holds events back
+	if container.Cfg.TransactionGrouping {
+		producer = container.getTransactionGrouper().Wrap(producer)
+	}
+	if container.Cfg.CoalesceWindow > 0 {
+		producer = container.getCoalescer().Wrap(producer)
+	}
+	return producer
+}
+
+func (container *Container) getTransactionGrouper() *mongo.TransactionGrouper {
+	if container.transactionGrouper == nil {
+		container.transactionGrouper = mongo.NewTransactionGrouper(
+			container.Cfg.Kafka.HeadersPrefix,
+			container.GetLogger(),
+			mongo.WithTransactionMaxWait(container.Cfg.TransactionMaxWait),
+			mongo.WithTransactionMaxEvents(container.Cfg.TransactionMaxEvents),
+		)
+	}
+	return container.transactionGrouper
+}
+
+func (container *Container) getCoalescer() *mongo.Coalescer {
+	if container.coalescer == nil {
+		container.coalescer = mongo.NewCoalescer(
+			container.Cfg.CoalesceWindow,
+			container.GetLogger(),
+			mongo.WithCoalesceMaxEvents(container.Cfg.CoalesceMaxEvents),
+			mongo.WithCoalesceMaxKeys(container.Cfg.CoalesceMaxKeys),
+			mongo.WithCoalesceMergeUpdates(container.Cfg.CoalesceMergeUpdates),
+			mongo.WithCoalesceRecorder(container.GetPipelineRecorder()),
+		)
+	}
+	return container.coalescer
 }
 
 func (container *Container) GetChangeEventKafkaMessageTransformer() *mongo.ChangeEventKafkaMessageTransformer {
 	if container.changeEventTransformerToKafkaMessage == nil {
+		deletePolicy, err := mongo.ParseDeletePolicy(container.Cfg.Kafka.DeletePolicy)
+		if err != nil {
+			panic(err)
+		}
+
+		timestampSource, err := mongo.ParseTimestampSource(container.Cfg.Kafka.TimestampSource, container.Cfg.Kafka.TimestampField)
+		if err != nil {
+			panic(err)
+		}
+
+		updateFormat, err := mongo.ParseUpdateFormat(container.Cfg.Kafka.UpdateFormat)
+		if err != nil {
+			panic(err)
+		}
+
+		clusterTimeFormat, err := mongo.ParseClusterTimeFormat(container.Cfg.Kafka.ClusterTimeFormat)
+		if err != nil {
+			panic(err)
+		}
+
+		partitionSource, err := mongo.ParsePartitionSource(container.Cfg.Kafka.PartitionSource, container.Cfg.Kafka.PartitionField)
+		if err != nil {
+			panic(err)
+		}
+
 		container.changeEventTransformerToKafkaMessage = mongo.NewChangeEventKafkaMessageTransformer(
 			container.Cfg.Topic,
 			container.GetLogger(),
+			mongo.WithRouter(container.getRouter()),
+			mongo.WithHeaderBuilder(container.getHeaderBuilder()),
+			mongo.WithDeletePolicy(deletePolicy),
+			mongo.WithTombstoneKeysLimit(container.Cfg.Kafka.TombstoneKeysLimit),
+			mongo.WithTransformerRecorder(container.GetPipelineRecorder()),
+			mongo.WithTimestampSource(timestampSource),
+			mongo.WithPartitionSource(partitionSource),
+			mongo.WithUpdateFormat(updateFormat),
+			mongo.WithClusterTimeFormat(clusterTimeFormat),
+			mongo.WithTransactionTopic(container.Cfg.Kafka.TransactionTopic),
+			mongo.WithTransformDeadLetters(container.getDeadLetterHandler()),
 		)
 	}
 	return container.changeEventTransformerToKafkaMessage
 }
 
+func (container *Container) getRouter() *mongo.Router {
+	if container.router == nil {
+		rules, err := mongo.ParseRoutingRules(container.Cfg.Kafka.RoutingRules)
+		if err != nil {
+			panic(err)
+		}
+
+		container.router = mongo.NewRouter(
+			container.Cfg.Topic,
+			mongo.WithRoutingRules(rules),
+			mongo.WithDropUnmatched(container.Cfg.Kafka.RoutingDropUnmatched),
+			mongo.WithRoutingRecorder(container.GetKafkaRecorder()),
+		)
+	}
+	return container.router
+}
+
+func (container *Container) getHeaderBuilder() *mongo.HeaderBuilder {
+	if container.headerBuilder == nil {
+		kafkaCfg := container.Cfg.Kafka
+
+		staticHeaders, err := mongo.ParseStaticHeaders(kafkaCfg.StaticHeaders)
+		if err != nil {
+			panic(err)
+		}
+
+		container.headerBuilder, err = mongo.NewHeaderBuilder(
+			kafkaCfg.HeadersPrefix,
+			mongo.WithMetadataHeaders(mongo.ParseHeaderMappings(kafkaCfg.Headers)),
+			mongo.WithDocumentFieldHeaders(mongo.ParseHeaderMappings(kafkaCfg.DocumentHeaders)),
+			mongo.WithStaticHeaders(staticHeaders),
+		)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return container.headerBuilder
+}
+
 func (container *Container) getReplayProducer() *mongo.ReplayProducer {
 	if container.replayProducer == nil {
 		container.replayProducer = mongo.NewReplayProducer(
@@ -55,17 +166,52 @@ func (container *Container) getWatchProducer() *mongo.WatchProducer {
 
 func (container *Container) getWatchOptions() []mongo.WatchOption {
 	configOptions := container.Cfg.MongoDB.Options
+
+	// A configured resume token has precedence over the stored checkpoint
+	resumeAfter := []byte(configOptions.ResumeAfter)
+	resumedFromCheckpoint := false
+	if len(resumeAfter) == 0 && container.Cfg.Kafka.CheckpointTopic != "" {
+		resumeAfter = container.getKafkaCheckpoint()
+		resumedFromCheckpoint = len(resumeAfter) > 0
+	}
+	if len(resumeAfter) == 0 && container.Cfg.CheckpointFile != "" {
+		resumeAfter = container.getFileCheckpoint()
+		resumedFromCheckpoint = len(resumeAfter) > 0
+	}
+
 	options := []mongo.WatchOption{
 		mongo.WithBatchSize(configOptions.BatchSize),
 		mongo.WithFullDocument(configOptions.FullDocument),
 		mongo.WithMaxAwaitTime(configOptions.MaxAwaitTime),
-		mongo.WithResumeAfter([]byte(configOptions.ResumeAfter)),
+		mongo.WithResumeAfter(resumeAfter),
 		mongo.WithMaxRetries(configOptions.WatchMaxRetries),
 		mongo.WithRetryDelay(configOptions.WatchRetryDelay),
 		mongo.WithIgnoreUpdateDescription(configOptions.IgnoreUpdateDescription),
+		mongo.WithDecodeDeadLetters(container.getDeadLetterHandler()),
+		mongo.WithStreamObserver(container.GetStreamMonitor()),
+	}
+
+	if backpressure := container.getBackpressure(); backpressure != nil {
+		options = append(options, mongo.WithFlowControl(backpressure, container.Cfg.BackpressurePauseTimeout, container.GetCheckpointTracker().Checkpoint))
+	}
+
+	if configOptions.UpdateFilters != "" {
+		rules, err := mongo.ParseUpdateFilterRules(configOptions.UpdateFilters)
+		if err != nil {
+			panic(err)
+		}
+		options = append(options, mongo.WithUpdateFilter(mongo.NewUpdateFilter(rules, container.Cfg.Kafka.HeadersPrefix)))
 	}
 
 	switch {
+	case resumedFromCheckpoint:
+		// The change stream cannot both resume after a token and start at an operation time
+	case configOptions.StartAtOperationTime != "":
+		startAt, err := mongo.ParseOperationTime(configOptions.StartAtOperationTime)
+		if err != nil {
+			panic(err)
+		}
+		options = append(options, mongo.WithStartAtOperationTime(startAt))
 	case configOptions.StartAtOperationTimeT > 0:
 		startAt := primitive.Timestamp{
 			T: configOptions.StartAtOperationTimeT,
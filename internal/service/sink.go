@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/sink"
+	"github.com/gol4ng/logger"
+)
+
+// GetSink returns the destination of the messages selected by the configuration, with the client
+// middlewares applied
+func (container *Container) GetSink() sink.Sink {
+	if container.sink == nil {
+		var (
+			base sink.Sink
+			// Producer used by the dead letter middleware to retry the failed deliveries, the file sinks
+			// acknowledge the messages once written and never report a failed delivery
+			kafkaProducer kafka.TransactionalKafkaProducer
+		)
+		switch container.Cfg.Sink.Sink {
+		case sink.Kafka:
+			if container.Cfg.Kafka.Mirrors != "" {
+				base = container.getKafkaMirrorClient()
+				break
+			}
+			kafkaProducer = container.decorateKafkaProducer(container.GetKafkaProducer())
+			base = container.getKafkaBaseClient(kafkaProducer)
+		case sink.Stdout:
+			base = sink.NewStdoutSink()
+		case sink.File:
+			base = container.getFileSink()
+		case sink.Webhook:
+			base = container.getWebhookSink()
+		default:
+			panic(fmt.Errorf("unknown sink %q, expected one of %q, %q, %q, %q", container.Cfg.Sink.Sink, sink.Kafka, sink.Stdout, sink.File, sink.Webhook))
+		}
+		container.GetLogger().Info("Sink selected", logger.String("sink", container.Cfg.Sink.Sink))
+
+		// The dispatcher is the only reader of the sink events, the middlewares subscribe to it
+		container.dispatcher = kafka.NewDispatcher(base.Events())
+		go container.dispatcher.Run()
+
+		var middlewares []kafka.Middleware
+		if broadcaster := container.GetSubscriptionBroadcaster(); broadcaster != nil {
+			// First stage, the messages produced again are published once
+			middlewares = append(middlewares, broadcaster)
+		}
+		if container.Cfg.Kafka.WithDecorators {
+			middlewares = append(middlewares,
+				container.getKafkaMetricMiddleware(),
+				container.getKafkaLoggerMiddleware(),
+				kafka.NewTracerMiddleware(kafka.AddTracingHeader),
+			)
+			container.subscribeKafkaDebugger()
+		}
+		if deadLetters := container.getKafkaDeadLetterMiddleware(kafkaProducer); deadLetters != nil {
+			middlewares = append(middlewares, deadLetters)
+		}
+		if backpressure := container.getKafkaBackpressureMiddleware(); backpressure != nil {
+			// Last stage, each produce attempt is counted
+			middlewares = append(middlewares, backpressure)
+		}
+		if container.Cfg.Kafka.TransactionalID == "" || container.Cfg.Sink.Sink != sink.Kafka {
+			// Subscribed after the dead letter middleware, which tells whether failed deliveries are over
+			container.dispatcher.Subscribe(container.GetCheckpointTracker().Subscriber())
+			// Numbers the produced messages so that the checkpoint of the events without message is delivered too
+			base = container.GetCheckpointTracker().Client(base)
+		}
+
+		container.sink = kafka.NewPipeline(base, middlewares...)
+	}
+
+	return container.sink
+}
+
+// GetDispatcher returns the dispatcher of the sink events
+func (container *Container) GetDispatcher() *kafka.Dispatcher {
+	container.GetSink()
+
+	return container.dispatcher
+}
+
+func (container *Container) getFileSink() sink.Sink {
+	fileSink, err := sink.NewFileSink(
+		container.Cfg.SinkFilePath,
+		container.GetLogger(),
+		sink.WithMaxSize(container.Cfg.SinkFileMaxSize),
+		sink.WithMaxAge(container.Cfg.SinkFileMaxAge),
+		sink.WithCompression(container.Cfg.SinkFileCompress),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return fileSink
+}
+
+func (container *Container) getWebhookSink() sink.Sink {
+	if container.Cfg.SinkWebhookURL == "" {
+		panic(errors.New("SINK_WEBHOOK_URL is required by the webhook sink"))
+	}
+	if _, ok := container.getDeadLetterPolicies()[kafka.DeadLetterStageDelivery]; ok {
+		panic(errors.New("the delivery dead letter policy cannot be used with the webhook sink, use SINK_WEBHOOK_DEAD_LETTER_FILE"))
+	}
+
+	options := []sink.WebhookOption{
+		sink.WithWebhookBatch(container.Cfg.SinkWebhookBatchSize, container.Cfg.SinkWebhookBatchTimeout),
+		sink.WithWebhookConcurrency(container.Cfg.SinkWebhookConcurrency),
+		sink.WithWebhookTimeout(container.Cfg.SinkWebhookTimeout),
+		sink.WithWebhookRetry(container.Cfg.SinkWebhookMaxRetries, container.Cfg.SinkWebhookRetryBackoff, container.Cfg.SinkWebhookRetryMaxBackoff),
+		sink.WithWebhookContext(container.Context()),
+		sink.WithWebhookHaltFunc(container.halt),
+	}
+	if container.Cfg.SinkWebhookSecret != "" {
+		options = append(options, sink.WithWebhookSecret(container.Cfg.SinkWebhookSecret))
+	}
+	if container.Cfg.SinkWebhookDeadLetterFile != "" {
+		options = append(options, sink.WithWebhookDeadLetterQueue(
+			kafka.NewDeadLetterQueue(nil, "", container.Cfg.SinkWebhookDeadLetterFile, 0),
+		))
+	}
+
+	return sink.NewWebhookSink(container.Cfg.SinkWebhookURL, container.GetLogger(), options...)
+}
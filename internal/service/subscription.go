@@ -0,0 +1,42 @@
+package service
+
+import (
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription"
+)
+
+// GetSubscriptionBroadcaster returns the broadcaster of the produced messages to the gRPC subscribers,
+// nil when the gRPC server is disabled
+func (container *Container) GetSubscriptionBroadcaster() *subscription.Broadcaster {
+	if container.Cfg.GrpcAddr == "" {
+		return nil
+	}
+
+	if container.subscriptionBroadcaster == nil {
+		policy, err := subscription.ParsePolicy(container.Cfg.GrpcSlowSubscriberPolicy)
+		if err != nil {
+			panic(err)
+		}
+
+		container.subscriptionBroadcaster = subscription.NewBroadcaster(
+			container.Cfg.GrpcSubscriberBufferSize,
+			policy,
+			container.GetLogger(),
+		)
+	}
+
+	return container.subscriptionBroadcaster
+}
+
+// GetGrpcServer returns the gRPC subscription server, nil when it is disabled
+func (container *Container) GetGrpcServer() *subscription.Server {
+	broadcaster := container.GetSubscriptionBroadcaster()
+	if broadcaster == nil {
+		return nil
+	}
+
+	if container.grpcServer == nil {
+		container.grpcServer = subscription.NewServer(container.GetLogger(), broadcaster, container.Cfg.GrpcAddr)
+	}
+
+	return container.grpcServer
+}
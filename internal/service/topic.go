@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+
+	kafkaconfluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/http/handler"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/mongo"
+	"github.com/etf1/kafka-mongo-watcher/internal/sink"
+	"github.com/gol4ng/logger"
+)
+
+// GetTopicProvisioner returns the provisioner of the topics of KAFKA_BOOTSTRAP_SERVERS, nil when
+// KAFKA_TOPIC_PROVISIONING is none
+func (container *Container) GetTopicProvisioner() *kafka.TopicProvisioner {
+	mode, err := kafka.ParseTopicProvisioning(container.Cfg.Kafka.TopicProvisioning)
+	if err != nil {
+		panic(err)
+	}
+	if mode == kafka.TopicProvisioningNone {
+		return nil
+	}
+
+	if container.topicProvisioner == nil {
+		options := []kafka.TopicOption{
+			kafka.WithTopicTimeout(container.Cfg.Kafka.TopicProvisioningTimeout),
+		}
+		if mode == kafka.TopicProvisioningCreate {
+			options = append(options, kafka.WithTopicCreation(container.Cfg.Kafka.TopicPartitions, container.Cfg.Kafka.TopicReplicationFactor))
+		}
+
+		container.topicProvisioner = kafka.NewTopicProvisioner(container.GetLogger(), options...)
+	}
+
+	return container.topicProvisioner
+}
+
+// ProvisionTopics checks the topics produced to, creating the missing ones when KAFKA_TOPIC_PROVISIONING
+// is create. It returns an error when a topic is missing or does not meet the pipeline needs.
+func (container *Container) ProvisionTopics() error {
+	provisioner := container.GetTopicProvisioner()
+	if provisioner == nil {
+		return nil
+	}
+
+	admin, err := kafkaconfluent.NewAdminClient(container.getKafkaConsumerConfigMap(kafkaconfluent.ConfigMap{}))
+	if err != nil {
+		panic(err)
+	}
+	defer admin.Close()
+
+	return provisioner.Provision(container.baseContext, admin, container.getTopicRequirements())
+}
+
+// Returns the topics of KAFKA_BOOTSTRAP_SERVERS the pipeline produces to
+func (container *Container) getTopicRequirements() []*kafka.TopicRequirement {
+	var requirements []*kafka.TopicRequirement
+
+	// The messages are sent to other clusters with the mirrors
+	if container.Cfg.Sink.Sink == sink.Kafka && container.Cfg.Kafka.Mirrors == "" {
+		config, err := kafka.ParseTopicConfig(container.Cfg.Kafka.TopicConfig)
+		if err != nil {
+			panic(err)
+		}
+		deletePolicy, err := mongo.ParseDeletePolicy(container.Cfg.Kafka.DeletePolicy)
+		if err != nil {
+			panic(err)
+		}
+		// Tombstones only remove the previous messages of a key from compacted topics
+		compacted := deletePolicy != mongo.DeletePolicyEvent
+
+		rules, err := mongo.ParseRoutingRules(container.Cfg.Kafka.RoutingRules)
+		if err != nil {
+			panic(err)
+		}
+
+		var topics []string
+		if container.Cfg.Kafka.Topic != "" && !container.Cfg.Kafka.RoutingDropUnmatched {
+			topics = append(topics, container.Cfg.Kafka.Topic)
+		}
+		for _, rule := range rules {
+			topics = append(topics, rule.Topics...)
+			if rule.Template != "" {
+				container.GetLogger().Warning("Templated topics are not provisioned", logger.String("rule", rule.Name), logger.String("template", rule.Template))
+			}
+		}
+		for _, topic := range topics {
+			requirements = append(requirements, &kafka.TopicRequirement{Name: topic, Config: config, Compacted: compacted})
+		}
+
+		if container.Cfg.Kafka.TransactionTopic != "" {
+			requirements = append(requirements, &kafka.TopicRequirement{Name: container.Cfg.Kafka.TransactionTopic, Config: config})
+		}
+	}
+
+	if container.Cfg.DeadLetterTopic != "" {
+		requirements = append(requirements, &kafka.TopicRequirement{Name: container.Cfg.DeadLetterTopic})
+	}
+	// The last checkpoint of each pipeline has to be kept
+	if container.Cfg.Kafka.CheckpointTopic != "" {
+		requirements = append(requirements, &kafka.TopicRequirement{Name: container.Cfg.Kafka.CheckpointTopic, Compacted: true})
+	}
+
+	return requirements
+}
+
+// Returns the readiness check of the topics provisioning
+func (container *Container) getTopicsCheck() handler.Check {
+	provisioner := container.GetTopicProvisioner()
+	return func(_ context.Context) (interface{}, error) {
+		statuses, err := provisioner.Status()
+		if statuses == nil {
+			return nil, err
+		}
+		return statuses, err
+	}
+}
@@ -0,0 +1,163 @@
+package sink
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gol4ng/logger"
+)
+
+// Layout of the timestamp suffixed to the rotated files
+const rotatedLayout = "20060102T150405.000000000"
+
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	compress bool
+	logger   logger.LoggerInterface
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// FileOption allows to customize the file sink rotation
+type FileOption func(*rotatingFile)
+
+// WithMaxSize allows to rotate the file once it reaches the given size in bytes
+func WithMaxSize(size int64) FileOption {
+	return func(f *rotatingFile) {
+		f.maxSize = size
+	}
+}
+
+// WithMaxAge allows to rotate the file once it has been opened for the given duration
+func WithMaxAge(age time.Duration) FileOption {
+	return func(f *rotatingFile) {
+		f.maxAge = age
+	}
+}
+
+// WithCompression allows to gzip the rotated files
+func WithCompression(enabled bool) FileOption {
+	return func(f *rotatingFile) {
+		f.compress = enabled
+	}
+}
+
+func newRotatingFile(path string, log logger.LoggerInterface, options ...FileOption) (*rotatingFile, error) {
+	file := &rotatingFile{path: path, logger: log}
+	for _, option := range options {
+		option(file)
+	}
+
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Write writes the line in the current file, the file is rotated first when the line would exceed its
+// maximum size or when it is too old. A line is never split across files.
+func (f *rotatingFile) Write(line []byte) (int, error) {
+	if f.shouldRotate(int64(len(line))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) shouldRotate(size int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+size > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && time.Since(f.openedAt) >= f.maxAge
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+// Renames the current file and opens a new one. A file is opened at the path again whatever the failure
+// so that the following lines can still be written, the rotated file is kept uncompressed when it
+// cannot be compressed.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err == nil {
+		rotated := f.path + "." + time.Now().UTC().Format(rotatedLayout)
+		err = os.Rename(f.path, rotated)
+		if err == nil && f.compress {
+			if compressErr := compressFile(rotated); compressErr != nil {
+				f.logger.Error("File sink: Rotated file kept uncompressed", logger.String("file", rotated), logger.Error("error", compressErr))
+			}
+		}
+	}
+
+	if openErr := f.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// Close syncs and closes the current file
+func (f *rotatingFile) Close() error {
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// Replaces the file by its gzipped version
+func compressFile(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(target)
+	_, err = io.Copy(writer, source)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// The partial archive is removed, the file is kept uncompressed
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
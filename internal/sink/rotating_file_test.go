@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	file, err := newRotatingFile(path, logger.NewNopLogger(), WithMaxSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	assert := assert.New(t)
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(err)
+	}
+	assert.NoError(file.Close())
+
+	// Then
+	rotated, err := filepath.Glob(path + ".*")
+	assert.NoError(err)
+	assert.Len(rotated, 2)
+
+	var contents []string
+	for _, name := range append(rotated, path) {
+		content, err := os.ReadFile(name)
+		assert.NoError(err)
+		contents = append(contents, string(content))
+	}
+	assert.Equal([]string{"line-1\n", "line-2\n", "line-3\n"}, contents, "a line is never split")
+}
+
+func TestRotatingFileRotatesByAgeAndCompresses(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	file, err := newRotatingFile(path, logger.NewNopLogger(), WithMaxAge(time.Millisecond), WithCompression(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	assert := assert.New(t)
+	_, err = file.Write([]byte("line-1\n"))
+	assert.NoError(err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = file.Write([]byte("line-2\n"))
+	assert.NoError(err)
+	assert.NoError(file.Close())
+
+	// Then
+	rotated, err := filepath.Glob(path + ".*")
+	assert.NoError(err)
+	if !assert.Len(rotated, 1) {
+		return
+	}
+	assert.True(strings.HasSuffix(rotated[0], ".gz"))
+
+	compressed, err := os.Open(rotated[0])
+	assert.NoError(err)
+	defer compressed.Close()
+	reader, err := gzip.NewReader(compressed)
+	assert.NoError(err)
+	content, err := io.ReadAll(reader)
+	assert.NoError(err)
+	assert.Equal("line-1\n", string(content))
+
+	current, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal("line-2\n", string(current))
+}
+
+func TestRotatingFileKeepsWritingWhenRotationFails(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	file, err := newRotatingFile(path, logger.NewNopLogger(), WithMaxSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	_, err = file.Write([]byte("line-1\n"))
+	assert.NoError(err)
+
+	// The current file cannot be renamed anymore
+	assert.NoError(os.Remove(path))
+
+	// When
+	_, rotateErr := file.Write([]byte("line-2\n"))
+	_, err = file.Write([]byte("line-3\n"))
+
+	// Then
+	assert.ErrorIs(rotateErr, os.ErrNotExist)
+	assert.NoError(err, "a file is opened at the path again")
+	assert.NoError(file.Close())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal("line-3\n", string(content))
+}
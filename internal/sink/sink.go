@@ -0,0 +1,31 @@
+package sink
+
+import (
+	"context"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+)
+
+// Names of the available sinks
+const (
+	Kafka   = "kafka"
+	Stdout  = "stdout"
+	File    = "file"
+	Webhook = "webhook"
+)
+
+// Sink is a destination of the transformed messages. Deliveries are acknowledged by Kafka delivery
+// reports sent on the events channel, carrying the kafka.Delivery of the message as opaque, so that the
+// dispatcher subscribers (checkpoint tracker, metrics, ...) handle them the same whatever the sink.
+type Sink interface {
+	// Produce sends the message, the error is returned when it cannot be sent
+	Produce(ctx context.Context, message *kafka.Message) error
+	// Events returns the delivery reports channel, closed once the sink is closed
+	Events() chan confluent.Event
+	// Close waits for the pending deliveries and closes the sink
+	Close() error
+}
+
+// The Kafka client is the default sink
+var _ Sink = kafka.Client(nil)
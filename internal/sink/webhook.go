@@ -0,0 +1,450 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+)
+
+// HeaderSignature is the header carrying the HMAC-SHA256 signature of the webhook payload,
+// as "sha256=<hex digest>"
+const HeaderSignature = "X-Webhook-Signature"
+
+// Size of the queue of each webhook lane
+const laneSize = 1000
+
+// ErrWebhookStatus is returned when the webhook answers with a non 2xx status
+var ErrWebhookStatus = errors.New("unexpected webhook status")
+
+type webhookSink struct {
+	url          string
+	client       *http.Client
+	secret       []byte
+	batchSize    int
+	batchTimeout time.Duration
+	concurrency  int
+	maxRetries   int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	deadLetters  *kafka.DeadLetterQueue
+	logger       logger.LoggerInterface
+	// Done once the retries have to be given up, their messages are left undelivered
+	ctx  context.Context
+	halt func(error)
+
+	events chan confluent.Event
+	lanes  []chan *kafka.Delivery
+	wg     sync.WaitGroup
+
+	mutex    sync.Mutex
+	sequence uint64
+	closed   bool
+
+	// Set once a message could neither be posted nor dead lettered, the following ones are not posted.
+	// It has its own mutex as Produce holds the other one while waiting for a lane.
+	errMutex sync.Mutex
+	err      error
+	// Number of messages whose retries were given up
+	undelivered atomic.Int64
+}
+
+// WebhookOption allows to customize the webhook sink
+type WebhookOption func(*webhookSink)
+
+// WithWebhookSecret allows to sign the payloads with the given secret, in the HeaderSignature header
+func WithWebhookSecret(secret string) WebhookOption {
+	return func(s *webhookSink) {
+		s.secret = []byte(secret)
+	}
+}
+
+// WithWebhookBatch allows to send up to size messages per request, as a JSON array. A batch is sent
+// once full or when its first message has been waiting for the given timeout.
+func WithWebhookBatch(size int, timeout time.Duration) WebhookOption {
+	return func(s *webhookSink) {
+		s.batchSize = size
+		s.batchTimeout = timeout
+	}
+}
+
+// WithWebhookConcurrency allows to set the number of requests sent in parallel. Messages with the same
+// key are always sent by the same lane, in order.
+func WithWebhookConcurrency(concurrency int) WebhookOption {
+	return func(s *webhookSink) {
+		s.concurrency = concurrency
+	}
+}
+
+// WithWebhookTimeout allows to set the timeout of each request
+func WithWebhookTimeout(timeout time.Duration) WebhookOption {
+	return func(s *webhookSink) {
+		s.client.Timeout = timeout
+	}
+}
+
+// WithWebhookRetry allows to retry the requests failing with a 5xx status or a request error, such as
+// a timeout, up to maxRetries times with an exponential backoff
+func WithWebhookRetry(maxRetries int, backoff time.Duration, maxBackoff time.Duration) WebhookOption {
+	return func(s *webhookSink) {
+		s.maxRetries = maxRetries
+		s.backoff = backoff
+		s.maxBackoff = maxBackoff
+	}
+}
+
+// WithWebhookDeadLetterQueue allows to write the messages that cannot be sent to a dead letter queue,
+// they are acknowledged once written. Without it, their delivery fails and halts the stream.
+func WithWebhookDeadLetterQueue(queue *kafka.DeadLetterQueue) WebhookOption {
+	return func(s *webhookSink) {
+		s.deadLetters = queue
+	}
+}
+
+// WithWebhookContext allows to give up the retries waiting for their backoff once the context is done,
+// their messages are left undelivered
+func WithWebhookContext(ctx context.Context) WebhookOption {
+	return func(s *webhookSink) {
+		s.ctx = ctx
+	}
+}
+
+// WithWebhookHaltFunc allows to be notified when a message that cannot be sent halts the stream
+func WithWebhookHaltFunc(halt func(error)) WebhookOption {
+	return func(s *webhookSink) {
+		s.halt = halt
+	}
+}
+
+// NewWebhookSink returns a sink posting the messages to the given URL, as JSON. Messages are
+// acknowledged once the webhook answered with a 2xx status.
+func NewWebhookSink(url string, log logger.LoggerInterface, options ...WebhookOption) *webhookSink {
+	s := &webhookSink{
+		url:          url,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		batchSize:    1,
+		batchTimeout: 100 * time.Millisecond,
+		concurrency:  1,
+		logger:       log,
+		ctx:          context.Background(),
+		events:       make(chan confluent.Event, eventsSize),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.batchSize < 1 {
+		s.batchSize = 1
+	}
+	if s.concurrency < 1 {
+		s.concurrency = 1
+	}
+
+	s.lanes = make([]chan *kafka.Delivery, s.concurrency)
+	for i := range s.lanes {
+		s.lanes[i] = make(chan *kafka.Delivery, laneSize)
+		s.wg.Add(1)
+		go s.run(s.lanes[i])
+	}
+
+	return s
+}
+
+// Produce queues the message in the lane of its key, blocking while the lane is full
+func (s *webhookSink) Produce(ctx context.Context, message *kafka.Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	if err := s.halted(); err != nil {
+		return err
+	}
+	s.sequence++
+	delivery := &kafka.Delivery{Message: message, Attempts: 1, Sequence: s.sequence}
+
+	select {
+	case s.lanes[s.lane(delivery)] <- delivery:
+		return nil
+	case <-ctx.Done():
+		s.sequence--
+		return ctx.Err()
+	}
+}
+
+// Returns the lane index of the message, messages without key are spread over the lanes
+func (s *webhookSink) lane(delivery *kafka.Delivery) int {
+	if len(delivery.Message.Key) == 0 {
+		return int(delivery.Sequence % uint64(s.concurrency))
+	}
+
+	hash := fnv.New32a()
+	hash.Write(delivery.Message.Key)
+	return int(hash.Sum32() % uint32(s.concurrency))
+}
+
+// Events returns the delivery reports
+func (s *webhookSink) Events() chan confluent.Event {
+	return s.events
+}
+
+// Close sends the queued messages, retries included, and closes the delivery reports channel. An
+// ErrUndelivered error is returned when retries were given up.
+func (s *webhookSink) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	for _, lane := range s.lanes {
+		close(lane)
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	close(s.events)
+	if undelivered := s.undelivered.Load(); undelivered > 0 {
+		return fmt.Errorf("%w: %d messages not sent to the webhook", kafka.ErrUndelivered, undelivered)
+	}
+	return nil
+}
+
+// Batches the messages of a lane and sends them in order
+func (s *webhookSink) run(lane chan *kafka.Delivery) {
+	defer s.wg.Done()
+
+	var (
+		batch   []*kafka.Delivery
+		expired <-chan time.Time
+	)
+	for {
+		select {
+		case delivery, ok := <-lane:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			batch = append(batch, delivery)
+			if len(batch) >= s.batchSize {
+				s.send(batch)
+				batch, expired = nil, nil
+			} else if len(batch) == 1 {
+				expired = time.After(s.batchTimeout)
+			}
+		case <-expired:
+			s.send(batch)
+			batch, expired = nil, nil
+		}
+	}
+}
+
+// Sends the batch and reports the delivery of its messages
+func (s *webhookSink) send(batch []*kafka.Delivery) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.halted(); err != nil {
+		// The messages following the failed one are not sent, so that no later checkpoint is delivered
+		s.fail(batch, err)
+		return
+	}
+
+	body, err := s.payload(batch)
+	attempts := 0
+	if err == nil {
+		attempts, err = s.post(body)
+	}
+	if err == nil {
+		for _, delivery := range batch {
+			s.events <- deliveryReport(delivery, nil)
+		}
+		return
+	}
+	if errors.Is(err, kafka.ErrUndelivered) {
+		s.logger.Warning("Webhook sink: Payload left undelivered", logger.String("url", s.url), logger.Int64("messages", int64(len(batch))), logger.Error("error", err))
+		s.undelivered.Add(int64(len(batch)))
+		s.fail(batch, err)
+		return
+	}
+
+	s.logger.Error("Webhook sink: Payload not sent", logger.String("url", s.url), logger.Int64("messages", int64(len(batch))), logger.Error("error", err))
+	for _, delivery := range batch {
+		deadLetterErr := s.deadLetter(delivery, err, attempts)
+		if deadLetterErr != nil {
+			// Skipping the message would lose it, the stream is halted at it
+			delivery.MarkUnresolved()
+			s.stop(deadLetterErr)
+		}
+		s.events <- deliveryReport(delivery, deadLetterErr)
+	}
+}
+
+// Reports the failed delivery of the messages, the checkpoint is held back at them
+func (s *webhookSink) fail(batch []*kafka.Delivery, err error) {
+	for _, delivery := range batch {
+		delivery.MarkUnresolved()
+		s.events <- deliveryReport(delivery, err)
+	}
+}
+
+// Halts the stream once, the following messages are not sent anymore
+func (s *webhookSink) stop(err error) {
+	s.errMutex.Lock()
+	if s.err != nil {
+		s.errMutex.Unlock()
+		return
+	}
+	s.err = fmt.Errorf("%w: %w", kafka.ErrStreamHalted, err)
+	haltErr := s.err
+	s.errMutex.Unlock()
+
+	s.logger.Error("Webhook sink: Halting the stream", logger.String("url", s.url), logger.Error("error", haltErr))
+	if s.halt != nil {
+		s.halt(haltErr)
+	}
+}
+
+// Returns the error that halted the stream, nil when it is not halted
+func (s *webhookSink) halted() error {
+	s.errMutex.Lock()
+	defer s.errMutex.Unlock()
+	return s.err
+}
+
+// Writes the message to the dead letter queue, the returned error is nil once it is written
+func (s *webhookSink) deadLetter(delivery *kafka.Delivery, err error, attempts int) error {
+	if s.deadLetters == nil {
+		return err
+	}
+
+	letter := &kafka.DeadLetter{
+		Stage:    kafka.DeadLetterStageDelivery,
+		Topic:    delivery.Message.Topic,
+		Key:      delivery.Message.Key,
+		Value:    delivery.Message.Value,
+		Headers:  delivery.Message.Headers,
+		Err:      err,
+		Attempts: attempts,
+	}
+	if sendErr := s.deadLetters.Send(letter); sendErr != nil {
+		return errors.Join(err, sendErr)
+	}
+	return nil
+}
+
+// Returns a single JSON object, or a JSON array when the messages are batched
+func (s *webhookSink) payload(batch []*kafka.Delivery) ([]byte, error) {
+	records := make([]record, 0, len(batch))
+	for _, delivery := range batch {
+		record, err := newRecord(delivery.Message)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	if s.batchSize == 1 {
+		return json.Marshal(records[0])
+	}
+	return json.Marshal(records)
+}
+
+// Posts the payload, retrying the transient failures. It returns the number of attempts.
+func (s *webhookSink) post(body []byte) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := s.do(body)
+		if err == nil || !retryable(err) || attempt > s.maxRetries {
+			return attempt, err
+		}
+
+		backoff := s.retryBackoff(attempt)
+		s.logger.Warning("Webhook sink: Retrying request", logger.String("url", s.url), logger.Int64("attempt", int64(attempt)), logger.Duration("backoff", backoff), logger.Error("error", err))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return attempt, fmt.Errorf("%w: retry given up: %w", kafka.ErrUndelivered, err)
+		}
+	}
+}
+
+func (s *webhookSink) do(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		request.Header.Set(HeaderSignature, Sign(s.secret, body))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// Drained so that the connection can be reused
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return &statusError{code: response.StatusCode}
+	}
+	return nil
+}
+
+// Returns the delay to wait before the retry following the given attempt
+func (s *webhookSink) retryBackoff(attempt int) time.Duration {
+	backoff := s.backoff
+	for i := 1; i < attempt && backoff > 0; i++ {
+		backoff *= 2
+		if s.maxBackoff > 0 && backoff >= s.maxBackoff {
+			return s.maxBackoff
+		}
+	}
+	return backoff
+}
+
+// Sign returns the signature of the payload sent in the HeaderSignature header
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %d", ErrWebhookStatus, e.code)
+}
+
+func (e *statusError) Unwrap() error {
+	return ErrWebhookStatus
+}
+
+// The server errors and the request errors, such as timeouts, are retried. The other statuses are not.
+func retryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500
+	}
+	return true
+}
@@ -0,0 +1,301 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the delivery reports of the closed sink
+func giveReports(sink *webhookSink) []*confluent.Message {
+	var reports []*confluent.Message
+	for event := range sink.Events() {
+		reports = append(reports, event.(*confluent.Message))
+	}
+	return reports
+}
+
+func TestWebhookSinkPostsSignedMessages(t *testing.T) {
+	// Given
+	var (
+		mutex  sync.Mutex
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, Sign([]byte("my-secret"), body), r.Header.Get(HeaderSignature))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(), WithWebhookSecret("my-secret"))
+
+	first := &kafka.Message{Topic: "items", Key: []byte("a"), Value: []byte(`{"id":1}`)}
+	second := &kafka.Message{Topic: "items", Key: []byte("a"), Value: []byte(`{"id":2}`)}
+
+	// When
+	assert := assert.New(t)
+	assert.NoError(sink.Produce(context.Background(), first))
+	assert.NoError(sink.Produce(context.Background(), second))
+	assert.NoError(sink.Close())
+
+	// Then
+	assert.Equal([]string{
+		`{"topic":"items","key":"a","value":{"id":1}}`,
+		`{"topic":"items","key":"a","value":{"id":2}}`,
+	}, bodies)
+
+	reports := giveReports(sink)
+	if assert.Len(reports, 2) {
+		assert.NoError(reports[0].TopicPartition.Error)
+		assert.Equal(&kafka.Delivery{Message: first, Attempts: 1, Sequence: 1}, kafka.DeliveryOf(reports[0]))
+		assert.Equal(&kafka.Delivery{Message: second, Attempts: 1, Sequence: 2}, kafka.DeliveryOf(reports[1]))
+	}
+
+	assert.ErrorIs(sink.Produce(context.Background(), first), os.ErrClosed)
+}
+
+func TestWebhookSinkBatchesMessages(t *testing.T) {
+	// Given
+	var (
+		mutex   sync.Mutex
+		batches [][]record
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []record
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+		mutex.Lock()
+		batches = append(batches, batch)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(), WithWebhookBatch(3, time.Hour))
+
+	// When
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, sink.Produce(context.Background(), &kafka.Message{Topic: "items", Value: []byte(strconv.Itoa(i))}))
+	}
+	assert.NoError(t, sink.Close())
+
+	// Then
+	assert := assert.New(t)
+	if assert.Len(batches, 2, "the full batch is sent, the last one on close") {
+		assert.Len(batches[0], 3)
+		assert.Len(batches[1], 2)
+		assert.Equal(json.RawMessage("5"), batches[1][1].Value)
+	}
+	assert.Len(giveReports(sink), 5)
+}
+
+func TestWebhookSinkSendsBatchAfterTimeout(t *testing.T) {
+	// Given
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(), WithWebhookBatch(10, 10*time.Millisecond))
+	defer sink.Close()
+
+	// When
+	assert.NoError(t, sink.Produce(context.Background(), &kafka.Message{Topic: "items", Value: []byte("1")}))
+
+	// Then
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("the batch has not been sent after its timeout")
+	}
+}
+
+func TestWebhookSinkKeepsKeyOrder(t *testing.T) {
+	// Given
+	var (
+		mutex  sync.Mutex
+		values = map[string][]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record record
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+
+		mutex.Lock()
+		values[record.Key] = append(values[record.Key], string(record.Value))
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(), WithWebhookConcurrency(4))
+
+	// When
+	for i := 0; i < 100; i++ {
+		message := &kafka.Message{Topic: "items", Key: []byte(strconv.Itoa(i % 5)), Value: []byte(strconv.Itoa(i))}
+		assert.NoError(t, sink.Produce(context.Background(), message))
+	}
+	assert.NoError(t, sink.Close())
+
+	// Then
+	for key, keyValues := range values {
+		var expected []string
+		for i := 0; i < 100; i++ {
+			if strconv.Itoa(i%5) == key {
+				expected = append(expected, strconv.Itoa(i))
+			}
+		}
+		assert.Equal(t, expected, keyValues, "messages of key %s are sent in order", key)
+	}
+	assert.Len(t, values, 5)
+}
+
+func TestWebhookSinkRetriesServerErrorsAndTimeouts(t *testing.T) {
+	// Given
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(),
+		WithWebhookTimeout(20*time.Millisecond),
+		WithWebhookRetry(3, time.Millisecond, 10*time.Millisecond),
+	)
+
+	// When
+	assert.NoError(t, sink.Produce(context.Background(), &kafka.Message{Topic: "items", Value: []byte("1")}))
+	assert.NoError(t, sink.Close())
+
+	// Then
+	reports := giveReports(sink)
+	if assert.Len(t, reports, 1) {
+		assert.NoError(t, reports[0].TopicPartition.Error)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWebhookSinkWritesFailedMessagesToDeadLetterFile(t *testing.T) {
+	// Given
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(),
+		WithWebhookRetry(3, time.Millisecond, 10*time.Millisecond),
+		WithWebhookDeadLetterQueue(kafka.NewDeadLetterQueue(nil, "", file, time.Second)),
+	)
+
+	// When
+	assert.NoError(t, sink.Produce(context.Background(), &kafka.Message{Topic: "items", Key: []byte("a"), Value: []byte("1")}))
+	assert.NoError(t, sink.Close())
+
+	// Then
+	assert := assert.New(t)
+	assert.Equal(int32(1), calls.Load(), "client errors are not retried")
+
+	reports := giveReports(sink)
+	if assert.Len(reports, 1) {
+		assert.NoError(reports[0].TopicPartition.Error, "the message is acknowledged once dead lettered")
+	}
+
+	content, err := os.ReadFile(file)
+	assert.NoError(err)
+	assert.Contains(string(content), `"stage":"delivery"`)
+	assert.Contains(string(content), `"error":"unexpected webhook status 400"`)
+	assert.Contains(string(content), `"key":"a"`)
+}
+
+func TestWebhookSinkHaltsWithoutDeadLetterQueue(t *testing.T) {
+	// Given
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var haltErr error
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(),
+		WithWebhookRetry(1, time.Millisecond, time.Millisecond),
+		WithWebhookHaltFunc(func(err error) {
+			haltErr = err
+		}),
+	)
+
+	// When
+	assert.NoError(t, sink.Produce(context.Background(), &kafka.Message{Topic: "items", Value: []byte("1")}))
+	assert.Eventually(t, func() bool {
+		return sink.Produce(context.Background(), &kafka.Message{Topic: "items", Value: []byte("2")}) != nil
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, sink.Close())
+
+	// Then
+	assert := assert.New(t)
+	assert.ErrorIs(haltErr, kafka.ErrStreamHalted)
+	assert.ErrorIs(haltErr, ErrWebhookStatus)
+
+	reports := giveReports(sink)
+	if assert.NotEmpty(reports) {
+		assert.ErrorIs(reports[0].TopicPartition.Error, ErrWebhookStatus)
+	}
+	for _, report := range reports[1:] {
+		assert.ErrorIs(report.TopicPartition.Error, kafka.ErrStreamHalted, "the messages following the failed one are not sent")
+	}
+	assert.Equal(int32(2), calls.Load(), "only the failed message has been posted")
+}
+
+func TestWebhookSinkGivesUpRetriesWhenStopped(t *testing.T) {
+	// Given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := NewWebhookSink(server.URL, logger.NewNopLogger(),
+		WithWebhookRetry(3, time.Minute, time.Minute),
+		WithWebhookContext(ctx),
+	)
+	assert.NoError(t, sink.Produce(context.Background(), &kafka.Message{Topic: "items", Value: []byte("1")}))
+
+	// When
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	start := time.Now()
+	err := sink.Close()
+
+	// Then
+	assert.Less(t, time.Since(start), time.Second, "the retry backoff is not waited for")
+	assert.ErrorIs(t, err, kafka.ErrUndelivered)
+	reports := giveReports(sink)
+	if assert.Len(t, reports, 1) {
+		assert.ErrorIs(t, reports[0].TopicPartition.Error, kafka.ErrUndelivered)
+	}
+}
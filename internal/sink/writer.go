@@ -0,0 +1,157 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+)
+
+// Size of the delivery reports channel of the sinks
+const eventsSize = 1000
+
+// record is the JSON line written for each message
+type record struct {
+	Topic     string            `json:"topic"`
+	Key       string            `json:"key,omitempty"`
+	Value     json.RawMessage   `json:"value"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
+}
+
+func newRecord(message *kafka.Message) (record, error) {
+	record := record{
+		Topic: message.Topic,
+		Key:   string(message.Key),
+		Value: message.Value,
+	}
+	switch {
+	case message.Value == nil:
+		// Tombstone
+		record.Value = json.RawMessage("null")
+	case !json.Valid(message.Value):
+		value, err := json.Marshal(string(message.Value))
+		if err != nil {
+			return record, err
+		}
+		record.Value = value
+	}
+	if len(message.Headers) > 0 {
+		record.Headers = make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			record.Headers[header.Key] = string(header.Value)
+		}
+	}
+	if !message.Timestamp.IsZero() {
+		record.Timestamp = &message.Timestamp
+	}
+	return record, nil
+}
+
+// Returns the message as a JSON line
+func encode(message *kafka.Message) ([]byte, error) {
+	record, err := newRecord(message)
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// Returns the delivery report of the message, failed when an error is given
+func deliveryReport(delivery *kafka.Delivery, err error) *confluent.Message {
+	return &confluent.Message{
+		TopicPartition: confluent.TopicPartition{
+			Topic:  &delivery.Message.Topic,
+			Offset: confluent.Offset(delivery.Sequence - 1),
+			Error:  err,
+		},
+		Key:    delivery.Message.Key,
+		Value:  delivery.Message.Value,
+		Opaque: delivery,
+	}
+}
+
+type writerSink struct {
+	writer io.Writer
+	closer func() error
+	events chan confluent.Event
+
+	mutex    sync.Mutex
+	sequence uint64
+	closed   bool
+}
+
+func newWriterSink(writer io.Writer, closer func() error) *writerSink {
+	return &writerSink{
+		writer: writer,
+		closer: closer,
+		events: make(chan confluent.Event, eventsSize),
+	}
+}
+
+// NewStdoutSink returns a sink writing the messages on the standard output, as JSON lines
+func NewStdoutSink() *writerSink {
+	return newWriterSink(os.Stdout, func() error { return nil })
+}
+
+// NewFileSink returns a sink writing the messages in the given file, as JSON lines. The file is rotated
+// according to the given options.
+func NewFileSink(path string, log logger.LoggerInterface, options ...FileOption) (*writerSink, error) {
+	file, err := newRotatingFile(path, log, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newWriterSink(file, file.Close), nil
+}
+
+// Produce writes the message, it is acknowledged once written
+func (s *writerSink) Produce(_ context.Context, message *kafka.Message) error {
+	line, err := encode(message)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	if _, err := s.writer.Write(line); err != nil {
+		return err
+	}
+	s.sequence++
+
+	s.events <- deliveryReport(&kafka.Delivery{Message: message, Attempts: 1, Sequence: s.sequence}, nil)
+	return nil
+}
+
+// Events returns the delivery reports
+func (s *writerSink) Events() chan confluent.Event {
+	return s.events
+}
+
+// Close closes the underlying writer and the delivery reports channel
+func (s *writerSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.events)
+
+	return s.closer()
+}
@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	// Given
+	timestamp := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+
+	// When - Then
+	assert := assert.New(t)
+
+	line, err := encode(&kafka.Message{
+		Topic:     "items",
+		Key:       []byte("my-key"),
+		Value:     []byte("{\n  \"hello\": \"world\"\n}"),
+		Headers:   []kafka.Header{{Key: "x-mongo-operation", Value: []byte("insert")}},
+		Timestamp: timestamp,
+	})
+	assert.NoError(err)
+	assert.Equal(`{"topic":"items","key":"my-key","value":{"hello":"world"},"headers":{"x-mongo-operation":"insert"},"timestamp":"2020-09-13T12:26:40Z"}`+"\n", string(line))
+
+	line, err = encode(&kafka.Message{Topic: "items", Value: []byte("not json")})
+	assert.NoError(err)
+	assert.Equal(`{"topic":"items","value":"not json"}`+"\n", string(line))
+
+	line, err = encode(&kafka.Message{Topic: "items", Key: []byte("my-key")})
+	assert.NoError(err)
+	assert.Equal(`{"topic":"items","key":"my-key","value":null}`+"\n", string(line))
+}
+
+func TestWriterSinkAcknowledgesWrittenMessages(t *testing.T) {
+	// Given
+	var buffer bytes.Buffer
+	sink := newWriterSink(&buffer, func() error { return nil })
+
+	first := &kafka.Message{Topic: "items", Value: []byte(`{"id":1}`)}
+	second := &kafka.Message{Topic: "items", Value: []byte(`{"id":2}`)}
+
+	// When
+	assert := assert.New(t)
+	assert.NoError(sink.Produce(context.Background(), first))
+	assert.NoError(sink.Produce(context.Background(), second))
+	assert.NoError(sink.Close())
+
+	// Then
+	assert.Equal("{\"topic\":\"items\",\"value\":{\"id\":1}}\n{\"topic\":\"items\",\"value\":{\"id\":2}}\n", buffer.String())
+
+	var deliveries []*kafka.Delivery
+	for event := range sink.Events() {
+		report := event.(*confluent.Message)
+		assert.NoError(report.TopicPartition.Error)
+		deliveries = append(deliveries, kafka.DeliveryOf(report))
+	}
+	assert.Equal([]*kafka.Delivery{
+		{Message: first, Attempts: 1, Sequence: 1},
+		{Message: second, Attempts: 1, Sequence: 2},
+	}, deliveries)
+
+	assert.ErrorIs(sink.Produce(context.Background(), first), os.ErrClosed)
+}
+
+func TestFileSink(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	sink, err := NewFileSink(path, logger.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	assert := assert.New(t)
+	assert.NoError(sink.Produce(context.Background(), &kafka.Message{Topic: "items", Value: []byte(`{"id":1}`)}))
+	assert.NoError(sink.Close())
+
+	// Then
+	content, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal("{\"topic\":\"items\",\"value\":{\"id\":1}}\n", string(content))
+}
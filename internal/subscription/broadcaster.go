@@ -0,0 +1,227 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription/pb"
+	"github.com/gol4ng/logger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy is what is done with a subscriber whose buffer is full
+type Policy string
+
+const (
+	// PolicyDrop drops the events the subscriber buffer has no room for
+	PolicyDrop Policy = "drop"
+	// PolicyDisconnect disconnects the subscriber
+	PolicyDisconnect Policy = "disconnect"
+)
+
+// ParsePolicy returns the policy of the given name
+func ParsePolicy(policy string) (Policy, error) {
+	switch Policy(policy) {
+	case PolicyDrop, PolicyDisconnect:
+		return Policy(policy), nil
+	}
+	return "", fmt.Errorf("unknown slow subscriber policy %q (available: %s, %s)", policy, PolicyDrop, PolicyDisconnect)
+}
+
+// Size of the channel of the events published to the broadcaster
+const eventsSize = 1000
+
+var (
+	errSlowSubscriber = status.Error(codes.ResourceExhausted, "subscriber too slow, its buffer is full")
+	errClosed         = status.Error(codes.Unavailable, "the stream is stopped")
+)
+
+// Subscriber receives the events matching its filter
+type Subscriber struct {
+	filter Filter
+	events chan *pb.Event
+
+	// Closed once the subscriber has been disconnected, err tells why
+	disconnected chan struct{}
+	err          error
+
+	dropped atomic.Int64
+}
+
+// Events returns the events of the subscriber
+func (s *Subscriber) Events() <-chan *pb.Event {
+	return s.events
+}
+
+// Disconnected is closed once the subscriber has been disconnected by the broadcaster
+func (s *Subscriber) Disconnected() <-chan struct{} {
+	return s.disconnected
+}
+
+// Dropped returns the number of events dropped while the buffer of the subscriber was full
+func (s *Subscriber) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Err returns the reason of the disconnection, once disconnected
+func (s *Subscriber) Err() error {
+	return s.err
+}
+
+// Broadcaster fans out the produced messages to the subscribers. Each subscriber has a bounded buffer,
+// the policy applies once it is full so that a slow subscriber never slows down the stream.
+type Broadcaster struct {
+	bufferSize int
+	policy     Policy
+	logger     logger.LoggerInterface
+
+	events         chan *pb.Event
+	newClients     chan *Subscriber
+	closingClients chan *Subscriber
+	clients        map[*Subscriber]bool
+	count          atomic.Int64
+
+	close chan struct{}
+	done  chan struct{}
+}
+
+// NewBroadcaster returns a broadcaster giving each subscriber a buffer of bufferSize events
+func NewBroadcaster(bufferSize int, policy Policy, logger logger.LoggerInterface) *Broadcaster {
+	broadcaster := &Broadcaster{
+		bufferSize:     bufferSize,
+		policy:         policy,
+		logger:         logger,
+		events:         make(chan *pb.Event, eventsSize),
+		newClients:     make(chan *Subscriber),
+		closingClients: make(chan *Subscriber),
+		clients:        make(map[*Subscriber]bool),
+		close:          make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	go broadcaster.listen()
+
+	return broadcaster
+}
+
+// Subscribe registers a subscriber to the events matching the filter
+func (b *Broadcaster) Subscribe(filter Filter) *Subscriber {
+	subscriber := &Subscriber{
+		filter:       filter,
+		events:       make(chan *pb.Event, b.bufferSize),
+		disconnected: make(chan struct{}),
+	}
+
+	select {
+	case b.newClients <- subscriber:
+	case <-b.done:
+		subscriber.err = errClosed
+		close(subscriber.disconnected)
+	}
+	return subscriber
+}
+
+// Unsubscribe removes the subscriber
+func (b *Broadcaster) Unsubscribe(subscriber *Subscriber) {
+	select {
+	case b.closingClients <- subscriber:
+	case <-b.done:
+	}
+}
+
+// Publish sends the message to the matching subscribers
+func (b *Broadcaster) Publish(message *kafka.Message) {
+	if b.count.Load() == 0 {
+		return
+	}
+
+	select {
+	case b.events <- newEvent(message):
+	case <-b.done:
+	}
+}
+
+// Wrap publishes the messages accepted by the sink, it has to be the first middleware so that
+// messages produced again are published once
+func (b *Broadcaster) Wrap(next kafka.ProduceFunc) kafka.ProduceFunc {
+	return func(ctx context.Context, message *kafka.Message) error {
+		err := next(ctx, message)
+		if err == nil {
+			b.Publish(message)
+		}
+		return err
+	}
+}
+
+// Close disconnects all the subscribers
+func (b *Broadcaster) Close() {
+	select {
+	case <-b.close:
+	default:
+		close(b.close)
+	}
+	<-b.done
+}
+
+func (b *Broadcaster) listen() {
+	defer close(b.done)
+
+	for {
+		select {
+		case subscriber := <-b.newClients:
+			b.clients[subscriber] = true
+			b.count.Add(1)
+			b.logger.Debug("Subscription: New subscriber", logger.Int64("subscribers", b.count.Load()))
+		case subscriber := <-b.closingClients:
+			b.remove(subscriber)
+		case event := <-b.events:
+			for subscriber := range b.clients {
+				if subscriber.filter.Match(event) {
+					b.send(subscriber, event)
+				}
+			}
+		case <-b.close:
+			for subscriber := range b.clients {
+				b.disconnect(subscriber, errClosed)
+			}
+			return
+		}
+	}
+}
+
+func (b *Broadcaster) send(subscriber *Subscriber, event *pb.Event) {
+	select {
+	case subscriber.events <- event:
+		return
+	default:
+	}
+
+	if b.policy == PolicyDisconnect {
+		b.logger.Warning("Subscription: Disconnecting slow subscriber", logger.Int64("buffer_size", int64(b.bufferSize)))
+		b.disconnect(subscriber, errSlowSubscriber)
+		return
+	}
+
+	if subscriber.dropped.Add(1) == 1 {
+		b.logger.Warning("Subscription: Dropping events of slow subscriber", logger.Int64("buffer_size", int64(b.bufferSize)))
+	}
+}
+
+func (b *Broadcaster) disconnect(subscriber *Subscriber, err error) {
+	subscriber.err = err
+	close(subscriber.disconnected)
+	b.remove(subscriber)
+}
+
+func (b *Broadcaster) remove(subscriber *Subscriber) {
+	if !b.clients[subscriber] {
+		return
+	}
+
+	delete(b.clients, subscriber)
+	b.count.Add(-1)
+	b.logger.Debug("Subscription: Subscriber removed", logger.Int64("subscribers", b.count.Load()), logger.Int64("dropped", subscriber.Dropped()))
+}
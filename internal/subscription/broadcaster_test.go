@@ -0,0 +1,144 @@
+package subscription
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/mongo"
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription/pb"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func giveMessage(key string, operation string) *kafka.Message {
+	return &kafka.Message{
+		Topic:   "items",
+		Key:     []byte(key),
+		Value:   []byte(`{"id":1}`),
+		Headers: []kafka.Header{{Key: "x-mongo-operation", Value: []byte(operation)}},
+		Event:   &mongo.ChangeEvent{Operation: operation, Namespace: bson.M{"db": "watcher", "coll": "items"}},
+	}
+}
+
+func receive(t *testing.T, subscriber *Subscriber) *pb.Event {
+	select {
+	case event := <-subscriber.Events():
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func TestBroadcasterFansOutMatchingEvents(t *testing.T) {
+	// Given
+	broadcaster := NewBroadcaster(10, PolicyDrop, logger.NewNopLogger())
+	defer broadcaster.Close()
+
+	all := broadcaster.Subscribe(NewFilter(&pb.SubscribeRequest{}))
+	deletes := broadcaster.Subscribe(NewFilter(&pb.SubscribeRequest{OperationTypes: []string{"delete"}}))
+
+	produce := broadcaster.Wrap(func(context.Context, *kafka.Message) error { return nil })
+
+	// When
+	assert.NoError(t, produce(context.Background(), giveMessage("a", "insert")))
+	assert.NoError(t, produce(context.Background(), giveMessage("b", "delete")))
+
+	// Then
+	assert := assert.New(t)
+	assert.Equal(&pb.Event{
+		Topic:         "items",
+		Key:           []byte("a"),
+		Value:         []byte(`{"id":1}`),
+		Headers:       []*pb.Header{{Key: "x-mongo-operation", Value: []byte("insert")}},
+		OperationType: "insert",
+		Collection:    "items",
+	}, receive(t, all))
+	assert.Equal([]byte("b"), receive(t, all).Key)
+	assert.Equal([]byte("b"), receive(t, deletes).Key)
+}
+
+func TestBroadcasterDoesNotPublishFailedMessages(t *testing.T) {
+	// Given
+	broadcaster := NewBroadcaster(10, PolicyDrop, logger.NewNopLogger())
+	defer broadcaster.Close()
+
+	subscriber := broadcaster.Subscribe(NewFilter(&pb.SubscribeRequest{}))
+	produce := broadcaster.Wrap(func(context.Context, *kafka.Message) error { return assert.AnError })
+
+	// When
+	assert.ErrorIs(t, produce(context.Background(), giveMessage("a", "insert")), assert.AnError)
+	broadcaster.Publish(giveMessage("b", "insert"))
+
+	// Then
+	assert.Equal(t, []byte("b"), receive(t, subscriber).Key)
+}
+
+func TestBroadcasterDropsEventsOfSlowSubscriber(t *testing.T) {
+	// Given
+	broadcaster := NewBroadcaster(1, PolicyDrop, logger.NewNopLogger())
+	defer broadcaster.Close()
+
+	slow := broadcaster.Subscribe(NewFilter(&pb.SubscribeRequest{}))
+
+	// When
+	broadcaster.Publish(giveMessage("a", "insert"))
+	broadcaster.Publish(giveMessage("b", "insert"))
+	broadcaster.Publish(giveMessage("c", "insert"))
+
+	// Then
+	assert.Eventually(t, func() bool { return slow.Dropped() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []byte("a"), receive(t, slow).Key)
+
+	broadcaster.Publish(giveMessage("d", "insert"))
+	assert.Equal(t, []byte("d"), receive(t, slow).Key, "events are dropped while the buffer is full")
+
+	select {
+	case <-slow.Disconnected():
+		t.Fatal("the subscriber should stay connected")
+	default:
+	}
+}
+
+func TestBroadcasterDisconnectsSlowSubscriber(t *testing.T) {
+	// Given
+	broadcaster := NewBroadcaster(1, PolicyDisconnect, logger.NewNopLogger())
+	defer broadcaster.Close()
+
+	slow := broadcaster.Subscribe(NewFilter(&pb.SubscribeRequest{}))
+
+	// When
+	broadcaster.Publish(giveMessage("a", "insert"))
+	broadcaster.Publish(giveMessage("b", "insert"))
+
+	// Then
+	select {
+	case <-slow.Disconnected():
+		assert.Equal(t, codes.ResourceExhausted, status.Code(slow.Err()))
+	case <-time.After(time.Second):
+		t.Fatal("the subscriber should be disconnected")
+	}
+}
+
+func TestBroadcasterCloseDisconnectsSubscribers(t *testing.T) {
+	// Given
+	broadcaster := NewBroadcaster(1, PolicyDrop, logger.NewNopLogger())
+	subscriber := broadcaster.Subscribe(NewFilter(&pb.SubscribeRequest{}))
+
+	// When
+	broadcaster.Close()
+
+	// Then
+	<-subscriber.Disconnected()
+	assert.Equal(t, codes.Unavailable, status.Code(subscriber.Err()))
+
+	late := broadcaster.Subscribe(NewFilter(&pb.SubscribeRequest{}))
+	<-late.Disconnected()
+	broadcaster.Unsubscribe(late)
+	broadcaster.Publish(giveMessage("a", "insert"))
+}
@@ -0,0 +1,28 @@
+package subscription
+
+import (
+	"github.com/etf1/kafka-mongo-watcher/internal/kafka"
+	"github.com/etf1/kafka-mongo-watcher/internal/mongo"
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Returns the event streamed to the subscribers for the message
+func newEvent(message *kafka.Message) *pb.Event {
+	event := &pb.Event{
+		Topic: message.Topic,
+		Key:   message.Key,
+		Value: message.Value,
+	}
+	for _, header := range message.Headers {
+		event.Headers = append(event.Headers, &pb.Header{Key: header.Key, Value: header.Value})
+	}
+	if !message.Timestamp.IsZero() {
+		event.Timestamp = timestamppb.New(message.Timestamp)
+	}
+	if changeEvent, ok := message.Event.(*mongo.ChangeEvent); ok && changeEvent != nil {
+		event.OperationType = changeEvent.Operation
+		event.Collection, _ = changeEvent.Namespace["coll"].(string)
+	}
+	return event
+}
@@ -0,0 +1,57 @@
+package subscription
+
+import (
+	"bytes"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription/pb"
+)
+
+// Filter matches the events requested by a subscriber, an empty criterion matches all the events
+type Filter struct {
+	operationTypes map[string]bool
+	collections    map[string]bool
+	keyPrefixes    [][]byte
+}
+
+// NewFilter returns the filter of the subscribe request
+func NewFilter(request *pb.SubscribeRequest) Filter {
+	filter := Filter{
+		operationTypes: toSet(request.GetOperationTypes()),
+		collections:    toSet(request.GetCollections()),
+	}
+	for _, prefix := range request.GetKeyPrefixes() {
+		filter.keyPrefixes = append(filter.keyPrefixes, []byte(prefix))
+	}
+	return filter
+}
+
+// Match returns whether the event matches all the criteria of the filter
+func (f Filter) Match(event *pb.Event) bool {
+	if len(f.operationTypes) > 0 && !f.operationTypes[event.OperationType] {
+		return false
+	}
+	if len(f.collections) > 0 && !f.collections[event.Collection] {
+		return false
+	}
+	if len(f.keyPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range f.keyPrefixes {
+		if bytes.HasPrefix(event.Key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
@@ -0,0 +1,41 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatch(t *testing.T) {
+	event := &pb.Event{Key: []byte("user-42"), OperationType: "update", Collection: "users"}
+
+	testCases := []struct {
+		name     string
+		request  *pb.SubscribeRequest
+		expected bool
+	}{
+		{name: "no filter", request: &pb.SubscribeRequest{}, expected: true},
+		{name: "operation type", request: &pb.SubscribeRequest{OperationTypes: []string{"insert", "update"}}, expected: true},
+		{name: "other operation type", request: &pb.SubscribeRequest{OperationTypes: []string{"delete"}}, expected: false},
+		{name: "collection", request: &pb.SubscribeRequest{Collections: []string{"users"}}, expected: true},
+		{name: "other collection", request: &pb.SubscribeRequest{Collections: []string{"items"}}, expected: false},
+		{name: "key prefix", request: &pb.SubscribeRequest{KeyPrefixes: []string{"item-", "user-"}}, expected: true},
+		{name: "other key prefix", request: &pb.SubscribeRequest{KeyPrefixes: []string{"item-"}}, expected: false},
+		{
+			name: "all criteria have to match",
+			request: &pb.SubscribeRequest{
+				OperationTypes: []string{"update"},
+				Collections:    []string{"users"},
+				KeyPrefixes:    []string{"item-"},
+			},
+			expected: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, NewFilter(testCase.request).Match(event))
+		})
+	}
+}
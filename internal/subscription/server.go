@@ -0,0 +1,90 @@
+package subscription
+
+import (
+	"context"
+	"net"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription/pb"
+	"github.com/gol4ng/logger"
+	"google.golang.org/grpc"
+)
+
+// Server is the gRPC server streaming the events to the subscribers
+type Server struct {
+	pb.UnimplementedWatcherServer
+
+	addr        string
+	broadcaster *Broadcaster
+	logger      logger.LoggerInterface
+	grpcServer  *grpc.Server
+}
+
+// NewServer returns a gRPC server streaming the events of the broadcaster
+func NewServer(logger logger.LoggerInterface, broadcaster *Broadcaster, addr string) *Server {
+	server := &Server{
+		addr:        addr,
+		broadcaster: broadcaster,
+		logger:      logger,
+		grpcServer:  grpc.NewServer(),
+	}
+	pb.RegisterWatcherServer(server.grpcServer, server)
+
+	return server
+}
+
+// Listen listens on the server address, before serving so that an unavailable address fails the startup
+func (s *Server) Listen() (net.Listener, error) {
+	return net.Listen("tcp", s.addr)
+}
+
+// Serve serves gRPC requests on the listener
+func (s *Server) Serve(listener net.Listener) error {
+	s.logger.Info("gRPC server started", logger.String("addr", listener.Addr().String()))
+
+	return s.grpcServer.Serve(listener)
+}
+
+// Close disconnects the subscribers and stops the server, the connections are closed once the
+// context is done
+func (s *Server) Close(ctx context.Context) error {
+	s.broadcaster.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// Subscribe streams the events matching the request filters until the client leaves or is disconnected
+func (s *Server) Subscribe(request *pb.SubscribeRequest, stream grpc.ServerStreamingServer[pb.Event]) error {
+	subscriber := s.broadcaster.Subscribe(NewFilter(request))
+	defer s.broadcaster.Unsubscribe(subscriber)
+
+	s.logger.Info("gRPC subscriber connected",
+		logger.Any("operation_types", request.GetOperationTypes()),
+		logger.Any("collections", request.GetCollections()),
+		logger.Any("key_prefixes", request.GetKeyPrefixes()),
+	)
+
+	for {
+		select {
+		case event := <-subscriber.Events():
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-subscriber.Disconnected():
+			return subscriber.Err()
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
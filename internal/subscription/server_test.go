@@ -0,0 +1,79 @@
+package subscription
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/etf1/kafka-mongo-watcher/internal/subscription/pb"
+	"github.com/gol4ng/logger"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerStreamsSubscribedEvents(t *testing.T) {
+	// Given
+	broadcaster := NewBroadcaster(10, PolicyDrop, logger.NewNopLogger())
+	server := NewServer(logger.NewNopLogger(), broadcaster, "")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	connection, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+
+	stream, err := pb.NewWatcherClient(connection).Subscribe(context.Background(), &pb.SubscribeRequest{KeyPrefixes: []string{"user-"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The subscription is registered once the stream is opened on the server side
+	for deadline := time.Now().Add(time.Second); broadcaster.count.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	// When
+	broadcaster.Publish(giveMessage("item-1", "insert"))
+	broadcaster.Publish(giveMessage("user-1", "update"))
+
+	// Then
+	assert := assert.New(t)
+	event, err := stream.Recv()
+	assert.NoError(err)
+	assert.Equal("user-1", string(event.GetKey()))
+	assert.Equal("update", event.GetOperationType())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(server.Close(ctx))
+
+	_, err = stream.Recv()
+	assert.Equal(codes.Unavailable, status.Code(err))
+}
+
+func TestServerListenFailsWhenAddressIsUnavailable(t *testing.T) {
+	// Given
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	server := NewServer(logger.NewNopLogger(), NewBroadcaster(10, PolicyDrop, logger.NewNopLogger()), listener.Addr().String())
+
+	// When
+	_, err = server.Listen()
+
+	// Then
+	assert.Error(t, err, "the startup fails instead of running without the subscriptions")
+}